@@ -3,6 +3,7 @@ package mtpx
 import (
 	"github.com/ganeshrvel/go-mtpfs/mtp"
 	"os"
+	"time"
 )
 
 const PathSep = string(os.PathSeparator)
@@ -11,6 +12,50 @@ const ParentObjectId = mtp.GOH_ROOT_PARENT
 
 const devTimeout = 15000
 
+// the error message of go-mtpfs for the operations on a closed device
+const deviceNotOpenErrorMessage = "device is not open"
+
+const defaultWatchInterval = time.Second
+
+// the tail of a partial local file which is compared with the object before continuing the download
+const resumeOverlapSize = 0x10000
+
+// name pattern of the temporary files used by [UploadStreamSpooled]
+const spoolFilePattern = "mtpx-upload-*"
+
+// suffix of the hidden temporary file an object is downloaded into
+const tempDownloadFileSuffix = ".mtpx-part"
+
+// suffix of the hidden temporary object a file is uploaded as
+const tempUploadFileSuffix = ".mtpx-part"
+
+// suffix of the hidden name an existing file is kept under while it is replaced by an upload
+const replacedUploadFileSuffix = ".mtpx-old"
+
+// the size of the chunks a download of a [Transfer] is split into, it can be paused in between them
+const pausableChunkSize = 1 << 20
+
+// the size of the read-ahead buffer of [File]
+const readAheadSize = 0x10000
+
+// the files up to this size are copied on the device through the memory, the larger ones through a temporary file
+const copyBufferSize = 16 << 20
+
+// the largest size which can be requested by a single partial object transaction
+const maxPartialObjectSize = 0xFFFFFFFF
+
+// the format used by MTP to encode the date props, they carry no time zone and they are accurate to a second
+const mtpDateFormat = "20060102T150405"
+
+// the hidden directory in the root of each storage which holds the trashed objects
+const trashDirectoryName = ".mtpx-trash"
+
+// full path of the trash directory of a storage
+const trashPath = PathSep + trashDirectoryName
+
+// the file in the trash directory listing the original paths and the deletion times of the trashed objects
+const trashManifestName = "manifest.json"
+
 const newLocalDirectoryMode = 0755
 
 const disallowedFileName = ":*?\"<>|"
@@ -18,3 +63,66 @@ const disallowedFileName = ":*?\"<>|"
 var disallowedFiles = []string{".DS_Store", "[-----DS_Store.mtp.test----].txt"}
 
 var allowedSecondExtensions allowedSecondExtMap = map[string]string{"tar": "tar"}
+
+// the number of leading bytes of a file which are used to detect its content type
+const contentSniffSize = 512
+
+// the object format codes of the file extensions
+var objectFormatExtensions = map[string]uint16{
+	".txt":  mtp.OFC_Text,
+	".html": mtp.OFC_HTML,
+	".htm":  mtp.OFC_HTML,
+	".aif":  mtp.OFC_AIFF,
+	".aiff": mtp.OFC_AIFF,
+	".wav":  mtp.OFC_WAV,
+	".mp3":  mtp.OFC_MP3,
+	".avi":  mtp.OFC_AVI,
+	".mpg":  mtp.OFC_MPEG,
+	".mpeg": mtp.OFC_MPEG,
+	".asf":  mtp.OFC_ASF,
+	".jpg":  mtp.OFC_EXIF_JPEG,
+	".jpeg": mtp.OFC_EXIF_JPEG,
+	".tif":  mtp.OFC_TIFF,
+	".tiff": mtp.OFC_TIFF,
+	".bmp":  mtp.OFC_BMP,
+	".gif":  mtp.OFC_GIF,
+	".png":  mtp.OFC_PNG,
+	".jp2":  mtp.OFC_JP2,
+	".jpx":  mtp.OFC_JPX,
+	".dng":  mtp.OFC_DNG,
+	".m4a":  mtp.OFC_MTP_M4A,
+	".wma":  mtp.OFC_MTP_WMA,
+	".ogg":  mtp.OFC_MTP_OGG,
+	".oga":  mtp.OFC_MTP_OGG,
+	".aac":  mtp.OFC_MTP_AAC,
+	".flac": mtp.OFC_MTP_FLAC,
+	".wmv":  mtp.OFC_MTP_WMV,
+	".mp4":  mtp.OFC_MTP_MP4,
+	".m4v":  mtp.OFC_MTP_MP4,
+	".3gp":  mtp.OFC_MTP_3GP,
+	".m3u":  mtp.OFC_MTP_M3UPlaylist,
+	".pls":  mtp.OFC_MTP_PLSPlaylist,
+	".wpl":  mtp.OFC_MTP_WPLPlaylist,
+	".xml":  mtp.OFC_MTP_XMLDocument,
+	".doc":  mtp.OFC_MTP_MSWordDocument,
+	".xls":  mtp.OFC_MTP_MSExcelSpreadsheetXLS,
+	".ppt":  mtp.OFC_MTP_MSPowerpointPresentationPPT,
+}
+
+// the object format codes of the sniffed content types, used if the extension of a file is unknown
+var objectFormatContentTypes = map[string]uint16{
+	"text/plain":      mtp.OFC_Text,
+	"text/html":       mtp.OFC_HTML,
+	"text/xml":        mtp.OFC_MTP_XMLDocument,
+	"audio/aiff":      mtp.OFC_AIFF,
+	"audio/wave":      mtp.OFC_WAV,
+	"audio/mpeg":      mtp.OFC_MP3,
+	"video/avi":       mtp.OFC_AVI,
+	"video/mpeg":      mtp.OFC_MPEG,
+	"image/jpeg":      mtp.OFC_EXIF_JPEG,
+	"image/bmp":       mtp.OFC_BMP,
+	"image/gif":       mtp.OFC_GIF,
+	"image/png":       mtp.OFC_PNG,
+	"application/ogg": mtp.OFC_MTP_OGG,
+	"video/mp4":       mtp.OFC_MTP_MP4,
+}
@@ -0,0 +1,252 @@
+package mtpx
+
+import (
+	"context"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"io"
+)
+
+// a device which stops running operations once [ctx] is done
+// the transfers are aborted between the usb chunks
+type contextDevice struct {
+	ctx context.Context
+	dev Device
+
+	// called before each operation, it blocks while the transfer is paused
+	// it is never called while a transaction is running since the device drops the session if the transaction stalls for too long
+	// if it is set then the objects are downloaded in chunks so that a download can be paused in the middle of an object
+	wait func() error
+
+	// the object created by the latest SendObjectInfo
+	pendingHandle uint32
+}
+
+func newContextDevice(ctx context.Context, dev Device) *contextDevice {
+	return &contextDevice{ctx: ctx, dev: dev}
+}
+
+// block while the transfer is paused and check whether [ctx] is done
+// it is called before starting an operation
+func (c *contextDevice) err() error {
+	if c.wait != nil {
+		if err := c.wait(); err != nil {
+			return err
+		}
+	}
+
+	return c.canceled()
+}
+
+// check whether [ctx] is done
+// it is called between the usb chunks of a running transaction
+func (c *contextDevice) canceled() error {
+	if err := c.ctx.Err(); err != nil {
+		return CanceledError{error: err}
+	}
+
+	return nil
+}
+
+// returns [err] as a [CanceledError] if [ctx] is done
+func canceledError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+
+	return CanceledError{error: ctx.Err()}
+}
+
+// the device is closed by the owner of the context
+func (c *contextDevice) Close() error {
+	return c.dev.Close()
+}
+
+func (c *contextDevice) GetDeviceInfo(info *mtp.DeviceInfo) error {
+	if err := c.err(); err != nil {
+		return err
+	}
+
+	return c.dev.GetDeviceInfo(info)
+}
+
+func (c *contextDevice) GetStorageIDs(info *mtp.Uint32Array) error {
+	if err := c.err(); err != nil {
+		return err
+	}
+
+	return c.dev.GetStorageIDs(info)
+}
+
+func (c *contextDevice) GetStorageInfo(ID uint32, info *mtp.StorageInfo) error {
+	if err := c.err(); err != nil {
+		return err
+	}
+
+	return c.dev.GetStorageInfo(ID, info)
+}
+
+func (c *contextDevice) GetObjectHandles(storageID, objFormatCode, parent uint32, info *mtp.Uint32Array) error {
+	if err := c.err(); err != nil {
+		return err
+	}
+
+	return c.dev.GetObjectHandles(storageID, objFormatCode, parent, info)
+}
+
+func (c *contextDevice) GetObjectInfo(handle uint32, info *mtp.ObjectInfo) error {
+	if err := c.err(); err != nil {
+		return err
+	}
+
+	return c.dev.GetObjectInfo(handle, info)
+}
+
+func (c *contextDevice) GetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error {
+	if err := c.err(); err != nil {
+		return err
+	}
+
+	return c.dev.GetObjectPropValue(objHandle, objPropCode, value)
+}
+
+func (c *contextDevice) SetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error {
+	if err := c.err(); err != nil {
+		return err
+	}
+
+	return c.dev.SetObjectPropValue(objHandle, objPropCode, value)
+}
+
+func (c *contextDevice) SendObjectInfo(wantStorageID, wantParent uint32, info *mtp.ObjectInfo) (storageID, parent, handle uint32, err error) {
+	if err := c.err(); err != nil {
+		return 0, 0, 0, err
+	}
+
+	storageID, parent, handle, err = c.dev.SendObjectInfo(wantStorageID, wantParent, info)
+	c.pendingHandle = handle
+
+	return storageID, parent, handle, err
+}
+
+// the object created by SendObjectInfo is deleted if the transfer is canceled
+// if the transfer was aborted in the middle of the object the device may drop the session,
+// the partial object is then left on the device
+func (c *contextDevice) SendObject(r io.Reader, size int64, progressCb mtp.ProgressFunc) error {
+	handle := c.pendingHandle
+	c.pendingHandle = 0
+
+	err := c.err()
+	if err == nil {
+		err = c.dev.SendObject(r, size, func(sent int64) error {
+			if err := c.canceled(); err != nil {
+				return err
+			}
+
+			return progressCb(sent)
+		})
+	}
+
+	if err != nil && c.ctx.Err() != nil && handle != 0 {
+		_ = c.dev.DeleteObject(handle)
+	}
+
+	return err
+}
+
+func (c *contextDevice) GetObject(handle uint32, w io.Writer, progressCb mtp.ProgressFunc) error {
+	if err := c.err(); err != nil {
+		return err
+	}
+
+	if c.wait != nil {
+		opCode, size, err := c.chunkedDownload(handle)
+		if err != nil {
+			return err
+		}
+
+		if opCode != 0 {
+			return c.getObjectChunks(opCode, handle, w, size, progressCb)
+		}
+	}
+
+	return c.dev.GetObject(handle, w, func(sent int64) error {
+		if err := c.canceled(); err != nil {
+			return err
+		}
+
+		return progressCb(sent)
+	})
+}
+
+// find the partial object operation to download the object [handle] in chunks
+// returns 0 if the device does not support partial object downloads or the object fits in a single chunk
+func (c *contextDevice) chunkedDownload(handle uint32) (opCode uint16, size int64, err error) {
+	var info mtp.ObjectInfo
+	if err := c.dev.GetObjectInfo(handle, &info); err != nil {
+		return 0, 0, err
+	}
+
+	if size, err = GetFileSize(c.dev, &info, handle, isObjectADir(&info)); err != nil {
+		return 0, 0, err
+	}
+
+	if size <= pausableChunkSize {
+		return 0, size, nil
+	}
+
+	opCode, err = partialObjectOperation(c.dev, size)
+
+	return opCode, size, err
+}
+
+// download the object [handle] of [size] bytes using a partial object transaction for each chunk
+// the transfer can be paused in between the chunks
+func (c *contextDevice) getObjectChunks(opCode uint16, handle uint32, w io.Writer, size int64, progressCb mtp.ProgressFunc) error {
+	for offset := int64(0); offset < size; offset += pausableChunkSize {
+		if offset > 0 {
+			if err := c.err(); err != nil {
+				return err
+			}
+		}
+
+		length := size - offset
+		if length > pausableChunkSize {
+			length = pausableChunkSize
+		}
+
+		err := getPartialObject(c.dev, opCode, handle, w, offset, length, func(sent int64) error {
+			if err := c.canceled(); err != nil {
+				return err
+			}
+
+			return progressCb(sent)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *contextDevice) DeleteObject(handle uint32) error {
+	if err := c.err(); err != nil {
+		return err
+	}
+
+	return c.dev.DeleteObject(handle)
+}
+
+func (c *contextDevice) RunTransaction(req *mtp.Container, rep *mtp.Container, dest io.Writer, src io.Reader, writeSize int64, progressCb mtp.ProgressFunc) error {
+	if err := c.err(); err != nil {
+		return err
+	}
+
+	return runTransaction(c.dev, req, rep, dest, src, writeSize, func(sent int64) error {
+		if err := c.canceled(); err != nil {
+			return err
+		}
+
+		return progressCb(sent)
+	})
+}
@@ -0,0 +1,185 @@
+package mtpx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestContextCancellation(t *testing.T) {
+	Convey("Cancel | WalkContext", t, func() {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		defer Dispose(dev)
+
+		storages, err := FetchStorages(dev)
+		So(err, ShouldBeNil)
+		sid := storages[0].Sid
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var walked int
+		_, _, _, err = WalkContext(ctx, dev, sid, "/mtp-test-files/mock_dir1", true, true, false,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				walked += 1
+				if walked == 2 {
+					cancel()
+				}
+
+				return nil
+			})
+
+		So(err, ShouldHaveSameTypeAs, CanceledError{})
+		So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		So(walked, ShouldEqual, 2)
+	})
+
+	Convey("Cancel in the middle of a file | DownloadFilesContext", t, func() {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		defer Dispose(dev)
+
+		storages, err := FetchStorages(dev)
+		So(err, ShouldBeNil)
+		sid := storages[0].Sid
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		destination := newTempMocksDir("test_ContextCancellation", true)
+		bulkFilesSent, bulkSizeSent, err := DownloadFilesContext(ctx, dev, sid,
+			[]string{"/mtp-test-files/4mb_txt_file"},
+			destination,
+			false,
+			func(fi *FileInfo, err error) error {
+				return nil
+			},
+			func(fi *ProgressInfo, err error) error {
+				if fi.ActiveFileSize.Sent >= 1<<20 {
+					cancel()
+				}
+
+				return nil
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, CanceledError{})
+		So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		So(bulkFilesSent, ShouldEqual, 1)
+		So(bulkSizeSent, ShouldBeGreaterThanOrEqualTo, 1<<20)
+		So(bulkSizeSent, ShouldBeLessThan, largeTestMockSize)
+
+		// the partially written file is removed
+		So(existsLocal(filepath.Join(destination, "4mb_txt_file")), ShouldBeFalse)
+		So(existsLocal(tempDownloadPath(filepath.Join(destination, "4mb_txt_file"))), ShouldBeFalse)
+	})
+
+	Convey("Expired deadline | DownloadFilesContext", t, func() {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		defer Dispose(dev)
+
+		ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+		defer cancel()
+
+		bulkFilesSent, bulkSizeSent, err := DownloadFilesContext(ctx, dev, 0x10001,
+			[]string{"/mtp-test-files/a.txt"},
+			newTempMocksDir("test_ContextCancellation", true),
+			false,
+			func(fi *FileInfo, err error) error {
+				return nil
+			},
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, CanceledError{})
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		So(bulkFilesSent, ShouldEqual, 0)
+		So(bulkSizeSent, ShouldEqual, 0)
+	})
+
+	Convey("Cancel between files | UploadFilesContext", t, func() {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		defer Dispose(dev)
+
+		storages, err := FetchStorages(dev)
+		So(err, ShouldBeNil)
+		sid := storages[0].Sid
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		destination := "/mtp-test-files/temp_dir/test_ContextCancellation"
+		err = DeleteFile(dev, sid, []FileProp{{0, destination}})
+		So(err, ShouldBeNil)
+
+		// the files are sent in the order: '1/a.txt' (8 bytes), '2/b.txt' (6 bytes), ...
+		// the upload is canceled once the data of '2/b.txt' was sent, before it is renamed into place
+		_, bulkFilesSent, bulkSizeSent, err := UploadFilesContext(ctx, dev, sid,
+			[]string{getTestMocksAsset("mock_dir1")},
+			destination,
+			false,
+			func(fi *os.FileInfo, fullPath string, err error) error {
+				return nil
+			},
+			func(fi *ProgressInfo, err error) error {
+				if fi.FilesSent == 1 && fi.ActiveFileSize.Sent == fi.ActiveFileSize.Total {
+					cancel()
+				}
+
+				return nil
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, CanceledError{})
+		So(bulkFilesSent, ShouldEqual, 2)
+		So(bulkSizeSent, ShouldEqual, 14)
+
+		fc, err := FileExists(dev, sid, []FileProp{
+			{0, destination + "/mock_dir1/1/a.txt"},
+			{0, destination + "/mock_dir1/2/b.txt"},
+		})
+		So(err, ShouldBeNil)
+		So(fc[0].Exists, ShouldBeTrue)
+		So(fc[1].Exists, ShouldBeFalse)
+	})
+
+	Convey("Cancel before the object data is sent | contextDevice", t, func() {
+		sim := mtpxtest.New()
+		sid := sim.AddStorage("Internal shared storage", 1<<20)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		dev := newContextDevice(ctx, sim)
+
+		data := []byte("0123456789")
+		_, _, objectId, err := dev.SendObjectInfo(sid, mtp.GOH_ROOT_PARENT, &mtp.ObjectInfo{
+			Filename:       "a.txt",
+			CompressedSize: uint32(len(data)),
+		})
+		So(err, ShouldBeNil)
+
+		cancel()
+
+		err = dev.SendObject(bytes.NewReader(data), int64(len(data)), mtp.EmptyProgressFunc)
+		So(err, ShouldHaveSameTypeAs, CanceledError{})
+
+		// the object created by SendObjectInfo is deleted
+		var info mtp.ObjectInfo
+		So(sim.GetObjectInfo(objectId, &info), ShouldEqual, mtp.RCError(mtp.RC_InvalidObjectHandle))
+	})
+}
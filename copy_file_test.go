@@ -0,0 +1,159 @@
+package mtpx
+
+import (
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestCopyFile(t *testing.T) {
+	if isUsbTestDevice() {
+		t.Skip("the copy tests require the simulated device")
+	}
+
+	const destination = "/mtp-test-files/temp_dir/test_CopyFile"
+	const source = "/mtp-test-files/mock_dir1"
+
+	newCopyTestDevice := func(canCopy bool) (*mtpxtest.Device, uint32, uint32) {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		sim := dev.(*mtpxtest.Device)
+		if !canCopy {
+			removeOperation(sim, mtp.OC_CopyObject)
+		}
+
+		storages, err := FetchStorages(sim)
+		So(err, ShouldBeNil)
+
+		return sim, storages[0].Sid, storages[1].Sid
+	}
+
+	// the files of [source] along with their total size
+	sourceTotals := func(dev Device, sid uint32) (totalFiles, totalSize int64) {
+		_, totalFiles, _, err := Walk(dev, sid, source, true, false, false, func(objectId uint32, fi *FileInfo, err error) error {
+			totalSize += fi.Size
+
+			return nil
+		})
+		So(err, ShouldBeNil)
+
+		return totalFiles, totalSize
+	}
+
+	// the copy matches the source
+	shouldMatchSource := func(sim *mtpxtest.Device, sid, copySid uint32, copyPath string) {
+		for _, name := range []string{"a.txt", "1/a.txt", "3/2/b.txt"} {
+			data, err := sim.ReadFile(copySid, copyPath+"/"+name)
+			So(err, ShouldBeNil)
+			So(data, ShouldResemble, readTestMocksAsset("mock_dir1/"+name))
+
+			_, ok := sim.Lookup(sid, source+"/"+name)
+			So(ok, ShouldBeTrue)
+		}
+	}
+
+	Convey("Copy a directory to another storage | CopyFileToStorage", t, func() {
+		sim, sid, sdCardSid := newCopyTestDevice(true)
+		totalFiles, totalSize := sourceTotals(sim, sid)
+
+		var progress []ProgressInfo
+		objectId, bulkFilesSent, bulkSizeSent, err := CopyFileToStorage(sim, sid, FileProp{0, source}, sdCardSid, destination,
+			func(fi *ProgressInfo, err error) error {
+				progress = append(progress, *fi)
+
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, totalFiles)
+		So(bulkSizeSent, ShouldEqual, totalSize)
+
+		copied, err := GetObjectFromPath(sim, sdCardSid, destination+"/mock_dir1")
+		So(err, ShouldBeNil)
+		So(copied.ObjectId, ShouldEqual, objectId)
+
+		// the device copied the tree at once
+		So(progress, ShouldHaveLength, 1)
+		So(progress[0].Status, ShouldEqual, Completed)
+		So(progress[0].FilesSent, ShouldEqual, totalFiles)
+		So(progress[0].FileInfo.FullPath, ShouldEqual, destination+"/mock_dir1")
+
+		shouldMatchSource(sim, sid, sdCardSid, destination+"/mock_dir1")
+	})
+
+	Convey("Copy the files if the device cannot copy objects | CopyFile", t, func() {
+		sim, sid, _ := newCopyTestDevice(false)
+		totalFiles, totalSize := sourceTotals(sim, sid)
+
+		var lastInfo ProgressInfo
+		var calls int
+		objectId, bulkFilesSent, bulkSizeSent, err := CopyFile(sim, sid, FileProp{0, source}, destination,
+			func(fi *ProgressInfo, err error) error {
+				calls += 1
+				lastInfo = *fi
+
+				So(fi.TotalFiles, ShouldEqual, totalFiles)
+				So(fi.BulkFileSize.Total, ShouldEqual, totalSize)
+				So(fi.FileInfo.FullPath, ShouldStartWith, destination+"/mock_dir1/")
+
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, totalFiles)
+		So(bulkSizeSent, ShouldEqual, totalSize)
+		So(calls, ShouldBeGreaterThan, totalFiles)
+		So(lastInfo.Status, ShouldEqual, Completed)
+		So(lastInfo.FilesSent, ShouldEqual, totalFiles)
+		So(lastInfo.BulkFileSize.Sent, ShouldEqual, totalSize)
+
+		copied, err := GetObjectFromPath(sim, sid, destination+"/mock_dir1")
+		So(err, ShouldBeNil)
+		So(copied.ObjectId, ShouldEqual, objectId)
+
+		sourceFile, err := GetObjectFromPath(sim, sid, source+"/3/2/b.txt")
+		So(err, ShouldBeNil)
+		copiedFile, err := GetObjectFromPath(sim, sid, destination+"/mock_dir1/3/2/b.txt")
+		So(err, ShouldBeNil)
+		So(copiedFile.ObjectId, ShouldNotEqual, sourceFile.ObjectId)
+		So(copiedFile.ModTime.Format(mtpDateFormat), ShouldEqual, sourceFile.ModTime.Format(mtpDateFormat))
+
+		shouldMatchSource(sim, sid, sid, destination+"/mock_dir1")
+	})
+
+	Convey("Delete the partial copy if the copy fails | CopyFile", t, func() {
+		sim, sid, _ := newCopyTestDevice(false)
+		dev := mtpxtest.NewFaultInjector(sim, mtpxtest.Fault{
+			Op:  mtpxtest.OpSendObject,
+			Nth: 2,
+			Err: mtp.RCError(mtp.RC_StoreFull),
+		})
+
+		_, bulkFilesSent, _, err := CopyFile(dev, sid, FileProp{0, source}, destination, func(fi *ProgressInfo, err error) error {
+			return nil
+		})
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+		So(bulkFilesSent, ShouldEqual, 1)
+
+		_, ok := sim.Lookup(sid, destination+"/mock_dir1")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Invalid copies | CopyFile", t, func() {
+		sim, sid, _ := newCopyTestDevice(true)
+		noProgress := func(fi *ProgressInfo, err error) error {
+			return nil
+		}
+
+		_, _, _, err := CopyFile(sim, sid, FileProp{0, source}, source+"/3", noProgress)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		_, _, _, err = CopyFile(sim, sid, FileProp{0, source + "/a.txt"}, source, noProgress)
+		So(err, ShouldHaveSameTypeAs, FileConflictError{})
+
+		_, _, _, err = CopyFile(sim, sid, FileProp{0, "/mtp-test-files/fake"}, destination, noProgress)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+}
@@ -9,7 +9,7 @@ import (
 )
 
 func TestDeleteFile(t *testing.T) {
-	dev, err := Initialize(Init{})
+	dev, err := initTestDevice()
 	if err != nil {
 		log.Panic(err)
 	}
@@ -0,0 +1,123 @@
+package mtpx
+
+import (
+	"bytes"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ Device = (*mtp.Device)(nil)
+var _ Device = (*mtpxtest.Device)(nil)
+var _ transactionRunner = (*mtp.Device)(nil)
+var _ transactionRunner = (*mtpxtest.Device)(nil)
+
+// size of the large mock files ('4mb_txt_file' and '4mb_txt_file_2')
+const largeTestMockSize = 4194304
+
+// 'mock_dir1' contains 5 files
+const mockDir1TotalFiles = 5
+
+// returns true if the test suites should run against a connected phone
+// set the environment variable MTPX_TEST_DEVICE=usb to enable it
+func isUsbTestDevice() bool {
+	return os.Getenv("MTPX_TEST_DEVICE") == "usb"
+}
+
+// initialize the device used by the test suites
+// by default a simulated device with the 'mtp-test-files' copied to the root of the first storage is returned
+func initTestDevice() (Device, error) {
+	if isUsbTestDevice() {
+		dev, err := Initialize(Init{})
+		if err != nil {
+			return nil, err
+		}
+
+		return dev, nil
+	}
+
+	if err := makeLargeTestMocksAssets(); err != nil {
+		return nil, err
+	}
+
+	dev := mtpxtest.New()
+	sid := dev.AddStorage("Internal shared storage", 64<<30)
+	dev.AddStorage("SD card", 32<<30)
+
+	if err := dev.ImportLocal(sid, getTestMocksAsset(""), PathSep); err != nil {
+		return nil, err
+	}
+
+	return dev, nil
+}
+
+// the large mock files are not checked in, create them if they are missing
+func makeLargeTestMocksAssets() error {
+	for _, name := range []string{"4mb_txt_file", "4mb_txt_file_2"} {
+		fullPath := filepath.Join(newTestMocksAsset(""), name)
+		if existsLocal(fullPath) {
+			continue
+		}
+
+		data := bytes.Repeat([]byte("mtpx\n"), largeTestMockSize/5+1)[:largeTestMockSize]
+		if err := ioutil.WriteFile(fullPath, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// upload 'mock_dir1' to [destination] using [options]
+// [progressCb] is optional, it is called once the progress is recorded
+// return:
+// [lastInfo]: the latest progress
+func uploadTestMockDir1(dev Device, sid uint32, destination string, options UploadOptions, progressCb ProgressCb) (lastInfo ProgressInfo, bulkFilesSent int64, report *TransferReport, err error) {
+	_, bulkFilesSent, _, report, err = UploadFilesWithOptions(dev, sid,
+		[]string{getTestMocksAsset("mock_dir1")},
+		destination,
+		false,
+		options,
+		func(fi *os.FileInfo, fullPath string, err error) error {
+			return nil
+		},
+		func(fi *ProgressInfo, err error) error {
+			lastInfo = *fi
+			if progressCb == nil {
+				return nil
+			}
+
+			return progressCb(fi, err)
+		},
+	)
+
+	return lastInfo, bulkFilesSent, report, err
+}
+
+// download '/mtp-test-files/mock_dir1' to the local [destination] using [options]
+// [progressCb] is optional, it is called once the progress is recorded
+// return:
+// [lastInfo]: the latest progress
+func downloadTestMockDir1(dev Device, sid uint32, destination string, options DownloadOptions, progressCb ProgressCb) (lastInfo ProgressInfo, bulkFilesSent int64, report *TransferReport, err error) {
+	bulkFilesSent, _, report, err = DownloadFilesWithOptions(dev, sid,
+		[]string{"/mtp-test-files/mock_dir1"},
+		destination,
+		false,
+		options,
+		func(fi *FileInfo, err error) error {
+			return nil
+		},
+		func(fi *ProgressInfo, err error) error {
+			lastInfo = *fi
+			if progressCb == nil {
+				return nil
+			}
+
+			return progressCb(fi, err)
+		},
+	)
+
+	return lastInfo, bulkFilesSent, report, err
+}
@@ -0,0 +1,109 @@
+package mtpx
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadConflicts(t *testing.T) {
+	dev, err := initTestDevice()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer Dispose(dev)
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sid := storages[0].Sid
+
+	newDownloadConflictTestDir := func() string {
+		destination := newTempMocksDir("test_DownloadConflicts", true)
+
+		_, bulkFilesSent, _, err := downloadTestMockDir1(dev, sid, destination, DownloadOptions{}, nil)
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, mockDir1TotalFiles)
+
+		return destination
+	}
+
+	Convey("Skip the existing files | DownloadFilesWithOptions", t, func() {
+		destination := newDownloadConflictTestDir()
+
+		lastInfo, bulkFilesSent, _, err := downloadTestMockDir1(dev, sid, destination, DownloadOptions{ConflictPolicy: ConflictSkip}, nil)
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, 0)
+		So(lastInfo.FilesSkipped, ShouldEqual, mockDir1TotalFiles)
+		So(lastInfo.Status, ShouldEqual, Completed)
+	})
+
+	Convey("Skip the identical files | DownloadFilesWithOptions", t, func() {
+		destination := newDownloadConflictTestDir()
+
+		// a.txt was changed locally
+		localFile := filepath.Join(destination, "mock_dir1", "a.txt")
+		err := ioutil.WriteFile(localFile, []byte("changed locally"), 0644)
+		So(err, ShouldBeNil)
+
+		lastInfo, bulkFilesSent, _, err := downloadTestMockDir1(dev, sid, destination, DownloadOptions{ConflictPolicy: ConflictSkipIdentical}, nil)
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, 1)
+		So(lastInfo.FilesSkipped, ShouldEqual, mockDir1TotalFiles-1)
+
+		data, err := ioutil.ReadFile(localFile)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldNotEqual, "changed locally")
+	})
+
+	Convey("Rename the downloaded files | DownloadFilesWithOptions", t, func() {
+		destination := newDownloadConflictTestDir()
+
+		for i := 0; i < 2; i++ {
+			lastInfo, bulkFilesSent, _, err := downloadTestMockDir1(dev, sid, destination, DownloadOptions{ConflictPolicy: ConflictRename}, nil)
+			So(err, ShouldBeNil)
+			So(bulkFilesSent, ShouldEqual, mockDir1TotalFiles)
+			So(lastInfo.FilesRenamed, ShouldEqual, mockDir1TotalFiles)
+		}
+
+		for _, name := range []string{"a.txt", "a (1).txt", "a (2).txt", "3/2/b (2).txt"} {
+			So(existsLocal(filepath.Join(destination, "mock_dir1", name)), ShouldBeTrue)
+		}
+	})
+
+	Convey("Fail on the first conflict | DownloadFilesWithOptions", t, func() {
+		destination := newDownloadConflictTestDir()
+
+		_, bulkFilesSent, _, err := downloadTestMockDir1(dev, sid, destination, DownloadOptions{ConflictPolicy: ConflictFail}, nil)
+		So(err, ShouldHaveSameTypeAs, FileConflictError{})
+		So(bulkFilesSent, ShouldEqual, 0)
+	})
+
+	Convey("Ask for every conflict | DownloadFilesWithOptions", t, func() {
+		destination := newDownloadConflictTestDir()
+
+		var conflicts []ConflictInfo
+		lastInfo, bulkFilesSent, _, err := downloadTestMockDir1(dev, sid, destination, DownloadOptions{
+			ConflictPolicy: ConflictAsk,
+			ConflictCb: func(c *ConflictInfo) (ConflictPolicy, error) {
+				conflicts = append(conflicts, *c)
+
+				if c.SourcePath == "/mtp-test-files/mock_dir1/a.txt" {
+					return ConflictRename, nil
+				}
+
+				return ConflictSkip, nil
+			},
+		}, nil)
+		So(err, ShouldBeNil)
+		So(len(conflicts), ShouldEqual, mockDir1TotalFiles)
+		So(bulkFilesSent, ShouldEqual, 1)
+		So(lastInfo.FilesSkipped, ShouldEqual, mockDir1TotalFiles-1)
+		So(lastInfo.FilesRenamed, ShouldEqual, 1)
+		So(existsLocal(filepath.Join(destination, "mock_dir1", "a (1).txt")), ShouldBeTrue)
+	})
+}
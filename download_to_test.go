@@ -0,0 +1,110 @@
+package mtpx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"testing"
+)
+
+// a writer which fails once [limit] bytes were written
+type failingWriter struct {
+	limit int
+	n     int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if f.n+len(p) > f.limit {
+		return 0, errors.New("the writer is full")
+	}
+
+	f.n += len(p)
+
+	return len(p), nil
+}
+
+func TestDownloadTo(t *testing.T) {
+	Convey("Download a file into a hash | DownloadTo", t, func() {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		defer Dispose(dev)
+
+		storages, err := FetchStorages(dev)
+		So(err, ShouldBeNil)
+		sid := storages[0].Sid
+
+		expected, err := ioutil.ReadFile(getTestMocksAsset("4mb_txt_file"))
+		So(err, ShouldBeNil)
+
+		var lastTotal, lastSent int64
+		h := sha256.New()
+		written, err := DownloadTo(dev, sid, FileProp{0, "/mtp-test-files/4mb_txt_file"}, h,
+			func(total, sent int64, objectId uint32, err error) error {
+				lastTotal = total
+				lastSent = sent
+
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+		So(written, ShouldEqual, largeTestMockSize)
+		So(lastTotal, ShouldEqual, largeTestMockSize)
+		So(lastSent, ShouldEqual, largeTestMockSize)
+
+		sum := sha256.Sum256(expected)
+		So(h.Sum(nil), ShouldResemble, sum[:])
+	})
+
+	Convey("Download a file using the objectId | DownloadTo", t, func() {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		defer Dispose(dev)
+
+		storages, err := FetchStorages(dev)
+		So(err, ShouldBeNil)
+		sid := storages[0].Sid
+
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+
+		var buf bytes.Buffer
+		written, err := DownloadTo(dev, sid, FileProp{ObjectId: fi.ObjectId}, &buf,
+			func(total, sent int64, objectId uint32, err error) error {
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+		So(written, ShouldEqual, fi.Size)
+		So(buf.Len(), ShouldEqual, fi.Size)
+
+		_, err = DownloadTo(dev, sid, FileProp{0, "/mtp-test-files/mock_dir1"}, &buf,
+			func(total, sent int64, objectId uint32, err error) error {
+				return nil
+			},
+		)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Convey("The writer fails | DownloadTo", t, func() {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		defer Dispose(dev)
+
+		storages, err := FetchStorages(dev)
+		So(err, ShouldBeNil)
+		sid := storages[0].Sid
+
+		written, err := DownloadTo(dev, sid, FileProp{0, "/mtp-test-files/4mb_txt_file"}, &failingWriter{limit: 1 << 20},
+			func(total, sent int64, objectId uint32, err error) error {
+				return nil
+			},
+		)
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+		So(written, ShouldBeLessThanOrEqualTo, 1<<20)
+	})
+}
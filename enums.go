@@ -4,5 +4,59 @@ type TransferStatus string
 
 const (
 	InProgress TransferStatus = "InProgress"
+	Paused     TransferStatus = "Paused"
 	Completed  TransferStatus = "Completed"
+	Canceled   TransferStatus = "Canceled"
+	Failed     TransferStatus = "Failed"
+)
+
+type WatchEventType string
+
+const (
+	DeviceAttached    WatchEventType = "DeviceAttached"
+	DeviceDetached    WatchEventType = "DeviceDetached"
+	StoragesAvailable WatchEventType = "StoragesAvailable"
+	WatchFailed       WatchEventType = "WatchFailed"
+)
+
+// ConflictPolicy - what to do when the destination of a file already Exists
+// the zero value overwrites the existing file
+type ConflictPolicy string
+
+const (
+	ConflictOverwrite ConflictPolicy = "Overwrite"
+	ConflictSkip      ConflictPolicy = "Skip"
+
+	// skip if the size and the modification time of both the files match, overwrite otherwise
+	ConflictSkipIdentical ConflictPolicy = "SkipIdentical"
+
+	// transfer the file using the first available name in the form: "photo (1).jpg"
+	ConflictRename ConflictPolicy = "Rename"
+
+	// abort the transfer with a [FileConflictError]
+	ConflictFail ConflictPolicy = "Fail"
+
+	// ask the [ConflictCb] for every conflict
+	ConflictAsk ConflictPolicy = "Ask"
+)
+
+type TransferKind string
+
+const (
+	UploadTransfer   TransferKind = "Upload"
+	DownloadTransfer TransferKind = "Download"
+)
+
+// VerifyMode - how a transferred file is verified
+// the zero value does not verify the files
+type VerifyMode string
+
+const (
+	VerifyNone VerifyMode = ""
+
+	// compare the size of the device object with the size of the local file
+	VerifySize VerifyMode = "Size"
+
+	// [VerifySize] and compare the SHA-256 checksum of the device object, read back from the device, with the checksum of the local file
+	VerifyChecksum VerifyMode = "Checksum"
 )
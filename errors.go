@@ -51,3 +51,104 @@ type FileObjectError struct {
 type SendObjectError struct {
 	error
 }
+
+type DeviceDisconnectedError struct {
+	error
+}
+
+type CanceledError struct {
+	error
+}
+
+type FileSizeMismatchError struct {
+	error
+}
+
+type FileVerificationError struct {
+	error
+}
+
+type PartialReadNotSupportedError struct {
+	error
+}
+
+type FileConflictError struct {
+	error
+}
+
+// the causes of the errors can be inspected using errors.Is and errors.As
+func (e MtpDetectFailedError) Unwrap() error {
+	return e.error
+}
+
+func (e ConfigureError) Unwrap() error {
+	return e.error
+}
+
+func (e DeviceInfoError) Unwrap() error {
+	return e.error
+}
+
+func (e StorageInfoError) Unwrap() error {
+	return e.error
+}
+
+func (e NoStorageError) Unwrap() error {
+	return e.error
+}
+
+func (e ListDirectoryError) Unwrap() error {
+	return e.error
+}
+
+func (e FileNotFoundError) Unwrap() error {
+	return e.error
+}
+
+func (e FilePermissionError) Unwrap() error {
+	return e.error
+}
+
+func (e LocalFileError) Unwrap() error {
+	return e.error
+}
+
+func (e InvalidPathError) Unwrap() error {
+	return e.error
+}
+
+func (e FileTransferError) Unwrap() error {
+	return e.error
+}
+
+func (e FileObjectError) Unwrap() error {
+	return e.error
+}
+
+func (e SendObjectError) Unwrap() error {
+	return e.error
+}
+
+func (e DeviceDisconnectedError) Unwrap() error {
+	return e.error
+}
+
+func (e CanceledError) Unwrap() error {
+	return e.error
+}
+
+func (e FileSizeMismatchError) Unwrap() error {
+	return e.error
+}
+
+func (e FileVerificationError) Unwrap() error {
+	return e.error
+}
+
+func (e PartialReadNotSupportedError) Unwrap() error {
+	return e.error
+}
+
+func (e FileConflictError) Unwrap() error {
+	return e.error
+}
@@ -0,0 +1,376 @@
+package mtpx
+
+import (
+	"bytes"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func newFaultInjectorTestDevice(faults ...mtpxtest.Fault) (*mtpxtest.FaultInjector, uint32) {
+	dev, err := initTestDevice()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return mtpxtest.NewFaultInjector(dev.(*mtpxtest.Device), faults...), storages[0].Sid
+}
+
+func TestFaultInjection(t *testing.T) {
+	if isUsbTestDevice() {
+		t.Skip("fault injection requires the simulated device")
+	}
+
+	Convey("SendObject fails | UploadFiles | should throw an error", t, func() {
+		dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:  mtpxtest.OpSendObject,
+			Nth: 2,
+			Err: mtp.RCError(mtp.RC_StoreFull),
+		})
+
+		// the files are sent in the order: '1/a.txt' (8 bytes), '2/b.txt' (6 bytes), ...
+		_, bulkFilesSent, bulkSizeSent, err := UploadFiles(dev, sid,
+			[]string{getTestMocksAsset("mock_dir1")},
+			"/mtp-test-files/temp_dir/test_FaultInjection",
+			false,
+			func(fi *os.FileInfo, fullPath string, err error) error {
+				return nil
+			},
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+		So(bulkFilesSent, ShouldEqual, 2)
+		So(bulkSizeSent, ShouldEqual, 8)
+		So(dev.Calls(mtpxtest.OpSendObject), ShouldEqual, 2)
+
+		// the object of the failed file is deleted
+		So(dev.Calls(mtpxtest.OpDeleteObject), ShouldEqual, 1)
+	})
+
+	Convey("Truncated SendObject stream | UploadStream | should delete the partial object", t, func() {
+		const truncateAt = 1 << 20
+
+		dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:         mtpxtest.OpSendObject,
+			Truncate:   true,
+			TruncateAt: truncateAt,
+		})
+
+		data := bytes.Repeat([]byte("x"), 4*truncateAt)
+		objectId, err := UploadStream(dev, sid, FileProp{0, "/mtp-test-files/temp_dir/test_FaultInjection"}, "partial.txt",
+			bytes.NewReader(data), int64(len(data)), time.Now(),
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+		So(objectId, ShouldEqual, 0)
+
+		fc, err := FileExists(dev, sid, []FileProp{{0, "/mtp-test-files/temp_dir/test_FaultInjection/partial.txt"}})
+		So(err, ShouldBeNil)
+		So(fc[0].Exists, ShouldBeFalse)
+	})
+
+	Convey("Dropped connection in the middle of SendObject | UploadStream | should keep the existing file", t, func() {
+		const truncateAt = 1 << 20
+		const destination = "/mtp-test-files/temp_dir/test_FaultInjection"
+
+		sim, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		storages, err := FetchStorages(sim)
+		So(err, ShouldBeNil)
+		sid := storages[0].Sid
+
+		sd := sim.(*mtpxtest.Device)
+		dev := mtpxtest.NewFaultInjector(sd)
+		upload := func(name string, data []byte) error {
+			_, err := UploadStream(dev, sid, FileProp{0, destination}, name, bytes.NewReader(data), int64(len(data)), time.Now(),
+				func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+			)
+
+			return err
+		}
+
+		original := []byte("original")
+		So(upload("existing.txt", original), ShouldBeNil)
+
+		// the session is gone before the object could be deleted
+		dev.Inject(mtpxtest.Fault{
+			Op:         mtpxtest.OpSendObject,
+			Truncate:   true,
+			TruncateAt: truncateAt,
+			Disconnect: true,
+		})
+
+		data := bytes.Repeat([]byte("x"), 4*truncateAt)
+		So(upload("existing.txt", data), ShouldHaveSameTypeAs, FileTransferError{})
+
+		// the existing file survives the failed overwrite
+		fileData, err := sd.ReadFile(sid, destination+"/existing.txt")
+		So(err, ShouldBeNil)
+		So(fileData, ShouldResemble, original)
+
+		// the partial object is left only under its temporary name
+		_, ok := sd.Lookup(sid, destination+"/"+tempUploadFilename("existing.txt"))
+		So(ok, ShouldBeTrue)
+
+		dev.Reset()
+		dev.Inject(mtpxtest.Fault{
+			Op:         mtpxtest.OpSendObject,
+			Truncate:   true,
+			TruncateAt: truncateAt,
+			Disconnect: true,
+		})
+
+		So(upload("new.txt", data), ShouldHaveSameTypeAs, FileTransferError{})
+
+		_, ok = sd.Lookup(sid, destination+"/new.txt")
+		So(ok, ShouldBeFalse)
+
+		// the next attempt replaces the partial object
+		dev.Reset()
+		So(upload("existing.txt", data), ShouldBeNil)
+
+		fileData, err = sd.ReadFile(sid, destination+"/existing.txt")
+		So(err, ShouldBeNil)
+		So(fileData, ShouldResemble, data)
+
+		_, ok = sd.Lookup(sid, destination+"/"+tempUploadFilename("existing.txt"))
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Rename fails while replacing a file | UploadStream | should restore the existing file", t, func() {
+		const destination = "/mtp-test-files/temp_dir/test_FaultInjection"
+
+		sim, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		storages, err := FetchStorages(sim)
+		So(err, ShouldBeNil)
+		sid := storages[0].Sid
+
+		sd := sim.(*mtpxtest.Device)
+		dev := mtpxtest.NewFaultInjector(sd)
+		upload := func(name string, data []byte) error {
+			_, err := UploadStream(dev, sid, FileProp{0, destination}, name, bytes.NewReader(data), int64(len(data)), time.Now(),
+				func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+			)
+
+			return err
+		}
+
+		original := []byte("original")
+		So(upload("replaced.txt", original), ShouldBeNil)
+
+		// the existing file is renamed aside first, renaming the new object into place fails
+		dev.Inject(mtpxtest.Fault{
+			Op:  mtpxtest.OpSetObjectPropValue,
+			Nth: dev.Calls(mtpxtest.OpSetObjectPropValue) + 2,
+			Err: mtp.RCError(mtp.RC_GeneralError),
+		})
+
+		err = upload("replaced.txt", []byte("replacement"))
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+
+		fileData, err := sd.ReadFile(sid, destination+"/replaced.txt")
+		So(err, ShouldBeNil)
+		So(fileData, ShouldResemble, original)
+
+		_, ok := sd.Lookup(sid, destination+"/"+tempUploadFilename("replaced.txt"))
+		So(ok, ShouldBeFalse)
+
+		_, ok = sd.Lookup(sid, destination+"/"+replacedUploadFilename("replaced.txt"))
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("The device cannot rename the objects | UploadStream | should send the files directly", t, func() {
+		const destination = "/mtp-test-files/temp_dir/test_FaultInjection"
+
+		sim, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		storages, err := FetchStorages(sim)
+		So(err, ShouldBeNil)
+		sid := storages[0].Sid
+
+		sd := sim.(*mtpxtest.Device)
+		dev := mtpxtest.NewFaultInjector(sd)
+		removeOperation(sd, mtp.OC_MTP_SetObjectPropValue)
+
+		upload := func(name string, data []byte) error {
+			_, err := UploadStream(dev, sid, FileProp{0, destination}, name, bytes.NewReader(data), int64(len(data)), time.Now(),
+				func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+			)
+
+			return err
+		}
+
+		So(upload("direct.txt", []byte("original")), ShouldBeNil)
+		So(upload("direct.txt", []byte("replacement")), ShouldBeNil)
+		So(dev.Calls(mtpxtest.OpSetObjectPropValue), ShouldEqual, 0)
+
+		fileData, err := sd.ReadFile(sid, destination+"/direct.txt")
+		So(err, ShouldBeNil)
+		So(fileData, ShouldResemble, []byte("replacement"))
+
+		// the partial object of a failed transfer is deleted
+		dev.Inject(mtpxtest.Fault{
+			Op:  mtpxtest.OpSendObject,
+			Err: mtp.RCError(mtp.RC_GeneralError),
+		})
+
+		So(upload("failed.txt", []byte("data")), ShouldHaveSameTypeAs, FileTransferError{})
+
+		_, ok := sd.Lookup(sid, destination+"/failed.txt")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Truncated GetObject stream | DownloadFiles | should throw an error", t, func() {
+		const truncateAt = 1 << 20
+
+		dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:         mtpxtest.OpGetObject,
+			Truncate:   true,
+			TruncateAt: truncateAt,
+		})
+
+		destination := newTempMocksDir("test_FaultInjection", true)
+		bulkFilesSent, bulkSizeSent, err := DownloadFiles(dev, sid,
+			[]string{"/mtp-test-files/4mb_txt_file"},
+			destination,
+			false,
+			func(fi *FileInfo, err error) error {
+				return nil
+			},
+			func(fi *ProgressInfo, err error) error {
+				So(fi.ActiveFileSize.Sent, ShouldBeLessThanOrEqualTo, truncateAt)
+
+				return nil
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+		So(bulkFilesSent, ShouldEqual, 1)
+		So(bulkSizeSent, ShouldEqual, truncateAt)
+	})
+
+	Convey("Local write fails | DownloadFiles | should throw an error", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		bulkFilesSent, bulkSizeSent, err := DownloadFiles(dev, sid,
+			[]string{"/mtp-test-files/a.txt"},
+			"/dev/null/mtpx",
+			false,
+			func(fi *FileInfo, err error) error {
+				return nil
+			},
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+
+		So(err, ShouldHaveSameTypeAs, LocalFileError{})
+		So(bulkFilesSent, ShouldEqual, 1)
+		So(bulkSizeSent, ShouldEqual, 0)
+	})
+
+	Convey("Invalid object handle | FileExists", t, func() {
+		dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:  mtpxtest.OpGetObjectInfo,
+			Err: mtp.RCError(mtp.RC_InvalidObjectHandle),
+		})
+
+		fc, err := FileExists(dev, sid, []FileProp{{0, "/mtp-test-files/a.txt"}})
+
+		So(err, ShouldBeNil)
+		So(len(fc), ShouldEqual, 1)
+		So(fc[0].Exists, ShouldBeFalse)
+	})
+
+	Convey("Rename returns a general error | RenameFile | should throw an error", t, func() {
+		dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:  mtpxtest.OpSetObjectPropValue,
+			Err: mtp.RCError(mtp.RC_GeneralError),
+		})
+
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+
+		objectId, err := RenameFile(dev, sid, FileProp{0, "/mtp-test-files/a.txt"}, "b.txt")
+
+		So(err, ShouldHaveSameTypeAs, FileObjectError{})
+		So(err.(FileObjectError).error, ShouldEqual, mtp.RCError(mtp.RC_GeneralError))
+		So(objectId, ShouldEqual, 0)
+
+		// the object keeps its name
+		fc, err := FileExists(dev, sid, []FileProp{{0, "/mtp-test-files/a.txt"}})
+		So(err, ShouldBeNil)
+		So(fc[0].Exists, ShouldBeTrue)
+
+		// renaming to the current name does not reach the device
+		objectId, err = RenameFile(dev, sid, FileProp{0, "/mtp-test-files/a.txt"}, "a.txt")
+		So(err, ShouldBeNil)
+		So(objectId, ShouldEqual, fi.ObjectId)
+
+		// the names are compared case insensitively
+		objectId, err = RenameFile(dev, sid, FileProp{0, "/mtp-test-files/a.txt"}, "A.txt")
+		So(err, ShouldBeNil)
+		So(objectId, ShouldEqual, fi.ObjectId)
+	})
+
+	Convey("Dropped connection | Walk | should throw an error", t, func() {
+		dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:         mtpxtest.OpGetObjectHandles,
+			Nth:        5,
+			Disconnect: true,
+		})
+
+		_, _, _, err := Walk(dev, sid, "/mtp-test-files", true, true, false,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				return nil
+			})
+
+		So(err, ShouldHaveSameTypeAs, ListDirectoryError{})
+		So(err.(ListDirectoryError).error, ShouldEqual, mtpxtest.ErrDisconnected)
+
+		_, err = FetchStorages(dev)
+		So(err, ShouldHaveSameTypeAs, StorageInfoError{})
+	})
+
+	Convey("Stalled operation | FetchStorages", t, func() {
+		const delay = 50 * time.Millisecond
+
+		dev, _ := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:    mtpxtest.OpGetStorageInfo,
+			Nth:   1,
+			Delay: delay,
+		})
+
+		start := time.Now()
+		storages, err := FetchStorages(dev)
+
+		So(err, ShouldBeNil)
+		So(len(storages), ShouldEqual, 2)
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, delay)
+	})
+}
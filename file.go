@@ -0,0 +1,200 @@
+package mtpx
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"io"
+	"os"
+	"sync"
+)
+
+// File - a file on the device opened for random access reads
+// it implements io.ReadSeeker, io.ReaderAt and io.Closer
+// the reads are served using partial object transfers, so only the requested ranges travel over usb
+// use [OpenFile] to open one
+type File struct {
+	dev    Device
+	fi     *FileInfo
+	opCode uint16
+
+	mu     sync.Mutex
+	offset int64
+	closed bool
+
+	// read-ahead buffer holding the object data starting at [bufOffset]
+	buf       []byte
+	bufOffset int64
+}
+
+// OpenFile - open a file on the device for reading
+// [fileProp] accepts either the objectId or the fullPath of the file, like [FileExists]
+// returns a [PartialReadNotSupportedError] if the device does not support partial object transfers
+// the device is not closed by [File.Close]
+func OpenFile(dev Device, storageId uint32, fileProp FileProp) (*File, error) {
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, fileProp)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.IsDir {
+		return nil, InvalidPathError{error: fmt.Errorf("the object %d is a directory", fi.ObjectId)}
+	}
+
+	opCode, err := partialObjectOperation(dev, fi.Size)
+	if err != nil {
+		return nil, DeviceInfoError{error: err}
+	}
+
+	if opCode == 0 {
+		return nil, PartialReadNotSupportedError{
+			error: fmt.Errorf("the device does not support partial reads of an object of %d bytes", fi.Size),
+		}
+	}
+
+	return &File{dev: dev, fi: fi, opCode: opCode}, nil
+}
+
+// FileInfo - the object which was opened
+func (f *File) FileInfo() *FileInfo {
+	return f.fi
+}
+
+// Size - size of the file in bytes
+func (f *File) Size() int64 {
+	return f.fi.Size
+}
+
+// Read - read from the current offset
+func (f *File) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err := f.readAt(p, f.offset)
+	f.offset += int64(n)
+
+	// a short read before the end of the file is not an error for Read
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+
+	return n, err
+}
+
+// ReadAt - read len(p) bytes starting at [off]
+// the current offset is not changed
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.readAt(p, off)
+}
+
+// Seek - set the offset for the next Read
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+
+	case io.SeekEnd:
+		offset += f.fi.Size
+
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset: %d", offset)
+	}
+
+	f.offset = offset
+
+	return offset, nil
+}
+
+// Close - release the read-ahead buffer
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+
+	f.closed = true
+	f.buf = nil
+
+	return nil
+}
+
+// returns io.EOF if fewer than len(p) bytes were read because the end of the file was reached
+func (f *File) readAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset: %d", off)
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= f.fi.Size {
+			return n, io.EOF
+		}
+
+		// serve the read from the read-ahead buffer
+		if pos >= f.bufOffset && pos < f.bufOffset+int64(len(f.buf)) {
+			n += copy(p[n:], f.buf[pos-f.bufOffset:])
+
+			continue
+		}
+
+		// large reads bypass the buffer
+		remaining := int64(len(p) - n)
+		if remaining >= readAheadSize {
+			data, err := f.fetch(pos, remaining)
+			n += copy(p[n:], data)
+			if err != nil {
+				return n, err
+			}
+
+			continue
+		}
+
+		data, err := f.fetch(pos, readAheadSize)
+		if err != nil {
+			return n, err
+		}
+
+		f.buf = data
+		f.bufOffset = pos
+	}
+
+	return n, nil
+}
+
+// fetch [size] bytes of the object starting at [off], capped at the end of the file
+func (f *File) fetch(off, size int64) ([]byte, error) {
+	if off+size > f.fi.Size {
+		size = f.fi.Size - off
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(int(size))
+
+	if err := getPartialObject(f.dev, f.opCode, f.fi.ObjectId, &buf, off, size, mtp.EmptyProgressFunc); err != nil {
+		return buf.Bytes(), FileTransferError{error: err}
+	}
+
+	return buf.Bytes(), nil
+}
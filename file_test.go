@@ -0,0 +1,113 @@
+package mtpx
+
+import (
+	"bytes"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestOpenFile(t *testing.T) {
+	if isUsbTestDevice() {
+		t.Skip("the OpenFile tests require the simulated device")
+	}
+
+	expected, err := ioutil.ReadFile(getTestMocksAsset("4mb_txt_file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Read, seek and read at | OpenFile", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		f, err := OpenFile(dev, sid, FileProp{0, "/mtp-test-files/4mb_txt_file"})
+		So(err, ShouldBeNil)
+		So(f.Size(), ShouldEqual, largeTestMockSize)
+
+		header := make([]byte, 16)
+		n, err := io.ReadFull(f, header)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 16)
+		So(header, ShouldResemble, expected[:16])
+
+		// the following small reads are served by the read-ahead buffer
+		n, err = io.ReadFull(f, header)
+		So(err, ShouldBeNil)
+		So(header, ShouldResemble, expected[16:32])
+		So(dev.Calls(mtpxtest.OpRunTransaction), ShouldEqual, 1)
+		So(dev.Calls(mtpxtest.OpGetObject), ShouldEqual, 0)
+
+		offset, err := f.Seek(-10, io.SeekEnd)
+		So(err, ShouldBeNil)
+		So(offset, ShouldEqual, largeTestMockSize-10)
+
+		tail, err := ioutil.ReadAll(f)
+		So(err, ShouldBeNil)
+		So(tail, ShouldResemble, expected[largeTestMockSize-10:])
+
+		// ReadAt does not move the offset and reports the end of the file
+		p := make([]byte, 20)
+		n, err = f.ReadAt(p, 2<<20)
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, expected[2<<20:2<<20+20])
+
+		n, err = f.ReadAt(p, largeTestMockSize-5)
+		So(err, ShouldEqual, io.EOF)
+		So(n, ShouldEqual, 5)
+
+		n, err = f.Read(p)
+		So(err, ShouldEqual, io.EOF)
+		So(n, ShouldEqual, 0)
+
+		// large reads bypass the buffer
+		large := make([]byte, 1<<20)
+		n, err = f.ReadAt(large, 1000)
+		So(err, ShouldBeNil)
+		So(bytes.Equal(large, expected[1000:1000+1<<20]), ShouldBeTrue)
+
+		So(f.Close(), ShouldBeNil)
+
+		_, err = f.Read(p)
+		So(err, ShouldBeError)
+	})
+
+	Convey("Open a file using the objectId | OpenFile", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/a.txt")
+		So(err, ShouldBeNil)
+
+		f, err := OpenFile(dev, sid, FileProp{ObjectId: fi.ObjectId})
+		So(err, ShouldBeNil)
+
+		data, err := ioutil.ReadAll(f)
+		So(err, ShouldBeNil)
+		So(int64(len(data)), ShouldEqual, fi.Size)
+	})
+
+	Convey("Invalid objects | OpenFile", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		_, err := OpenFile(dev, sid, FileProp{0, "/mtp-test-files/does_not_exist.txt"})
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		_, err = OpenFile(dev, sid, FileProp{0, "/mtp-test-files/mock_dir1"})
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Convey("Partial reads are not supported by the device | OpenFile", t, func() {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		dev.(*mtpxtest.Device).DeviceInfo.OperationsSupported = []uint16{mtp.OC_GetObject}
+
+		storages, err := FetchStorages(dev)
+		So(err, ShouldBeNil)
+
+		_, err = OpenFile(dev, storages[0].Sid, FileProp{0, "/mtp-test-files/a.txt"})
+		So(err, ShouldHaveSameTypeAs, PartialReadNotSupportedError{})
+	})
+}
@@ -4,6 +4,7 @@ go 1.15
 
 require (
 	github.com/ganeshrvel/go-mtpfs v1.0.4-0.20240426083057-1c3302b3c476
+	github.com/ganeshrvel/usb v0.0.0-20210103155855-14d96f5ae403
 	github.com/smartystreets/goconvey v1.6.4
 )
 
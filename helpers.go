@@ -1,9 +1,15 @@
 package mtpx
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/usb"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,7 +17,7 @@ import (
 )
 
 // GetFileSize - fetch the file size of the object
-func GetFileSize(dev *mtp.Device, obj *mtp.ObjectInfo, objectId uint32, isDir bool) (int64, error) {
+func GetFileSize(dev Device, obj *mtp.ObjectInfo, objectId uint32, isDir bool) (int64, error) {
 	if isDir {
 		return 0, nil
 	}
@@ -21,7 +27,7 @@ func GetFileSize(dev *mtp.Device, obj *mtp.ObjectInfo, objectId uint32, isDir bo
 		var val mtp.Uint64Value
 		if err := dev.GetObjectPropValue(objectId, mtp.OPC_ObjectSize, &val); err != nil {
 			return 0, FileObjectError{
-				fmt.Errorf("GetObjectPropValue handle %d failed: %v", objectId, err.Error()),
+				fmt.Errorf("GetObjectPropValue handle %d failed: %w", objectId, err),
 			}
 		}
 
@@ -35,7 +41,7 @@ func GetFileSize(dev *mtp.Device, obj *mtp.ObjectInfo, objectId uint32, isDir bo
 
 // fetch an object using [objectId]
 // [parentPath] is required to keep track of the [fullPath] of the object
-func GetObjectFromObjectId(dev *mtp.Device, objectId uint32, parentPath string) (*FileInfo, error) {
+func GetObjectFromObjectId(dev Device, objectId uint32, parentPath string) (*FileInfo, error) {
 	obj := mtp.ObjectInfo{}
 
 	// if the [objectId] is root then return the basic root directory information
@@ -80,7 +86,7 @@ func GetObjectFromObjectId(dev *mtp.Device, objectId uint32, parentPath string)
 // fetch the object using [parentId] and [filename]
 // it matches the [filename] to the list of files in the directory
 // Since the [parentPath] is unavailable here the [fullPath] property of the resulting object [FileInfo] may not be valid.
-func GetObjectFromParentIdAndFilename(dev *mtp.Device, storageId uint32, parentId uint32, filename string) (*FileInfo, error) {
+func GetObjectFromParentIdAndFilename(dev Device, storageId uint32, parentId uint32, filename string) (*FileInfo, error) {
 	handles := mtp.Uint32Array{}
 	if err := dev.GetObjectHandles(storageId, mtp.GOH_ALL_ASSOCS, parentId, &handles); err != nil {
 		return nil, FileObjectError{error: err}
@@ -115,7 +121,7 @@ func GetObjectFromParentIdAndFilename(dev *mtp.Device, storageId uint32, parentI
 
 // fetch the object information using [fullPath]
 // Since the [parentPath] is unavailable here the [fullPath] property of the resulting object [FileInfo] may not be valid.
-func GetObjectFromPath(dev *mtp.Device, storageId uint32, fullPath string) (fInfo *FileInfo, err error) {
+func GetObjectFromPath(dev Device, storageId uint32, fullPath string) (fInfo *FileInfo, err error) {
 	if fullPath == "" {
 		return nil, InvalidPathError{error: fmt.Errorf("path does not Exists. path: %s", fullPath)}
 	}
@@ -140,7 +146,7 @@ func GetObjectFromPath(dev *mtp.Device, storageId uint32, fullPath string) (fInf
 			switch err.(type) {
 			case FileNotFoundError:
 				return nil, InvalidPathError{
-					error: fmt.Errorf("path not found: %s\nreason: %v", fullPath, err.Error()),
+					error: fmt.Errorf("path not found: %s\nreason: %w", fullPath, err),
 				}
 
 			default:
@@ -173,7 +179,7 @@ func GetObjectFromPath(dev *mtp.Device, storageId uint32, fullPath string) (fInf
 
 // fetch an object using [objectId] and/or [fullPath]
 // Since the [parentPath] is unavailable here the [fullPath] property of the resulting object [FileInfo] may not be valid.
-func GetObjectFromObjectIdOrPath(dev *mtp.Device, storageId uint32, fileProp FileProp) (fInfo *FileInfo, err error) {
+func GetObjectFromObjectIdOrPath(dev Device, storageId uint32, fileProp FileProp) (fInfo *FileInfo, err error) {
 	objectId := fileProp.ObjectId
 	fullPath := fileProp.FullPath
 
@@ -206,7 +212,7 @@ func isObjectADir(obj *mtp.ObjectInfo) bool {
 }
 
 // helper function to create a directory
-func handleMakeDirectory(dev *mtp.Device, storageId, parentId uint32, filename string) (objectId uint32, err error) {
+func handleMakeDirectory(dev Device, storageId, parentId uint32, filename string) (objectId uint32, err error) {
 	send := mtp.ObjectInfo{
 		StorageID:        storageId,
 		ObjectFormat:     mtp.OFC_Association,
@@ -225,84 +231,1026 @@ func handleMakeDirectory(dev *mtp.Device, storageId, parentId uint32, filename s
 	return objId, nil
 }
 
+// check whether [objectId] is [ancestorId] or one of its descendants
+func isObjectDescendant(dev Device, objectId, ancestorId uint32) (bool, error) {
+	for objectId != ParentObjectId && objectId != 0 {
+		if objectId == ancestorId {
+			return true, nil
+		}
+
+		var obj mtp.ObjectInfo
+		if err := dev.GetObjectInfo(objectId, &obj); err != nil {
+			return false, FileObjectError{error: err}
+		}
+
+		objectId = obj.ParentObject
+	}
+
+	return false, nil
+}
+
+// check whether the lookup of an object failed because it does not exist
+func isObjectNotFound(err error) bool {
+	switch v := err.(type) {
+	case InvalidPathError, FileNotFoundError:
+		return true
+
+	case FileObjectError:
+		return errors.Is(v, mtp.RCError(mtp.RC_InvalidObjectHandle))
+	}
+
+	return false
+}
+
+// check whether [err] means that the session with the device is gone and the following operations cannot succeed
+// go-mtpfs closes the device after a [mtp.SyncError] or a [usb.Error], the following operations fail with a plain error then
+func isSessionLost(err error) bool {
+	var usbErr usb.Error
+	var syncErr mtp.SyncError
+	var disconnectedErr DeviceDisconnectedError
+	if errors.As(err, &usbErr) || errors.As(err, &syncErr) || errors.As(err, &disconnectedErr) {
+		return true
+	}
+
+	return strings.Contains(err.Error(), deviceNotOpenErrorMessage)
+}
+
+// list [fi] along with all of its descendants, the contents of a directory are listed before the directory itself
+func listObjectTree(dev Device, fi *FileInfo) ([]*FileInfo, error) {
+	var tree []*FileInfo
+	if fi.IsDir {
+		handles := mtp.Uint32Array{}
+		if err := dev.GetObjectHandles(fi.Info.StorageID, mtp.GOH_ALL_ASSOCS, fi.ObjectId, &handles); err != nil {
+			return nil, ListDirectoryError{error: err}
+		}
+
+		for _, childId := range handles.Values {
+			child, err := GetObjectFromObjectId(dev, childId, fi.FullPath)
+			if err != nil {
+				return nil, err
+			}
+
+			childTree, err := listObjectTree(dev, child)
+			if err != nil {
+				return nil, err
+			}
+
+			tree = append(tree, childTree...)
+		}
+	}
+
+	return append(tree, fi), nil
+}
+
+// build the full path of the object [objectId] using its parents
+func objectFullPath(dev Device, objectId uint32) (string, error) {
+	var names []string
+	for objectId != ParentObjectId && objectId != 0 {
+		var obj mtp.ObjectInfo
+		if err := dev.GetObjectInfo(objectId, &obj); err != nil {
+			return "", FileObjectError{error: err}
+		}
+
+		names = append([]string{obj.Filename}, names...)
+		objectId = obj.ParentObject
+	}
+
+	return fixSlash(strings.Join(names, PathSep)), nil
+}
+
+// run the raw transaction [req] on [dev]
+// returns [mtp.RC_OperationNotSupported] if [dev] does not implement [transactionRunner], the callers fall back as they do for the devices which do not support the operation
+func runTransaction(dev Device, req *mtp.Container, rep *mtp.Container, dest io.Writer, src io.Reader, writeSize int64, progressCb mtp.ProgressFunc) error {
+	runner, ok := dev.(transactionRunner)
+	if !ok {
+		return mtp.RCError(mtp.RC_OperationNotSupported)
+	}
+
+	return runner.RunTransaction(req, rep, dest, src, writeSize, progressCb)
+}
+
+// move the object [objectId] into the directory [parentId] of the storage [storageId] using the MTP MoveObject operation
+func moveObject(dev Device, objectId, storageId, parentId uint32) error {
+	// the root directory is addressed as 0 by MoveObject
+	if parentId == ParentObjectId {
+		parentId = 0
+	}
+
+	req := mtp.Container{Code: mtp.OC_MoveObject, Param: []uint32{objectId, storageId, parentId}}
+	rep := mtp.Container{}
+
+	return runTransaction(dev, &req, &rep, nil, nil, 0, func(int64) error { return nil })
+}
+
+// copy the object [fi] into the directory [parentId] of the storage [storageId] using the MTP CopyObject operation
+// returns the objectId of the copy
+func copyObject(dev Device, objectId, storageId, parentId uint32) (uint32, error) {
+	// the root directory is addressed as 0 by CopyObject
+	if parentId == ParentObjectId {
+		parentId = 0
+	}
+
+	req := mtp.Container{Code: mtp.OC_CopyObject, Param: []uint32{objectId, storageId, parentId}}
+	rep := mtp.Container{}
+
+	if err := runTransaction(dev, &req, &rep, nil, nil, 0, func(int64) error { return nil }); err != nil {
+		return 0, err
+	}
+
+	if len(rep.Param) < 1 {
+		return 0, fmt.Errorf("the device did not return the objectId of the copy")
+	}
+
+	return rep.Param[0], nil
+}
+
+// make the directory [destination] of the storage [storageId] to move or copy [fi] into
+// returns an [InvalidPathError] if [fi] is a directory and [destination] is inside of it
+// [existing]: the object with the same name as [fi] in [destination]; nil if there is none
+func prepareObjectDestination(dev Device, fi *FileInfo, storageId uint32, destination string) (parentId uint32, existing *FileInfo, err error) {
+	parentId, err = MakeDirectory(dev, storageId, destination)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if fi.IsDir && storageId == fi.Info.StorageID {
+		inside, err := isObjectDescendant(dev, parentId, fi.ObjectId)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if inside {
+			return 0, nil, InvalidPathError{error: fmt.Errorf("invalid path: %s. a directory cannot be placed inside itself", destination)}
+		}
+	}
+
+	existing, err = GetObjectFromParentIdAndFilename(dev, storageId, parentId, fi.Name)
+	if err != nil {
+		if _, ok := err.(FileNotFoundError); ok {
+			return parentId, nil, nil
+		}
+
+		return 0, nil, err
+	}
+
+	return parentId, existing, nil
+}
+
+func newProcessCopyObjectsProps(storageId uint32, canSetProps bool, progressCb ProgressCb) *processCopyObjectsProps {
+	return &processCopyObjectsProps{
+		storageId:   storageId,
+		canSetProps: canSetProps,
+		pInfo: &ProgressInfo{
+			StartTime:      time.Now(),
+			LatestSentTime: time.Now(),
+			ActiveFileSize: &TransferSizeInfo{},
+			BulkFileSize:   &TransferSizeInfo{},
+			Status:         InProgress,
+		},
+		progressCb: progressCb,
+	}
+}
+
+// copy the object [fi] into the directory [parentId] at [parentPath], directories are copied recursively
+// the modification times are preserved if the device supports setting the props
+// returns the objectId of the copy, it is returned along with the error if the copy was partially made
+func copyObjectTree(dev Device, fi *FileInfo, parentId uint32, parentPath string, cProps *processCopyObjectsProps) (objectId uint32, err error) {
+	if fi.IsDir {
+		objectId, err = handleMakeDirectory(dev, cProps.storageId, parentId, fi.Name)
+		if err != nil {
+			return 0, err
+		}
+
+		handles := mtp.Uint32Array{}
+		if err := dev.GetObjectHandles(fi.Info.StorageID, mtp.GOH_ALL_ASSOCS, fi.ObjectId, &handles); err != nil {
+			return objectId, ListDirectoryError{error: err}
+		}
+
+		for _, childId := range handles.Values {
+			child, err := GetObjectFromObjectId(dev, childId, fi.FullPath)
+			if err != nil {
+				return objectId, err
+			}
+
+			if _, err := copyObjectTree(dev, child, objectId, getFullPath(parentPath, fi.Name), cProps); err != nil {
+				return objectId, err
+			}
+		}
+	} else {
+		objectId, err = copyObjectFile(dev, fi, parentId, parentPath, cProps)
+		if err != nil {
+			return objectId, err
+		}
+	}
+
+	if _, err := preserveObjectModTime(dev, objectId, fi.ModTime, cProps.canSetProps); err != nil {
+		return objectId, err
+	}
+
+	return objectId, nil
+}
+
+// copy the file [fi] into the directory [parentId] at [parentPath]
+// the device cannot send and receive an object at the same time, the file is read into a buffer first.
+// the files up to [copyBufferSize] are buffered in the memory and the larger ones in a temporary file
+func copyObjectFile(dev Device, fi *FileInfo, parentId uint32, parentPath string, cProps *processCopyObjectsProps) (objectId uint32, err error) {
+	var buf io.ReadWriter
+	if fi.Size <= copyBufferSize {
+		buf = bytes.NewBuffer(make([]byte, 0, fi.Size))
+	} else {
+		spool, err := ioutil.TempFile("", spoolFilePattern)
+		if err != nil {
+			return 0, LocalFileError{error: err}
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		buf = spool
+	}
+
+	if err := dev.GetObject(fi.ObjectId, buf, func(sent int64) error {
+		return nil
+	}); err != nil {
+		return 0, FileTransferError{error: fmt.Errorf("an error occured while copying the file %s. %w", fi.FullPath, err)}
+	}
+
+	if spool, ok := buf.(*os.File); ok {
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return 0, LocalFileError{error: err}
+		}
+	}
+
+	obj := mtp.ObjectInfo{
+		StorageID:        cProps.storageId,
+		ObjectFormat:     fi.Info.ObjectFormat,
+		ParentObject:     parentId,
+		Filename:         fi.Name,
+		CompressedSize:   compressedSize(fi.Size),
+		ModificationDate: fi.ModTime,
+	}
+
+	pInfo := cProps.pInfo
+	pInfo.FileInfo = &FileInfo{
+		Info:       &obj,
+		Size:       fi.Size,
+		ModTime:    fi.ModTime,
+		Name:       fi.Name,
+		FullPath:   getFullPath(parentPath, fi.Name),
+		ParentPath: parentPath,
+		Extension:  fi.Extension,
+		ParentId:   parentId,
+	}
+	pInfo.LatestSentTime = time.Now()
+
+	var prevSentSize int64 = 0
+	objectId, err = handleMakeFile(dev, cProps.storageId, &obj, buf, fi.Size, false, cProps.canSetProps, nil,
+		func(total, sent int64, objId uint32, err error) error {
+			if err != nil {
+				return err
+			}
+
+			pInfo.FileInfo.ObjectId = objId
+			pInfo.ActiveFileSize.Total = total
+			pInfo.ActiveFileSize.Sent = sent
+			pInfo.ActiveFileSize.Progress = Percent(float32(sent), float32(total))
+
+			chunkSize := sent - prevSentSize
+			cProps.bulkSizeSent += chunkSize
+
+			pInfo.BulkFileSize.Sent = cProps.bulkSizeSent
+			pInfo.BulkFileSize.Progress = Percent(float32(cProps.bulkSizeSent), float32(pInfo.BulkFileSize.Total))
+
+			pInfo.Speed = transferRate(chunkSize, pInfo.LatestSentTime)
+			if err = cProps.progressCb(pInfo, nil); err != nil {
+				return err
+			}
+
+			pInfo.LatestSentTime = time.Now()
+			prevSentSize = sent
+
+			return nil
+		},
+	)
+	if err != nil {
+		return objectId, FileTransferError{error: fmt.Errorf("an error occured while copying the file %s. %w", fi.FullPath, err)}
+	}
+
+	cProps.bulkFilesSent += 1
+	pInfo.FileInfo.ObjectId = objectId
+	pInfo.FilesSent = cProps.bulkFilesSent
+	pInfo.FilesSentProgress = Percent(float32(cProps.bulkFilesSent), float32(pInfo.TotalFiles))
+
+	return objectId, nil
+}
+
+// the CompressedSize of an object info is limited to 32 bits, larger files are reported as 0xFFFFFFFF
+func compressedSize(size int64) uint32 {
+	if size > 0xFFFFFFFF {
+		return 0xFFFFFFFF
+	}
+
+	return uint32(size)
+}
+
+// find the destination directory of an upload using [parent]
+// if the objectId is unavailable then the directory is created using the fullPath
+func handleUploadParent(dev Device, storageId uint32, parent FileProp) (parentId uint32, parentPath string, err error) {
+	if parent.ObjectId == 0 {
+		parentPath = fixSlash(parent.FullPath)
+		parentId, err = MakeDirectory(dev, storageId, parentPath)
+
+		return parentId, parentPath, err
+	}
+
+	fi, err := GetObjectFromObjectId(dev, parent.ObjectId, "")
+	if err != nil {
+		return 0, "", err
+	}
+
+	if !fi.IsDir {
+		return 0, "", InvalidPathError{error: fmt.Errorf("the parent object %d is not a directory", fi.ObjectId)}
+	}
+
+	// the [fullPath] is only known if it was given
+	parentPath = fi.FullPath
+	if parent.FullPath != "" {
+		parentPath = fixSlash(parent.FullPath)
+	}
+
+	return fi.ObjectId, parentPath, nil
+}
+
+// pick the policy which resolves the conflict [c]
+// [ConflictAsk] is resolved using [conflictCb] and [ConflictSkipIdentical] is resolved by comparing the files
+// returns a [FileConflictError] if the policy is [ConflictFail]
+func resolveConflictPolicy(policy ConflictPolicy, conflictCb ConflictCb, c *ConflictInfo) (ConflictPolicy, error) {
+	if policy == ConflictAsk {
+		if conflictCb == nil {
+			return "", fmt.Errorf("a conflict callback is required for the conflict policy: %s", policy)
+		}
+
+		_policy, err := conflictCb(c)
+		if err != nil {
+			return "", err
+		}
+
+		if _policy == ConflictAsk {
+			return "", fmt.Errorf("invalid conflict policy returned by the conflict callback: %s", _policy)
+		}
+
+		policy = _policy
+	}
+
+	switch policy {
+	case "", ConflictOverwrite:
+		return ConflictOverwrite, nil
+
+	case ConflictSkip, ConflictRename:
+		return policy, nil
+
+	case ConflictSkipIdentical:
+		// the MTP dates are accurate to a second
+		if c.SourceSize == c.DestinationSize && c.SourceModTime.Unix() == c.DestinationModTime.Unix() {
+			return ConflictSkip, nil
+		}
+
+		return ConflictOverwrite, nil
+
+	case ConflictFail:
+		return ConflictFail, FileConflictError{error: fmt.Errorf("file already Exists: %s", c.DestinationPath)}
+	}
+
+	return "", fmt.Errorf("invalid conflict policy: %s", policy)
+}
+
+// check if a file named [obj.Filename] Exists in the destination directory of an upload and resolve the conflict
+// [listing] is the listing of the destination directory
+// if the file is renamed then [obj.Filename] is changed to the new name
+// returns an empty policy if there was no conflict
+func handleUploadConflict(dev Device, listing directoryListing, obj *mtp.ObjectInfo, fInfo os.FileInfo, sourcePath, destinationPath string, options *UploadOptions) (ConflictPolicy, error) {
+	listed, ok := listing.lookup(obj.Filename)
+	if !ok {
+		return "", nil
+	}
+
+	existing, err := GetObjectFromObjectId(dev, listed.objectId, "")
+	if err != nil {
+		return "", FileObjectError{error: err}
+	}
+
+	action, err := resolveConflictPolicy(options.ConflictPolicy, options.ConflictCb, &ConflictInfo{
+		SourcePath:         sourcePath,
+		SourceSize:         fInfo.Size(),
+		SourceModTime:      fInfo.ModTime(),
+		DestinationPath:    destinationPath,
+		DestinationSize:    existing.Size,
+		DestinationModTime: existing.ModTime,
+	})
+	if err != nil {
+		return action, err
+	}
+
+	if action == ConflictRename {
+		obj.Filename = availableFilename(obj.Filename, func(name string) bool {
+			_, ok := listing.lookup(name)
+
+			return ok
+		})
+	}
+
+	return action, nil
+}
+
+// check if the local file [destinationFilePath] Exists and resolve the conflict
+// returns an empty policy if there was no conflict
+// return:
+// [destinationFilePath]: the path to download the file to; it is changed if the file is renamed
+func handleDownloadConflict(fi *FileInfo, destinationFilePath string, options *DownloadOptions) (ConflictPolicy, string, error) {
+	// the errors other than a missing file are reported while creating the local file
+	stat, err := os.Lstat(destinationFilePath)
+	if err != nil {
+		return "", destinationFilePath, nil
+	}
+
+	action, err := resolveConflictPolicy(options.ConflictPolicy, options.ConflictCb, &ConflictInfo{
+		SourcePath:         fi.FullPath,
+		SourceSize:         fi.Size,
+		SourceModTime:      fi.ModTime,
+		DestinationPath:    destinationFilePath,
+		DestinationSize:    stat.Size(),
+		DestinationModTime: stat.ModTime(),
+	})
+	if err != nil {
+		return action, destinationFilePath, err
+	}
+
+	if action == ConflictRename {
+		parentPath, filename := filepath.Split(destinationFilePath)
+		filename = availableFilename(filename, func(name string) bool {
+			_, err := os.Lstat(filepath.Join(parentPath, name))
+
+			return err == nil
+		})
+
+		destinationFilePath = filepath.Join(parentPath, filename)
+	}
+
+	return action, destinationFilePath, nil
+}
+
+// list the objects inside the directory [parentId]
+// the directory is listed once and kept up to date by the caller, it saves a listing of the directory for every lookup
+func listDirectory(dev Device, storageId, parentId uint32) (directoryListing, error) {
+	handles := mtp.Uint32Array{}
+	if err := dev.GetObjectHandles(storageId, mtp.GOH_ALL_ASSOCS, parentId, &handles); err != nil {
+		return nil, ListDirectoryError{error: err}
+	}
+
+	listing := directoryListing{}
+	for _, objectId := range handles.Values {
+		var val mtp.StringValue
+		if err := dev.GetObjectPropValue(objectId, mtp.OPC_ObjectFileName, &val); err != nil {
+			return nil, FileObjectError{error: err}
+		}
+
+		listing.add(val.Value, objectId)
+	}
+
+	return listing, nil
+}
+
+// find the object named [name] in the listing
+func (l directoryListing) lookup(name string) (listedObject, bool) {
+	o, ok := l[strings.ToLower(name)]
+
+	return o, ok
+}
+
+// add the object [objectId] named [name] to the listing
+func (l directoryListing) add(name string, objectId uint32) {
+	l[strings.ToLower(name)] = listedObject{objectId: objectId, name: name}
+}
+
+// remove the object named [name] from the listing
+func (l directoryListing) remove(name string) {
+	delete(l, strings.ToLower(name))
+}
+
+// check whether the device refused to delete a directory because it is not empty
+// the devices report it as a partial deletion or as a general error
+func isNonEmptyDeleteRefused(err error) bool {
+	return err == mtp.RCError(mtp.RC_PartialDeletion) || err == mtp.RCError(mtp.RC_GeneralError)
+}
+
+// check whether the device supports the operation [opCode]
+func operationSupported(info *mtp.DeviceInfo, opCode uint16) bool {
+	for _, code := range info.OperationsSupported {
+		if code == opCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// detect the object format code of the file [filename] using its extension or, if the extension is unknown, the leading bytes of its contents [header]
+// returns [mtp.OFC_Undefined] if the format is unknown or it is not in [supportedFormats]
+func detectObjectFormat(filename string, header []byte, supportedFormats []uint16) uint16 {
+	format, ok := objectFormatExtensions[strings.ToLower(filepath.Ext(filename))]
+	if !ok && len(header) > 0 {
+		contentType := http.DetectContentType(header)
+		if i := strings.Index(contentType, ";"); i >= 0 {
+			contentType = contentType[:i]
+		}
+
+		format, ok = objectFormatContentTypes[contentType]
+	}
+
+	if !ok {
+		return mtp.OFC_Undefined
+	}
+
+	for _, f := range supportedFormats {
+		if f == format {
+			return format
+		}
+	}
+
+	return mtp.OFC_Undefined
+}
+
+// hash the contents of a device object
+func objectChecksum(dev Device, objectId uint32) ([]byte, error) {
+	h := sha256.New()
+	if err := dev.GetObject(objectId, h, func(sent int64) error {
+		return nil
+	}); err != nil {
+		return nil, FileObjectError{error: err}
+	}
+
+	return h.Sum(nil), nil
+}
+
+// hash the contents of a local file
+func localFileChecksum(fullPath string) ([]byte, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// verify the device object [objectId] against a local file of [size] bytes
+// [checksum] of the local file is required for [VerifyChecksum]
+// returns a [FileVerificationError] on a mismatch
+func verifyObject(dev Device, objectId uint32, fullPath string, size int64, checksum []byte, mode VerifyMode) error {
+	if mode == VerifyNone {
+		return nil
+	}
+
+	var obj mtp.ObjectInfo
+	if err := dev.GetObjectInfo(objectId, &obj); err != nil {
+		return FileObjectError{error: err}
+	}
+
+	objectSize, err := GetFileSize(dev, &obj, objectId, false)
+	if err != nil {
+		return err
+	}
+
+	if objectSize != size {
+		return FileVerificationError{
+			error: fmt.Errorf("size mismatch: %s, device: %d bytes, local: %d bytes", fullPath, objectSize, size),
+		}
+	}
+
+	if mode != VerifyChecksum {
+		return nil
+	}
+
+	objectSum, err := objectChecksum(dev, objectId)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(objectSum, checksum) {
+		return FileVerificationError{
+			error: fmt.Errorf("checksum mismatch: %s, device: %x, local: %x", fullPath, objectSum, checksum),
+		}
+	}
+
+	return nil
+}
+
+// verify a downloaded file at [destinationPath] against the device object [fi]
+func verifyLocalFile(dev Device, fi *FileInfo, destinationPath string, mode VerifyMode) error {
+	if mode == VerifyNone {
+		return nil
+	}
+
+	stat, err := os.Stat(destinationPath)
+	if err != nil {
+		return err
+	}
+
+	var checksum []byte
+	if mode == VerifyChecksum {
+		if checksum, err = localFileChecksum(destinationPath); err != nil {
+			return err
+		}
+	}
+
+	return verifyObject(dev, fi.ObjectId, destinationPath, stat.Size(), checksum, mode)
+}
+
 // helper function to create a device file
-func handleMakeFile(dev *mtp.Device, storageId uint32, obj *mtp.ObjectInfo, fInfo *os.FileInfo, fileBuf *os.File, overwriteExisting bool, progressCb SizeProgressCb) (objectId uint32, err error) {
-	fi, err := GetObjectFromParentIdAndFilename(dev, storageId, obj.ParentObject, obj.Filename)
+// [size] bytes of [r] are sent to the device
+// [listing] is the listing of the directory [obj.ParentObject], the directory is listed if it is nil; the listing is updated once the file is created
+// if [canSetProps] is true then the object is sent as a hidden temporary sibling of [obj.Filename] which is renamed into place once it is complete,
+// an existing file is renamed aside until the complete object is in place and it is deleted afterwards; it is restored if the object cannot be renamed into place
+// otherwise the object is sent under its own name and an existing file is deleted before the transfer
+// if the transfer fails then the new object is deleted so that it is not mistaken for a complete file
+// the device may drop the session if the transfer was aborted in the middle of the object, then the new object is left on the device and its [objectId] is returned along with the error; a temporary object is replaced by the next attempt
+// [listing] may be out of date if an error is returned, list the directory again then
+func handleMakeFile(dev Device, storageId uint32, obj *mtp.ObjectInfo, r io.Reader, size int64, overwriteExisting, canSetProps bool, listing directoryListing, progressCb SizeProgressCb) (objectId uint32, err error) {
+	if listing == nil {
+		if listing, err = listDirectory(dev, storageId, obj.ParentObject); err != nil {
+			return 0, err
+		}
+	}
 
-	// file Exists
-	if err == nil {
-		// if [overwriteExisting] is false then just return existing [objectId] of the exisiting file
-		if !overwriteExisting {
-			return fi.ObjectId, nil
+	existing, exists := listing.lookup(obj.Filename)
+
+	// if [overwriteExisting] is false then just return existing [objectId] of the exisiting file
+	if exists && !overwriteExisting {
+		return existing.objectId, nil
+	}
+
+	// the objects cannot be renamed, the existing file has to make way for the new object
+	if !canSetProps {
+		if exists {
+			if err := DeleteFile(dev, storageId, []FileProp{{existing.objectId, ""}}); err != nil {
+				return 0, err
+			}
+		}
+
+		objId, err := sendObject(dev, storageId, obj, r, size, progressCb)
+		if err != nil {
+			return objId, err
+		}
+
+		listing.add(obj.Filename, objId)
+
+		return objId, nil
+	}
+
+	tempObj := *obj
+	tempObj.Filename = tempUploadFilename(obj.Filename)
+
+	// a temporary object left behind by an interrupted upload
+	if stale, ok := listing.lookup(tempObj.Filename); ok {
+		if err := DeleteFile(dev, storageId, []FileProp{{stale.objectId, ""}}); err != nil {
+			return 0, err
+		}
+
+		listing.remove(tempObj.Filename)
+	}
+
+	objId, err := sendObject(dev, storageId, &tempObj, r, size, progressCb)
+	if err != nil {
+		return objId, err
+	}
+
+	if !exists {
+		if err := renameObject(dev, objId, obj.Filename); err != nil {
+			if delErr := dev.DeleteObject(objId); delErr == nil {
+				return 0, err
+			}
+
+			return objId, err
+		}
+
+		listing.add(obj.Filename, objId)
+
+		return objId, nil
+	}
+
+	// the existing file is kept under another name until the complete object is in place
+	if err := renameObject(dev, existing.objectId, replacedUploadFilename(obj.Filename)); err != nil {
+		_ = dev.DeleteObject(objId)
+
+		return 0, err
+	}
+
+	if err := renameObject(dev, objId, obj.Filename); err != nil {
+		_ = renameObject(dev, existing.objectId, existing.name)
+		_ = dev.DeleteObject(objId)
+
+		return 0, err
+	}
+
+	if err := DeleteFile(dev, storageId, []FileProp{{existing.objectId, ""}}); err != nil {
+		return objId, err
+	}
+
+	listing.add(obj.Filename, objId)
+
+	return objId, nil
+}
+
+// send the object [obj] and [size] bytes of [r] to the device
+// if the transfer fails then the object is deleted, its [objectId] is returned along with the error if it could not be deleted
+func sendObject(dev Device, storageId uint32, obj *mtp.ObjectInfo, r io.Reader, size int64, progressCb SizeProgressCb) (objectId uint32, err error) {
+	// create a new object handle
+	_, _, objId, err := dev.SendObjectInfo(storageId, obj.ParentObject, obj)
+	if err != nil {
+		return objId, SendObjectError{error: err}
+	}
+
+	// send the bytes data to the newly create object handle
+	err = dev.SendObject(r, size, func(sent int64) error {
+		if err := progressCb(size, sent, objId, nil); err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		if delErr := dev.DeleteObject(objId); delErr == nil {
+			return 0, SendObjectError{error: err}
+		}
+
+		return objId, SendObjectError{error: err}
+	}
+
+	return objId, nil
+}
+
+// rename the object [objectId] to [filename]
+func renameObject(dev Device, objectId uint32, filename string) error {
+	if err := dev.SetObjectPropValue(objectId, mtp.OPC_ObjectFileName, &mtp.StringValue{Value: filename}); err != nil {
+		return FileObjectError{error: err}
+	}
+
+	return nil
+}
+
+// the hidden temporary object which a file named [filename] is uploaded as before it is renamed into place
+func tempUploadFilename(filename string) string {
+	return "." + filename + tempUploadFileSuffix
+}
+
+// the hidden name which an existing file named [filename] is kept under while the uploaded object is renamed into place
+func replacedUploadFilename(filename string) string {
+	return "." + filename + replacedUploadFileSuffix
+}
+
+// helper function to create a local file
+// the object is downloaded into a hidden temporary sibling of [destination] which is renamed into place once it is complete
+// an existing temporary file of an interrupted download is continued from its length if the device supports partial object downloads
+// the temporary file is kept if the download fails so that the next attempt can continue it, it is removed if the download was canceled or it cannot be continued
+func handleMakeLocalFile(dev Device, fi *FileInfo, destination string, progressCb SizeProgressCb) error {
+	tempDestination := tempDownloadPath(destination)
+
+	f, offset, opCode, err := openLocalFileForDownload(dev, fi, tempDestination)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var totalSent int64 = 0
+	sizeProgressCb := func(sent int64) error {
+		if err := progressCb(fi.Size, sent, fi.ObjectId, nil); err != nil {
+			return err
+		}
+
+		totalSent = sent
+
+		return nil
+	}
+
+	if offset > 0 {
+		err = getPartialObject(dev, opCode, fi.ObjectId, f, offset, fi.Size-offset, sizeProgressCb)
+	} else {
+		err = dev.GetObject(fi.ObjectId, f, sizeProgressCb)
+	}
+	if err != nil {
+		if errors.As(err, &CanceledError{}) || !canContinueDownload(dev, fi) {
+			f.Close()
+			os.Remove(tempDestination)
 		}
 
-		fileProp := FileProp{fi.ObjectId, ""}
-		// if [overwriteExisting] is true then delete the existing file
-		if err := DeleteFile(dev, storageId, []FileProp{fileProp}); err != nil {
-			return 0, err
-		}
-	} else {
-		switch err.(type) {
-		// if the file does not Exists then do nothing
-		case FileNotFoundError:
+		return err
+	}
 
-		default:
-			return 0, err
-		}
+	if err := f.Close(); err != nil {
+		return err
 	}
 
-	// create a new object handle
-	_, _, objId, err := dev.SendObjectInfo(storageId, obj.ParentObject, obj)
+	// make sure that the whole object was received
+	stat, err := os.Stat(tempDestination)
 	if err != nil {
-		return objId, SendObjectError{error: err}
+		return err
 	}
 
-	size := (*fInfo).Size()
-	// send the bytes data to the newly create object handle
-	err = dev.SendObject(fileBuf, size, func(sent int64) error {
-		if err := progressCb(size, sent, objId, nil); err != nil {
+	if stat.Size() != fi.Size {
+		return FileSizeMismatchError{
+			error: fmt.Errorf("the size of the downloaded file %s is %d bytes, expected %d bytes", destination, stat.Size(), fi.Size),
+		}
+	}
+
+	// fix the incorrect sent size
+	if totalSent < fi.Size {
+		if err := progressCb(fi.Size, fi.Size, fi.ObjectId, nil); err != nil {
 			return err
 		}
+	}
 
-		return nil
-	})
-	if err != nil {
-		return objId, SendObjectError{error: err}
+	if err := restoreLocalFileTimestamp(tempDestination, fi.ModTime); err != nil {
+		return err
 	}
 
-	return objId, nil
+	return os.Rename(tempDestination, destination)
 }
 
-// helper function to create a local file
-func handleMakeLocalFile(dev *mtp.Device, fi *FileInfo, destination string, progressCb SizeProgressCb) error {
-	f, err := os.Create(destination)
+// the hidden temporary file which an object is downloaded into before it is renamed to [destination]
+func tempDownloadPath(destination string) string {
+	return filepath.Join(filepath.Dir(destination), "."+filepath.Base(destination)+tempDownloadFileSuffix)
+}
+
+// check if a failed download of [fi] can be continued by the next attempt
+// the partial file is kept if the device could not be asked
+func canContinueDownload(dev Device, fi *FileInfo) bool {
+	opCode, err := partialObjectOperation(dev, fi.Size)
+
+	return err != nil || opCode != 0
+}
+
+// open the local file [destination] to download [fi] into
+// if a partial local file exists and its tail matches the object then the download continues from its length
+// otherwise the file is truncated
+// return:
+// [offset]: the size of the partial file which is kept
+// [opCode]: the partial object operation to continue the download with
+func openLocalFileForDownload(dev Device, fi *FileInfo, destination string) (f *os.File, offset int64, opCode uint16, err error) {
+	stat, err := os.Stat(destination)
+	if err != nil || !stat.Mode().IsRegular() || stat.Size() < 1 || stat.Size() >= fi.Size {
+		f, err := os.Create(destination)
+
+		return f, 0, 0, err
+	}
+
+	opCode, err = partialObjectOperation(dev, fi.Size)
+	if err != nil || opCode == 0 {
+		f, err := os.Create(destination)
+
+		return f, 0, 0, err
+	}
+
+	f, err = os.OpenFile(destination, os.O_RDWR, 0)
 	if err != nil {
-		return err
+		return nil, 0, 0, err
 	}
-	defer f.Close()
 
-	var totalSent int64 = 0
-	err = dev.GetObject(fi.ObjectId, f, func(sent int64) error {
-		if err := progressCb(fi.Size, sent, fi.ObjectId, err); err != nil {
-			return err
+	offset = stat.Size()
+	matches, err := partialFileMatches(dev, opCode, fi, f, offset)
+	if err != nil {
+		f.Close()
+
+		return nil, 0, 0, err
+	}
+
+	if !matches {
+		offset = 0
+
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+
+			return nil, 0, 0, err
 		}
+	}
 
-		totalSent = sent
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
 
-		return nil
-	})
+		return nil, 0, 0, err
+	}
+
+	return f, offset, opCode, nil
+}
+
+// compare the tail of the partial local file [f] with the same range of the object
+// the local file may be an older file with the same name instead of an interrupted download
+func partialFileMatches(dev Device, opCode uint16, fi *FileInfo, f *os.File, size int64) (bool, error) {
+	overlap := int64(resumeOverlapSize)
+	if overlap > size {
+		overlap = size
+	}
+
+	local := make([]byte, overlap)
+	if _, err := f.ReadAt(local, size-overlap); err != nil {
+		return false, err
+	}
+
+	var remote bytes.Buffer
+	err := getPartialObject(dev, opCode, fi.ObjectId, &remote, size-overlap, overlap, mtp.EmptyProgressFunc)
 	if err != nil {
-		return err
+		// the device does not support the operation after all, download the whole object
+		if errors.As(err, new(mtp.RCError)) {
+			return false, nil
+		}
+
+		return false, err
 	}
 
-	// fix the incorrect sent size
-	if totalSent < fi.Size {
-		if err := progressCb(fi.Size, fi.Size, fi.ObjectId, err); err != nil {
+	return bytes.Equal(local, remote.Bytes()), nil
+}
+
+// find the partial object operation supported by the device
+// Android's GetPartialObject64 is preferred since GetPartialObject is limited to 32 bit offsets
+// returns 0 if partial downloads of an object of [size] are not supported
+func partialObjectOperation(dev Device, size int64) (uint16, error) {
+	if _, ok := dev.(transactionRunner); !ok {
+		return 0, nil
+	}
+
+	info := mtp.DeviceInfo{}
+	if err := dev.GetDeviceInfo(&info); err != nil {
+		return 0, err
+	}
+
+	var opCode uint16
+	for _, code := range info.OperationsSupported {
+		switch {
+		case code == mtp.OC_ANDROID_GET_PARTIAL_OBJECT64:
+			return code, nil
+
+		case code == mtp.OC_GetPartialObject && size <= maxPartialObjectSize:
+			opCode = code
+		}
+	}
+
+	return opCode, nil
+}
+
+// download [size] bytes of the object [handle] starting at [offset] into [w]
+// [progressCb] receives the position within the object
+func getPartialObject(dev Device, opCode uint16, handle uint32, w io.Writer, offset, size int64, progressCb mtp.ProgressFunc) error {
+	end := offset + size
+
+	for offset < end {
+		length := end - offset
+		if length > maxPartialObjectSize {
+			length = maxPartialObjectSize
+		}
+
+		req := mtp.Container{Code: opCode}
+		if opCode == mtp.OC_ANDROID_GET_PARTIAL_OBJECT64 {
+			req.Param = []uint32{handle, uint32(offset & 0xFFFFFFFF), uint32(offset >> 32), uint32(length)}
+		} else {
+			req.Param = []uint32{handle, uint32(offset), uint32(length)}
+		}
+
+		// the progress callbacks of a transaction do not count the first usb packet, the received bytes are counted instead
+		start := offset
+		cw := &countingWriter{w: w}
+		rep := mtp.Container{}
+		err := runTransaction(dev, &req, &rep, cw, nil, 0, func(sent int64) error {
+			return progressCb(start + sent)
+		})
+		if err != nil {
 			return err
 		}
+
+		// the object is shorter than expected
+		if cw.n < 1 {
+			return io.ErrUnexpectedEOF
+		}
+
+		offset = start + cw.n
 	}
 
-	return restoreLocalFileTimestamp(destination, fi.ModTime)
+	return nil
+}
+
+// counts the bytes written to [w]
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
 }
 
 // helper function to fetch the contents inside a directory
@@ -316,7 +1264,7 @@ func handleMakeLocalFile(dev *mtp.Device, fi *FileInfo, destination string, prog
 // return:
 // [totalFiles]: total number of files
 // [totalDirectories]: total number of directories
-func proccessWalk(dev *mtp.Device, storageId uint32, fileProp FileProp, recursive, skipDisallowedFiles, skipHiddenFiles bool, cb WalkCb) (totalFiles, totalDirectories int64, err error) {
+func proccessWalk(dev Device, storageId uint32, fileProp FileProp, recursive, skipDisallowedFiles, skipHiddenFiles bool, cb WalkCb) (totalFiles, totalDirectories int64, err error) {
 	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, FileProp{fileProp.ObjectId, fileProp.FullPath})
 
 	if err != nil {
@@ -333,6 +1281,11 @@ func proccessWalk(dev *mtp.Device, storageId uint32, fileProp FileProp, recursiv
 	for _, objId := range handles.Values {
 		fi, err := GetObjectFromObjectId(dev, objId, fileProp.FullPath)
 		if err != nil {
+			// stop walking if it was canceled, otherwise skip the object
+			if errors.As(err, &CanceledError{}) {
+				return totalFiles, totalDirectories, err
+			}
+
 			continue
 		}
 
@@ -461,21 +1414,43 @@ func walkLocalFiles(sources []string, cb LocalWalkCb) (totalFiles, totalDirector
 	return totalFiles, totalDirectories, totalSize, nil
 }
 
-func processDownloadFiles(dev *mtp.Device, pInfo *ProgressInfo, fi *FileInfo, progressCb ProgressCb, dfProps *processDownloadFilesProps) (err error) {
+func processDownloadFiles(dev Device, pInfo *ProgressInfo, fi *FileInfo, progressCb ProgressCb, dfProps *processDownloadFilesProps) (err error) {
 
 	// filter out disallowed files
 	if isDisallowedFiles(fi.Name) {
 		return nil
 	}
 
+	reporter := dfProps.reporter
+
 	// if the object is a directory then create a local directory
 	if fi.IsDir {
+		reporter.begin(fi.FullPath, dfProps.destinationFilePath, true, 0)
+
 		// since the object is a directory we pass down it's modification time
 		err := makeLocalDirectory(dfProps.destinationFilePath, fi.ModTime)
 		if err != nil {
+			return reporter.failed(err, transferError(err, "downloading the files"), 0)
+		}
+
+		return nil
+	}
+
+	reporter.begin(fi.FullPath, dfProps.destinationFilePath, false, fi.Size)
+
+	var prevSentSize int64 = 0
+
+	// the failed file is not counted in [bulkFilesSent] and [bulkSizeSent] if the download carries on
+	fileFailed := func(err error, counted bool) error {
+		if err := reporter.failed(err, transferError(err, "downloading the files"), prevSentSize); err != nil {
 			return err
 		}
 
+		if counted {
+			dfProps.bulkFilesSent -= 1
+			dfProps.bulkSizeSent -= prevSentSize
+		}
+
 		return nil
 	}
 
@@ -486,10 +1461,35 @@ func processDownloadFiles(dev *mtp.Device, pInfo *ProgressInfo, fi *FileInfo, pr
 		// we are just passing down the current time as modification time
 		err := makeLocalDirectory(dfProps.destinationFileParentPath, time.Now())
 		if err != nil {
-			return err
+			return fileFailed(err, false)
 		}
 	}
 
+	// resolve the conflict with an existing local file
+	conflictAction, destinationFilePath, err := handleDownloadConflict(fi, dfProps.destinationFilePath, dfProps.options)
+	if err != nil {
+		return fileFailed(err, false)
+	}
+
+	pInfo.ConflictAction = conflictAction
+
+	switch conflictAction {
+	case ConflictSkip:
+		pInfo.FilesSkipped += 1
+		pInfo.FileInfo = fi
+		reporter.skipped()
+
+		// remove the leftover of an interrupted download of the skipped file
+		os.Remove(tempDownloadPath(dfProps.destinationFilePath))
+
+		return progressCb(pInfo, nil)
+
+	case ConflictRename:
+		pInfo.FilesRenamed += 1
+		dfProps.destinationFilePath = destinationFilePath
+		reporter.item.DestinationPath = destinationFilePath
+	}
+
 	// keep track of [bulkFilesSent]
 	dfProps.bulkFilesSent += 1
 
@@ -497,7 +1497,6 @@ func processDownloadFiles(dev *mtp.Device, pInfo *ProgressInfo, fi *FileInfo, pr
 	pInfo.FileInfo = fi
 
 	// create the local file
-	var prevSentSize int64 = 0
 	err = handleMakeLocalFile(dev, fi, dfProps.destinationFilePath,
 		func(total, sent int64, _ uint32, err error) error {
 			if err != nil {
@@ -525,38 +1524,60 @@ func processDownloadFiles(dev *mtp.Device, pInfo *ProgressInfo, fi *FileInfo, pr
 			return nil
 		})
 	if err != nil {
-		return err
+		return fileFailed(err, true)
+	}
+
+	if verify := dfProps.options.Verify; verify != VerifyNone {
+		if err := verifyLocalFile(dev, fi, dfProps.destinationFilePath, verify); err != nil {
+			// report the mismatch in the progress stream, an error returned by [progressCb] aborts the download
+			if cbErr := progressCb(pInfo, err); cbErr != nil {
+				_ = fileFailed(err, true)
+
+				return cbErr
+			}
+
+			return fileFailed(err, true)
+		}
+
+		pInfo.FilesVerified += 1
 	}
 
+	reporter.succeeded(fi.Size)
+
 	pInfo.FilesSent = dfProps.bulkFilesSent
 	pInfo.FilesSentProgress = Percent(float32(dfProps.bulkFilesSent), float32(dfProps.totalFiles))
 
 	return nil
 }
 
-func processDownloadFilesError(dfProps *processDownloadFilesProps, err error) (bulkFilesSent, bulkSizeSent int64, error error) {
-	if err != nil {
-		switch err.(type) {
-		case InvalidPathError:
-			return dfProps.bulkFilesSent, dfProps.bulkSizeSent, err
+func processDownloadFilesError(dfProps *processDownloadFilesProps, err error) (bulkFilesSent, bulkSizeSent int64, report *TransferReport, error error) {
+	return dfProps.bulkFilesSent, dfProps.bulkSizeSent, dfProps.reporter.report, transferError(err, "downloading the files")
+}
 
-		case *os.PathError:
-			if errors.Is(err, os.ErrPermission) {
-				return dfProps.bulkFilesSent, dfProps.bulkSizeSent, FilePermissionError{error: err}
-			}
+// the typed error of a failed upload or download
+// [operation] describes the transfer in the [FileTransferError]
+func transferError(err error, operation string) error {
+	if err == nil {
+		return nil
+	}
 
-			if errors.Is(err, os.ErrNotExist) {
-				return dfProps.bulkFilesSent, dfProps.bulkSizeSent, InvalidPathError{error: err}
-			}
+	switch err.(type) {
+	case InvalidPathError, FileConflictError, FileVerificationError:
+		return err
 
-			return dfProps.bulkFilesSent, dfProps.bulkSizeSent, LocalFileError{error: err}
-		default:
-			return dfProps.bulkFilesSent, dfProps.bulkSizeSent,
-				FileTransferError{error: fmt.Errorf("an error occured while downloading the files. %+v", err.Error())}
+	case *os.PathError:
+		if errors.Is(err, os.ErrPermission) {
+			return FilePermissionError{error: err}
+		}
+
+		if errors.Is(err, os.ErrNotExist) {
+			return InvalidPathError{error: err}
 		}
+
+		return LocalFileError{error: err}
 	}
 
-	return bulkFilesSent, bulkSizeSent, err
+	return FileTransferError{error: fmt.Errorf("an error occured while %s. %w", operation, err)}
 }
 
 //Restore modified timestamp of the file
@@ -570,3 +1591,249 @@ func restoreLocalFileTimestamp(destination string, modTime time.Time) (err error
 
 	return err
 }
+
+// fetch the details of an usb device
+// returns false if the device does not have an mtp interface
+func fetchUsbDevice(d *usb.Device) (UsbDevice, bool) {
+	dd, err := d.GetDeviceDescriptor()
+	if err != nil {
+		return UsbDevice{}, false
+	}
+
+	iface, ok := findMtpInterface(d, dd)
+	if !ok {
+		return UsbDevice{}, false
+	}
+
+	ud := UsbDevice{
+		VendorId:  dd.IdVendor,
+		ProductId: dd.IdProduct,
+		Bus:       d.GetBusNumber(),
+		Address:   d.GetDeviceAddress(),
+	}
+
+	// opening the device does not claim its interface
+	h, err := d.Open()
+	if err != nil {
+		return ud, true
+	}
+	defer h.Close()
+
+	// devices without an interface name are only verified after claiming the interface, list them anyway
+	if iface.InterfaceStringIndex != 0 {
+		name, err := h.GetStringDescriptorASCII(iface.InterfaceStringIndex)
+		if err == nil && !isMtpInterfaceName(name) {
+			return UsbDevice{}, false
+		}
+	}
+
+	ud.Manufacturer = fetchStringDescriptor(h, dd.Manufacturer)
+	ud.Model = fetchStringDescriptor(h, dd.Product)
+	ud.SerialNumber = fetchStringDescriptor(h, dd.SerialNumber)
+
+	return ud, true
+}
+
+// find the interface with the mtp endpoints (bulk in, bulk out and interrupt in)
+func findMtpInterface(d *usb.Device, dd *usb.DeviceDescriptor) (usb.InterfaceDescriptor, bool) {
+	for i := byte(0); i < dd.NumConfigurations; i++ {
+		cdecs, err := d.GetConfigDescriptor(i)
+		if err != nil {
+			return usb.InterfaceDescriptor{}, false
+		}
+
+		for _, iface := range cdecs.Interfaces {
+			for _, a := range iface.AltSetting {
+				if len(a.EndPoints) != 3 {
+					continue
+				}
+
+				var sendEP, fetchEP, eventEP bool
+				for _, s := range a.EndPoints {
+					switch {
+					case s.Direction() == usb.ENDPOINT_IN && s.TransferType() == usb.TRANSFER_TYPE_INTERRUPT:
+						eventEP = true
+					case s.Direction() == usb.ENDPOINT_IN && s.TransferType() == usb.TRANSFER_TYPE_BULK:
+						fetchEP = true
+					case s.Direction() == usb.ENDPOINT_OUT && s.TransferType() == usb.TRANSFER_TYPE_BULK:
+						sendEP = true
+					}
+				}
+
+				if sendEP && fetchEP && eventEP {
+					return a, true
+				}
+			}
+		}
+	}
+
+	return usb.InterfaceDescriptor{}, false
+}
+
+// the interface names accepted by the mtp library (older samsung phones use 'CDC' and 'ACM')
+func isMtpInterfaceName(name string) bool {
+	return strings.Contains(name, "MTP") || strings.Contains(name, "CDC") || strings.Contains(name, "ACM")
+}
+
+// returns an empty string if the descriptor is not available
+func fetchStringDescriptor(h *usb.DeviceHandle, index byte) string {
+	if index == 0 {
+		return ""
+	}
+
+	s, err := h.GetStringDescriptorASCII(index)
+	if err != nil {
+		return ""
+	}
+
+	return s
+}
+
+// returns true if any of the selection fields of [init] are set
+func isDeviceSelected(init Init) bool {
+	return init.SerialNumber != "" || init.VendorId != 0 || init.ProductId != 0 || init.Bus != 0 || init.Address != 0
+}
+
+// returns true if [ud] matches the selection fields of [init]
+func isUsbDeviceSelected(init Init, ud UsbDevice) bool {
+	if init.SerialNumber != "" && init.SerialNumber != ud.SerialNumber {
+		return false
+	}
+
+	if init.VendorId != 0 && init.VendorId != ud.VendorId {
+		return false
+	}
+
+	if init.ProductId != 0 && init.ProductId != ud.ProductId {
+		return false
+	}
+
+	if init.Bus != 0 && init.Bus != ud.Bus {
+		return false
+	}
+
+	if init.Address != 0 && init.Address != ud.Address {
+		return false
+	}
+
+	return true
+}
+
+// find the device matching the selection fields of [init] among [devices]
+func findSelectedUsbDevice(init Init, devices []UsbDevice) (UsbDevice, error) {
+	var matched []UsbDevice
+	for _, ud := range devices {
+		if isUsbDeviceSelected(init, ud) {
+			matched = append(matched, ud)
+		}
+	}
+
+	if len(matched) < 1 {
+		return UsbDevice{}, fmt.Errorf("no MTP device matches the selection (serial number: '%s', id: %04x:%04x, bus: %d, address: %d)",
+			init.SerialNumber, init.VendorId, init.ProductId, init.Bus, init.Address)
+	}
+
+	if len(matched) > 1 {
+		return UsbDevice{}, fmt.Errorf("%d MTP devices match the selection, narrow it down using the serial number or the bus address", len(matched))
+	}
+
+	selected := matched[0]
+
+	// the mtp library identifies the devices using the vendor id, product id and serial number
+	for _, ud := range devices {
+		if ud != selected && ud.VendorId == selected.VendorId && ud.ProductId == selected.ProductId && ud.SerialNumber == selected.SerialNumber {
+			return UsbDevice{}, fmt.Errorf("the MTP device %04x:%04x at bus %d, address %d cannot be distinguished from the device at bus %d, address %d",
+				selected.VendorId, selected.ProductId, selected.Bus, selected.Address, ud.Bus, ud.Address)
+		}
+	}
+
+	return selected, nil
+}
+
+// open the device matching the selection fields of [init]
+func selectDevice(init Init) (*mtp.Device, error) {
+	devices, err := ListDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := findSelectedUsbDevice(init, devices)
+	if err != nil {
+		return nil, err
+	}
+
+	c := usb.NewContext()
+
+	cands, err := mtp.FindDevices(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var dev *mtp.Device
+	for _, cand := range cands {
+		if dev != nil {
+			cand.Done()
+
+			continue
+		}
+
+		cand.USBDebug = init.DebugMode
+		cand.DataDebug = init.DebugMode
+		cand.MTPDebug = init.DebugMode
+
+		if err := cand.Open(); err != nil {
+			cand.Done()
+
+			continue
+		}
+
+		info, err := cand.GetUsbInfo()
+		if err == nil && info.IdVendor == selected.VendorId && info.IdProduct == selected.ProductId && info.SerialNumber == selected.SerialNumber {
+			dev = cand
+
+			continue
+		}
+
+		cand.Close()
+		cand.Done()
+	}
+
+	if dev == nil {
+		return nil, fmt.Errorf("unable to open the MTP device %04x:%04x at bus %d, address %d", selected.VendorId, selected.ProductId, selected.Bus, selected.Address)
+	}
+
+	return dev, nil
+}
+
+// check whether the modification date of the object [objectId] is [modTime]
+func objectModTimeMatches(dev Device, objectId uint32, modTime time.Time) (bool, error) {
+	var info mtp.ObjectInfo
+	if err := dev.GetObjectInfo(objectId, &info); err != nil {
+		return false, FileObjectError{error: err}
+	}
+
+	// the date is sent as the wall clock of [modTime]
+	return info.ModificationDate.Format(mtpDateFormat) == modTime.Format(mtpDateFormat), nil
+}
+
+// preserve the modification time [modTime] of the uploaded object [objectId]
+// most Android devices stamp the objects with the time of the upload, the [mtp.OPC_DateModified] prop of the object is set then if [canSetProps] is true
+// returns whether the device kept [modTime]
+func preserveObjectModTime(dev Device, objectId uint32, modTime time.Time, canSetProps bool) (bool, error) {
+	matches, err := objectModTimeMatches(dev, objectId, modTime)
+	if err != nil || matches || !canSetProps {
+		return matches, err
+	}
+
+	value := mtp.StringValue{Value: modTime.Format(mtpDateFormat)}
+	if err := dev.SetObjectPropValue(objectId, mtp.OPC_DateModified, &value); err != nil {
+		// the device refused to set the prop
+		if errors.As(err, new(mtp.RCError)) {
+			return false, nil
+		}
+
+		return false, FileObjectError{error: err}
+	}
+
+	return objectModTimeMatches(dev, objectId, modTime)
+}
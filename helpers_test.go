@@ -7,7 +7,7 @@ import (
 )
 
 func TestGetObjectFromPath(t *testing.T) {
-	dev, err := Initialize(Init{})
+	dev, err := initTestDevice()
 	if err != nil {
 		log.Panic(err)
 	}
@@ -193,7 +193,7 @@ func TestGetObjectFromPath(t *testing.T) {
 }
 
 func TestGetObjectFromParentIdAndFilename(t *testing.T) {
-	dev, err := Initialize(Init{})
+	dev, err := initTestDevice()
 	if err != nil {
 		log.Panic(err)
 	}
@@ -270,7 +270,7 @@ func TestGetObjectFromParentIdAndFilename(t *testing.T) {
 }
 
 func TestFileExists(t *testing.T) {
-	dev, err := Initialize(Init{})
+	dev, err := initTestDevice()
 	if err != nil {
 		log.Panic(err)
 	}
@@ -652,7 +652,7 @@ func TestFileExists(t *testing.T) {
 
 func
 TestGetObjectFromObjectIdOrPath(t *testing.T) {
-	dev, err := Initialize(Init{})
+	dev, err := initTestDevice()
 	if err != nil {
 		log.Panic(err)
 	}
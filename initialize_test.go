@@ -7,6 +7,10 @@ import (
 )
 
 func TestMtpInitialize(t *testing.T) {
+	if !isUsbTestDevice() {
+		t.Skip("Initialize requires a connected device (MTPX_TEST_DEVICE=usb)")
+	}
+
 	var dev *mtp.Device
 	var sid uint32
 
@@ -36,3 +40,65 @@ func TestMtpInitialize(t *testing.T) {
 
 	Dispose(dev)
 }
+
+func TestListDevices(t *testing.T) {
+	Convey("Testing ListDevices", t, func() {
+		if !isUsbTestDevice() {
+			SkipSo("ListDevices requires a connected device (MTPX_TEST_DEVICE=usb)")
+
+			return
+		}
+
+		devices, err := ListDevices()
+
+		So(err, ShouldBeNil)
+		So(len(devices), ShouldBeGreaterThan, 0)
+		So(devices[0].Bus, ShouldBeGreaterThan, 0)
+	})
+
+	Convey("Testing device selection", t, func() {
+		devices := []UsbDevice{
+			{VendorId: 0x18d1, ProductId: 0x4ee1, SerialNumber: "A1", Bus: 1, Address: 4},
+			{VendorId: 0x04e8, ProductId: 0x6860, SerialNumber: "B2", Bus: 2, Address: 7},
+			{VendorId: 0x04e8, ProductId: 0x6860, SerialNumber: "", Bus: 3, Address: 2},
+			{VendorId: 0x04e8, ProductId: 0x6860, SerialNumber: "", Bus: 3, Address: 5},
+		}
+
+		So(isDeviceSelected(Init{DebugMode: true}), ShouldBeFalse)
+		So(isDeviceSelected(Init{Bus: 1}), ShouldBeTrue)
+
+		Convey("by serial number", func() {
+			ud, err := findSelectedUsbDevice(Init{SerialNumber: "B2"}, devices)
+
+			So(err, ShouldBeNil)
+			So(ud, ShouldResemble, devices[1])
+		})
+
+		Convey("by VID:PID", func() {
+			ud, err := findSelectedUsbDevice(Init{VendorId: 0x18d1, ProductId: 0x4ee1}, devices)
+
+			So(err, ShouldBeNil)
+			So(ud, ShouldResemble, devices[0])
+
+			_, err = findSelectedUsbDevice(Init{VendorId: 0x04e8, ProductId: 0x6860}, devices)
+			So(err, ShouldBeError)
+		})
+
+		Convey("by bus address", func() {
+			ud, err := findSelectedUsbDevice(Init{Bus: 2, Address: 7}, devices)
+
+			So(err, ShouldBeNil)
+			So(ud, ShouldResemble, devices[1])
+
+			// identical devices without a serial number cannot be told apart
+			_, err = findSelectedUsbDevice(Init{Bus: 3, Address: 5}, devices)
+			So(err, ShouldBeError)
+		})
+
+		Convey("no match", func() {
+			_, err := findSelectedUsbDevice(Init{SerialNumber: "C3"}, devices)
+
+			So(err, ShouldBeError)
+		})
+	})
+}
@@ -1,9 +1,14 @@
 package mtpx
 
 import (
-	"errors"
+	"bufio"
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/usb"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,12 +16,19 @@ import (
 )
 
 // todo: work on documentations
-// todo: hotplug
 
 // initialize the mtp device
+// the first attached mtp device is opened unless a device is selected using the [init] selection fields
 // returns mtp device
 func Initialize(init Init) (*mtp.Device, error) {
-	dev, err := mtp.SelectDeviceWithDebugging("", init.DebugMode)
+	var dev *mtp.Device
+	var err error
+
+	if isDeviceSelected(init) {
+		dev, err = selectDevice(init)
+	} else {
+		dev, err = mtp.SelectDeviceWithDebugging("", init.DebugMode)
+	}
 
 	if err != nil {
 		return nil, MtpDetectFailedError{error: err}
@@ -35,13 +47,38 @@ func Initialize(init Init) (*mtp.Device, error) {
 	return dev, nil
 }
 
+// ListDevices - list the mtp devices attached to the usb bus
+// the devices are not claimed, so it is safe to call while a device is in use
+func ListDevices() ([]UsbDevice, error) {
+	c := usb.NewContext()
+	defer c.Exit()
+
+	l, err := c.GetDeviceList()
+	if err != nil {
+		return nil, MtpDetectFailedError{error: err}
+	}
+
+	if len(l) > 0 {
+		defer l.Done()
+	}
+
+	var devices []UsbDevice
+	for _, d := range l {
+		if ud, ok := fetchUsbDevice(d); ok {
+			devices = append(devices, ud)
+		}
+	}
+
+	return devices, nil
+}
+
 // Dispose - close the mtp device
-func Dispose(dev *mtp.Device) {
+func Dispose(dev Device) {
 	dev.Close()
 }
 
 // FetchDeviceInfo - fetch device Info
-func FetchDeviceInfo(dev *mtp.Device) (*mtp.DeviceInfo, error) {
+func FetchDeviceInfo(dev Device) (*mtp.DeviceInfo, error) {
 	info := mtp.DeviceInfo{}
 	err := dev.GetDeviceInfo(&info)
 
@@ -53,7 +90,7 @@ func FetchDeviceInfo(dev *mtp.Device) (*mtp.DeviceInfo, error) {
 }
 
 // FetchStorages - fetch storages
-func FetchStorages(dev *mtp.Device) ([]StorageData, error) {
+func FetchStorages(dev Device) ([]StorageData, error) {
 	sids := mtp.Uint32Array{}
 	if err := dev.GetStorageIDs(&sids); err != nil {
 		return nil, StorageInfoError{error: err}
@@ -82,7 +119,7 @@ func FetchStorages(dev *mtp.Device) ([]StorageData, error) {
 
 // MakeDirectory - create a new directory recursively using [fullPath]
 // The path will be created if it does not Exists
-func MakeDirectory(dev *mtp.Device, storageId uint32, fullPath string) (objectId uint32, err error) {
+func MakeDirectory(dev Device, storageId uint32, fullPath string) (objectId uint32, err error) {
 	_fullPath := fixSlash(fullPath)
 
 	if _fullPath == PathSep {
@@ -134,7 +171,7 @@ func MakeDirectory(dev *mtp.Device, storageId uint32, fullPath string) (objectId
 // [objectId]: objectId of the file/diectory
 // [totalFiles]: total number of files
 // [totalDirectories]: total number of directories
-func Walk(dev *mtp.Device, storageId uint32, fullPath string, recursive, skipDisallowedFiles,
+func Walk(dev Device, storageId uint32, fullPath string, recursive, skipDisallowedFiles,
 	skipHiddenFiles bool, cb WalkCb) (objectId uint32, totalFiles, totalDirectories int64, err error) {
 	// fetch the objectId from [objectId] and/or [fullPath] parameters
 	fi, err := GetObjectFromPath(dev, storageId, fullPath)
@@ -170,10 +207,20 @@ func Walk(dev *mtp.Device, storageId uint32, fullPath string, recursive, skipDis
 	return fi.ObjectId, totalFiles, totalDirectories, nil
 }
 
+// WalkContext - [Walk] which stops once [ctx] is done
+// returns a [CanceledError] along with the totals walked so far if [ctx] was canceled
+func WalkContext(ctx context.Context, dev Device, storageId uint32, fullPath string, recursive, skipDisallowedFiles,
+	skipHiddenFiles bool, cb WalkCb) (objectId uint32, totalFiles, totalDirectories int64, err error) {
+	objectId, totalFiles, totalDirectories, err = Walk(newContextDevice(ctx, dev), storageId, fullPath,
+		recursive, skipDisallowedFiles, skipHiddenFiles, cb)
+
+	return objectId, totalFiles, totalDirectories, canceledError(ctx, err)
+}
+
 // check if a file Exists
 // returns Exists: bool, isDir: bool, objectId: uint32
 // Since the [parentPath] is unavailable here the [fullPath] property of the resulting object [FileInfo] may not be valid.
-func FileExists(dev *mtp.Device, storageId uint32, fileProps []FileProp) (fc []FileExistsContainer, err error) {
+func FileExists(dev Device, storageId uint32, fileProps []FileProp) (fc []FileExistsContainer, err error) {
 	for _, fileProp := range fileProps {
 		fi, err := GetObjectFromObjectIdOrPath(dev, storageId, fileProp)
 
@@ -211,7 +258,7 @@ func FileExists(dev *mtp.Device, storageId uint32, fileProps []FileProp) (fc []F
 // if [objectId] is not available then [fullPath] will be used to fetch the [objectId]
 // dont leave both [objectId] and [fullPath] empty
 // Tip: use [objectId] whenever possible to avoid traversing down the whole file tree to process and find the [objectId]
-func DeleteFile(dev *mtp.Device, storageId uint32, fileProps []FileProp) error {
+func DeleteFile(dev Device, storageId uint32, fileProps []FileProp) error {
 	for _, fileProp := range fileProps {
 		fc, err := FileExists(dev, storageId, []FileProp{fileProp})
 		if err != nil {
@@ -230,14 +277,136 @@ func DeleteFile(dev *mtp.Device, storageId uint32, fileProps []FileProp) error {
 	return nil
 }
 
+// DeleteFileWithOptions - [DeleteFile] with the [options]
+// if [options.Trash] is true then the objects are moved into the hidden trash directory of the storage instead of being deleted,
+// use [ListTrash], [RestoreFromTrash] and [EmptyTrash] to manage them
+func DeleteFileWithOptions(dev Device, storageId uint32, fileProps []FileProp, options DeleteOptions) error {
+	if !options.Trash {
+		return DeleteFile(dev, storageId, fileProps)
+	}
+
+	for _, fileProp := range fileProps {
+		fi, err := GetObjectFromObjectIdOrPath(dev, storageId, fileProp)
+		if err != nil {
+			if isObjectNotFound(err) {
+				continue
+			}
+
+			return err
+		}
+
+		if err := trashObject(dev, storageId, fi); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoveAll - delete the files/directories along with their contents
+// [objectId] and [fullPath] are optional parameters
+// if [objectId] is not available then [fullPath] will be used to fetch the [objectId]
+// dont leave both [objectId] and [fullPath] empty
+// [cb] is called for each removed object, the contents of a directory are reported before the directory itself
+// if [dryRun] is true then the objects are reported without deleting them
+// a directory is deleted using a single DeleteObject, if the device cannot delete it since it is not empty (RC_PartialDeletion or RC_GeneralError) then its contents are deleted one by one bottom-up
+// returns a [FileNotFoundError] if an object does not Exists and a [FileObjectError] if it could not be deleted
+// return:
+// [totalFiles]: total removed files
+// [totalDirectories]: total removed directories
+func RemoveAll(dev Device, storageId uint32, fileProps []FileProp, dryRun bool, cb RemoveCb) (totalFiles, totalDirectories int64, err error) {
+	for _, fileProp := range fileProps {
+		fi, err := GetObjectFromObjectIdOrPath(dev, storageId, fileProp)
+		if err != nil {
+			if isObjectNotFound(err) {
+				return totalFiles, totalDirectories, FileNotFoundError{error: fmt.Errorf("file not found: %s. %w", fileProp.FullPath, err)}
+			}
+
+			return totalFiles, totalDirectories, err
+		}
+
+		if fi.ObjectId == ParentObjectId {
+			return totalFiles, totalDirectories, InvalidPathError{error: fmt.Errorf("invalid path: %s. the root directory cannot be removed", fileProp.FullPath)}
+		}
+
+		// list the objects in the order they are deleted
+		tree, err := listObjectTree(dev, fi)
+		if err != nil {
+			return totalFiles, totalDirectories, err
+		}
+
+		// report the removed object
+		removed := func(fi *FileInfo) error {
+			if fi.IsDir {
+				totalDirectories += 1
+			} else {
+				totalFiles += 1
+			}
+
+			return cb(fi, nil)
+		}
+
+		if dryRun {
+			for _, fi := range tree {
+				if err := removed(fi); err != nil {
+					return totalFiles, totalDirectories, err
+				}
+			}
+
+			continue
+		}
+
+		err = dev.DeleteObject(fi.ObjectId)
+		if err == nil {
+			for _, fi := range tree {
+				if err := removed(fi); err != nil {
+					return totalFiles, totalDirectories, err
+				}
+			}
+
+			continue
+		}
+
+		if err == mtp.RCError(mtp.RC_InvalidObjectHandle) {
+			return totalFiles, totalDirectories, FileNotFoundError{error: fmt.Errorf("file not found: %s. %w", fi.FullPath, err)}
+		}
+
+		// the device cannot delete the non-empty directory, delete the contents one by one
+		// the other refusals (eg: a write protected directory) are reported
+		if !fi.IsDir || !isNonEmptyDeleteRefused(err) {
+			return totalFiles, totalDirectories, FileObjectError{error: err}
+		}
+
+		for _, fi := range tree {
+			// the objects deleted by the failed attempt are gone already
+			err := dev.DeleteObject(fi.ObjectId)
+			if err != nil && err != mtp.RCError(mtp.RC_InvalidObjectHandle) {
+				if cbErr := cb(fi, err); cbErr != nil {
+					return totalFiles, totalDirectories, cbErr
+				}
+
+				return totalFiles, totalDirectories, FileObjectError{error: fmt.Errorf("unable to delete %s. %w", fi.FullPath, err)}
+			}
+
+			if err := removed(fi); err != nil {
+				return totalFiles, totalDirectories, err
+			}
+		}
+	}
+
+	return totalFiles, totalDirectories, nil
+}
+
 // Rename a file/directory
 // [objectId] and [fullPath] are optional parameters
 // if [objectId] is not available then [fullPath] will be used to fetch the [objectId]
 // dont leave both [objectId] and [fullPath] empty
 // Tip: use [objectId] whenever possible to avoid traversing down the whole file tree to process and find the [objectId]
+// renaming the object to its current name does nothing; the names are compared case insensitively like the devices do, so a change of the case alone is not applied
+// returns a [FileObjectError] if the device refuses the rename (the earlier versions ignored RC_GeneralError)
 // return
 // [objectId]: objectId of the file/diectory
-func RenameFile(dev *mtp.Device, storageId uint32, fileProp FileProp, newFileName string) (objectId uint32, err error) {
+func RenameFile(dev Device, storageId uint32, fileProp FileProp, newFileName string) (objectId uint32, err error) {
 	fc, err := FileExists(dev, storageId, []FileProp{fileProp})
 	if err != nil {
 		return 0, err
@@ -249,18 +418,215 @@ func RenameFile(dev *mtp.Device, storageId uint32, fileProp FileProp, newFileNam
 
 	fi := fc[0].FileInfo
 
+	// the devices refuse to rename an object to its own name with a general error
+	if strings.EqualFold(fi.Name, newFileName) {
+		return fi.ObjectId, nil
+	}
+
 	if err := dev.SetObjectPropValue(fi.ObjectId, mtp.OPC_ObjectFileName, &mtp.StringValue{Value: newFileName}); err != nil {
-		switch v := err.(type) {
-		case mtp.RCError:
-			if v == 0x2002 {
-				return fi.ObjectId, nil
+		return 0, FileObjectError{error: err}
+	}
+
+	return fi.ObjectId, nil
+}
+
+// MoveFile - move a file/directory into the directory [destination] of the same storage
+// see [MoveFileToStorage]
+func MoveFile(dev Device, storageId uint32, fileProp FileProp, destination string) (objectId uint32, err error) {
+	return MoveFileToStorage(dev, storageId, fileProp, storageId, destination)
+}
+
+// MoveFileToStorage - move a file/directory into the directory [destination] of the storage [destinationStorageId]
+// [objectId] and [fullPath] are optional parameters
+// if [objectId] is not available then [fullPath] will be used to fetch the [objectId]
+// dont leave both [objectId] and [fullPath] empty
+// the [destination] directory is created if it does not Exists
+// the MTP MoveObject operation is used if the device supports it,
+// otherwise the object is copied (directories recursively) and the source is deleted once the copy is complete, see [CopyFileToStorage] for the local disk space the copy needs
+// returns a [FileConflictError] if an object with the same name Exists in [destination]
+// returns an [InvalidPathError] if a directory is moved into itself
+// return:
+// [objectId]: objectId of the moved file/directory. it changes if the object was copied
+func MoveFileToStorage(dev Device, storageId uint32, fileProp FileProp, destinationStorageId uint32, destination string) (objectId uint32, err error) {
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, fileProp)
+	if err != nil {
+		return 0, err
+	}
+
+	if fi.ObjectId == ParentObjectId {
+		return 0, InvalidPathError{error: fmt.Errorf("invalid path: %s. the root directory cannot be moved", fileProp.FullPath)}
+	}
+
+	deviceInfo, err := FetchDeviceInfo(dev)
+	if err != nil {
+		return 0, err
+	}
+
+	destParentId, existing, err := prepareObjectDestination(dev, fi, destinationStorageId, destination)
+	if err != nil {
+		return 0, err
+	}
+
+	if existing != nil {
+		// the object is in [destination] already
+		if existing.ObjectId == fi.ObjectId {
+			return fi.ObjectId, nil
+		}
+
+		return 0, FileConflictError{error: fmt.Errorf("file already exists: %s", getFullPath(fixSlash(destination), fi.Name))}
+	}
+
+	if operationSupported(deviceInfo, mtp.OC_MoveObject) {
+		err := moveObject(dev, fi.ObjectId, destinationStorageId, destParentId)
+		if err == nil {
+			return fi.ObjectId, nil
+		}
+
+		// fall back to copying if the device lists the operation but refuses to run it
+		if err != mtp.RCError(mtp.RC_OperationNotSupported) {
+			return 0, FileObjectError{error: err}
+		}
+	}
+
+	cProps := newProcessCopyObjectsProps(destinationStorageId, operationSupported(deviceInfo, mtp.OC_MTP_SetObjectPropValue),
+		func(fi *ProgressInfo, err error) error {
+			return nil
+		},
+	)
+
+	objectId, err = copyObjectTree(dev, fi, destParentId, fixSlash(destination), cProps)
+	if err != nil {
+		// the source is left untouched
+		if objectId != 0 {
+			_ = dev.DeleteObject(objectId)
+		}
+
+		return 0, err
+	}
+
+	if err := dev.DeleteObject(fi.ObjectId); err != nil {
+		return objectId, FileObjectError{error: err}
+	}
+
+	return objectId, nil
+}
+
+// CopyFile - copy a file/directory into the directory [destination] of the same storage
+// see [CopyFileToStorage]
+func CopyFile(dev Device, storageId uint32, fileProp FileProp, destination string, progressCb ProgressCb) (objectId uint32, bulkFilesSent int64, bulkSizeSent int64, err error) {
+	return CopyFileToStorage(dev, storageId, fileProp, storageId, destination, progressCb)
+}
+
+// CopyFileToStorage - copy a file/directory into the directory [destination] of the storage [destinationStorageId]
+// [objectId] and [fullPath] are optional parameters
+// if [objectId] is not available then [fullPath] will be used to fetch the [objectId]
+// dont leave both [objectId] and [fullPath] empty
+// the [destination] directory is created if it does not Exists
+// the MTP CopyObject operation is used if the device supports it, [progressCb] is called once the device has copied the whole tree then.
+// otherwise each file is read from the device into a buffer and sent back to the device, directories are copied recursively
+// the files up to 16 MiB are buffered in the memory, the larger ones are spooled into a temporary file of the host (see [os.TempDir]),
+// so copying a file needs as much free local disk space as the size of the file; the temporary file is removed once the file is copied
+// the partial copy is deleted if the copy fails
+// returns a [FileConflictError] if an object with the same name Exists in [destination]
+// returns an [InvalidPathError] if a directory is copied into itself
+// return:
+// [objectId]: objectId of the copy
+// [bulkFilesSent]: total copied files (directory count not included)
+// [bulkSizeSent]: total size of the copied files
+func CopyFileToStorage(dev Device, storageId uint32, fileProp FileProp, destinationStorageId uint32, destination string, progressCb ProgressCb) (objectId uint32, bulkFilesSent int64, bulkSizeSent int64, err error) {
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, fileProp)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if fi.ObjectId == ParentObjectId {
+		return 0, 0, 0, InvalidPathError{error: fmt.Errorf("invalid path: %s. the root directory cannot be copied", fileProp.FullPath)}
+	}
+
+	deviceInfo, err := FetchDeviceInfo(dev)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	_destination := fixSlash(destination)
+	destParentId, existing, err := prepareObjectDestination(dev, fi, destinationStorageId, _destination)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if existing != nil {
+		return 0, 0, 0, FileConflictError{error: fmt.Errorf("file already exists: %s", getFullPath(_destination, fi.Name))}
+	}
+
+	cProps := newProcessCopyObjectsProps(destinationStorageId, operationSupported(deviceInfo, mtp.OC_MTP_SetObjectPropValue), progressCb)
+	pInfo := cProps.pInfo
+
+	// fetch the total number of files and their size
+	if fi.IsDir {
+		pInfo.TotalDirectories = 1
+		_totalFiles, _totalDirectories, err := proccessWalk(dev, fi.Info.StorageID, FileProp{fi.ObjectId, fi.FullPath}, true, false, false,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				pInfo.BulkFileSize.Total += fi.Size
+
+				return nil
+			},
+		)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+
+		pInfo.TotalFiles = _totalFiles
+		pInfo.TotalDirectories += _totalDirectories
+	} else {
+		pInfo.TotalFiles = 1
+		pInfo.BulkFileSize.Total = fi.Size
+	}
+
+	copied := false
+	if operationSupported(deviceInfo, mtp.OC_CopyObject) {
+		objectId, err = copyObject(dev, fi.ObjectId, destinationStorageId, destParentId)
+		if err == nil {
+			copied = true
+
+			// the device copied the whole tree at once
+			fi.FullPath = getFullPath(_destination, fi.Name)
+			fi.ParentPath = _destination
+			fi.ParentId = destParentId
+			fi.ObjectId = objectId
+
+			pInfo.FileInfo = fi
+			pInfo.FilesSent = pInfo.TotalFiles
+			pInfo.FilesSentProgress = 100
+			pInfo.BulkFileSize.Sent = pInfo.BulkFileSize.Total
+			pInfo.BulkFileSize.Progress = 100
+			pInfo.Speed = transferRate(pInfo.BulkFileSize.Total, pInfo.StartTime)
+
+			cProps.bulkFilesSent = pInfo.TotalFiles
+			cProps.bulkSizeSent = pInfo.BulkFileSize.Total
+
+			// fall back to copying the files if the device lists the operation but refuses to run it
+		} else if err != mtp.RCError(mtp.RC_OperationNotSupported) {
+			return 0, 0, 0, FileObjectError{error: err}
+		}
+	}
+
+	if !copied {
+		objectId, err = copyObjectTree(dev, fi, destParentId, _destination, cProps)
+		if err != nil {
+			if objectId != 0 {
+				_ = dev.DeleteObject(objectId)
 			}
+
+			return 0, cProps.bulkFilesSent, cProps.bulkSizeSent, err
 		}
+	}
 
-		return 0, FileObjectError{error: err}
+	pInfo.Status = Completed
+	if err := progressCb(pInfo, nil); err != nil {
+		return objectId, cProps.bulkFilesSent, cProps.bulkSizeSent, err
 	}
 
-	return fi.ObjectId, nil
+	return objectId, cProps.bulkFilesSent, cProps.bulkSizeSent, nil
 }
 
 // Transfer files from the local disk to the device
@@ -271,9 +637,33 @@ func RenameFile(dev *mtp.Device, storageId uint32, fileProp FileProp, newFileNam
 // [destinationObjectId]: objectId of [destination] directory
 // [bulkFilesSent]: total transferred files (directory count not included)
 // [bulkSizeSent]: total size of the uploaded files
-func UploadFiles(dev *mtp.Device, storageId uint32, sources []string, destination string, preprocessFiles bool, preprocessCb LocalPreprocessCb, progressCb ProgressCb) (destinationObjectId uint32, bulkFilesSent int64, bulkSizeSent int64, err error) {
+func UploadFiles(dev Device, storageId uint32, sources []string, destination string, preprocessFiles bool, preprocessCb LocalPreprocessCb, progressCb ProgressCb) (destinationObjectId uint32, bulkFilesSent int64, bulkSizeSent int64, err error) {
+	destinationObjectId, bulkFilesSent, bulkSizeSent, _, err = UploadFilesWithOptions(dev, storageId, sources, destination, preprocessFiles, UploadOptions{}, preprocessCb, progressCb)
+
+	return destinationObjectId, bulkFilesSent, bulkSizeSent, err
+}
+
+// UploadFilesWithOptions - [UploadFiles] with the [options] to resolve the conflicts with the existing files
+// the skipped and the renamed files are reported using [ProgressInfo.ConflictAction], [ProgressInfo.FilesSkipped] and [ProgressInfo.FilesRenamed]
+// the skipped files are not counted in [bulkFilesSent]
+// returns a [FileConflictError] if a conflict was resolved using [ConflictFail]
+// if [options.ContinueOnError] is true then the failed files are listed in [report] and the upload carries on with the next file,
+// the failed files are not counted in [bulkFilesSent] and [bulkSizeSent]
+// the upload is still aborted if it was canceled, [progressCb] returned an error or the session with the device was lost (eg: the device was disconnected)
+// if [options.Verify] is set then each uploaded file is verified; a mismatch is sent to [progressCb] and fails the file with a [FileVerificationError]
+// the mismatching object is deleted from the device
+// the object format code of each file is detected using its extension or its contents and restricted to the formats supported by the device,
+// [options.ObjectFormatCb] can override it
+// the modification times of the files and the directories are preserved using the [mtp.OPC_DateModified] prop if the device stamps them with the time of the upload,
+// the directories are stamped after their contents are written. [report.ModTimesPreserved] tells whether the device kept them
+// the checksum of a file is computed while it is sent and compared with the checksum of the object read back from the device
+// [report]: outcome of every file, it is returned along with the error too
+func UploadFilesWithOptions(dev Device, storageId uint32, sources []string, destination string, preprocessFiles bool, options UploadOptions, preprocessCb LocalPreprocessCb, progressCb ProgressCb) (destinationObjectId uint32, bulkFilesSent int64, bulkSizeSent int64, report *TransferReport, err error) {
 	_destination := fixSlash(destination)
 
+	reporter := newTransferReporter(options.ContinueOnError)
+	progressCb = reporter.progressCb(progressCb)
+
 	pInfo := ProgressInfo{
 		FileInfo:          &FileInfo{},
 		StartTime:         time.Now(),
@@ -324,7 +714,7 @@ func UploadFiles(dev *mtp.Device, storageId uint32, sources []string, destinatio
 		})
 
 		if err != nil {
-			return 0, bulkFilesSent, bulkSizeSent, err
+			return 0, bulkFilesSent, bulkSizeSent, reporter.report, err
 		}
 
 		totalFiles = _totalFiles
@@ -332,9 +722,19 @@ func UploadFiles(dev *mtp.Device, storageId uint32, sources []string, destinatio
 		totalSize = _totalSize
 	}
 
+	deviceInfo, err := FetchDeviceInfo(dev)
+	if err != nil {
+		return 0, bulkFilesSent, bulkSizeSent, reporter.report, err
+	}
+
+	canSetProps := operationSupported(deviceInfo, mtp.OC_MTP_SetObjectPropValue)
+
+	// the listings of the destination directories which are looked up for the conflicts
+	directoryListings := map[uint32]directoryListing{}
+
 	destParentId, err := MakeDirectory(dev, storageId, _destination)
 	if err != nil {
-		return 0, bulkFilesSent, bulkSizeSent, err
+		return 0, bulkFilesSent, bulkSizeSent, reporter.report, err
 	}
 
 	pInfo.TotalFiles = totalFiles
@@ -349,11 +749,23 @@ func UploadFiles(dev *mtp.Device, storageId uint32, sources []string, destinatio
 			_destination: destParentId,
 		}
 
+		// the modification times of the directories are applied once their contents are written
+		var directories []uploadedDirectory
+
 		// walk through the source
 		err = filepath.Walk(_source,
 			func(path string, fInfo os.FileInfo, err error) error {
+				sourceFilePath := fixSlash(path)
+
+				// map the local files path to the mtp files path
+				destinationParentPath, destinationFilePath := mapSourcePathToDestinationPath(
+					sourceFilePath, sourceParentPath, _destination,
+				)
+
 				if err != nil {
-					return err
+					reporter.begin(sourceFilePath, destinationFilePath, fInfo != nil && fInfo.IsDir(), 0)
+
+					return reporter.failed(err, transferError(err, "uploading files"), 0)
 				}
 
 				name := fInfo.Name()
@@ -368,23 +780,27 @@ func UploadFiles(dev *mtp.Device, storageId uint32, sources []string, destinatio
 					return nil
 				}
 
-				sourceFilePath := fixSlash(path)
-
-				// map the local files path to the mtp files path
-				destinationParentPath, destinationFilePath := mapSourcePathToDestinationPath(
-					sourceFilePath, sourceParentPath, _destination,
-				)
-
 				size := fInfo.Size()
 				isDir := fInfo.IsDir()
 
 				// if the object is a directory then create a directory using [MakeDirectory] or [MakeDirectory]
 				if isDir {
+					reporter.begin(sourceFilePath, destinationFilePath, true, 0)
+
+					// the contents of a directory which could not be made are skipped
+					directoryFailed := func(err error) error {
+						if err := reporter.failed(err, transferError(err, "uploading files"), 0); err != nil {
+							return err
+						}
+
+						return filepath.SkipDir
+					}
+
 					// if the parent path Exists within the [destinationFilesDict] then fetch the [parentId] (value) and make the destination directory
 					if _, ok := destinationFilesDict[destinationParentPath]; ok {
 						objId, err := MakeDirectory(dev, storageId, destinationFilePath)
 						if err != nil {
-							return err
+							return directoryFailed(err)
 						}
 
 						// append the current objectId to [destinationFilesDict]
@@ -395,17 +811,40 @@ func UploadFiles(dev *mtp.Device, storageId uint32, sources []string, destinatio
 					} else {
 						objId, err := MakeDirectory(dev, storageId, _destination)
 						if err != nil {
-							return err
+							return directoryFailed(err)
 						}
 
 						// append the current objectId to [destinationFilesDict]
 						destinationFilesDict[destinationFilePath] = objId
 					}
 
+					directories = append(directories, uploadedDirectory{
+						objectId: destinationFilesDict[destinationFilePath],
+						modTime:  fInfo.ModTime(),
+					})
+
 					return nil
 				}
 
 				/// if the object is a file then create a file
+				reporter.begin(sourceFilePath, destinationFilePath, false, size)
+
+				var prevSentSize int64 = 0
+
+				// the failed file is not counted in [bulkFilesSent] and [bulkSizeSent] if the upload carries on
+				fileFailed := func(err error, counted bool) error {
+					if err := reporter.failed(err, transferError(err, "uploading files"), prevSentSize); err != nil {
+						return err
+					}
+
+					if counted {
+						bulkFilesSent -= 1
+						bulkSizeSent -= prevSentSize
+					}
+
+					return nil
+				}
+
 				var fileParentId uint32
 
 				_parentId, ok := destinationFilesDict[destinationParentPath]
@@ -418,7 +857,7 @@ func UploadFiles(dev *mtp.Device, storageId uint32, sources []string, destinatio
 					objId, err := MakeDirectory(dev, storageId, destinationParentPath)
 
 					if err != nil {
-						return err
+						return fileFailed(err, false)
 					}
 
 					// append the current objectId to [destinationFilesDict]
@@ -430,28 +869,74 @@ func UploadFiles(dev *mtp.Device, storageId uint32, sources []string, destinatio
 				// read the local file
 				fileBuf, err := os.Open(sourceFilePath)
 				if err != nil {
-					return InvalidPathError{error: err}
+					return fileFailed(InvalidPathError{error: err}, false)
 				}
 				defer fileBuf.Close()
 
-				var compressedSize uint32
+				header := make([]byte, contentSniffSize)
+				n, err := fileBuf.ReadAt(header, 0)
+				if err != nil && err != io.EOF {
+					return fileFailed(err, false)
+				}
 
-				// assign compressedSize of the file
-				if size > 0xFFFFFFFF {
-					compressedSize = 0xFFFFFFFF
-				} else {
-					compressedSize = uint32(size)
+				objectFormat := detectObjectFormat(name, header[:n], deviceInfo.PlaybackFormats)
+				if options.ObjectFormatCb != nil {
+					if objectFormat, err = options.ObjectFormatCb(&fInfo, sourceFilePath, objectFormat); err != nil {
+						return fileFailed(err, false)
+					}
 				}
 
 				fObj := mtp.ObjectInfo{
 					StorageID:        storageId,
-					ObjectFormat:     mtp.OFC_Undefined,
+					ObjectFormat:     objectFormat,
 					ParentObject:     fileParentId,
 					Filename:         name,
-					CompressedSize:   compressedSize,
+					CompressedSize:   compressedSize(size),
 					ModificationDate: fInfo.ModTime(),
 				}
 
+				// each destination directory is listed once, the listing is kept up to date by [handleMakeFile]
+				listing, ok := directoryListings[fileParentId]
+				if !ok {
+					if listing, err = listDirectory(dev, storageId, fileParentId); err != nil {
+						return fileFailed(err, false)
+					}
+
+					directoryListings[fileParentId] = listing
+				}
+
+				// resolve the conflict with an existing file of the same name
+				conflictAction, err := handleUploadConflict(dev, listing, &fObj, fInfo, sourceFilePath, destinationFilePath, &options)
+				if err != nil {
+					return fileFailed(err, false)
+				}
+
+				pInfo.ConflictAction = conflictAction
+
+				switch conflictAction {
+				case ConflictSkip:
+					pInfo.FilesSkipped += 1
+					pInfo.FileInfo = &FileInfo{
+						Info:       &fObj,
+						Size:       size,
+						ModTime:    fObj.ModificationDate,
+						Name:       fObj.Filename,
+						FullPath:   destinationFilePath,
+						ParentPath: destinationParentPath,
+						Extension:  extension(fObj.Filename, isDir),
+						ParentId:   fObj.ParentObject,
+					}
+
+					reporter.skipped()
+
+					return progressCb(&pInfo, nil)
+
+				case ConflictRename:
+					pInfo.FilesRenamed += 1
+					destinationFilePath = getFullPath(destinationParentPath, fObj.Filename)
+					reporter.item.DestinationPath = destinationFilePath
+				}
+
 				// keep track of [bulkFilesSent]
 				bulkFilesSent += 1
 
@@ -468,11 +953,17 @@ func UploadFiles(dev *mtp.Device, storageId uint32, sources []string, destinatio
 				}
 				pInfo.LatestSentTime = time.Now()
 
+				// hash the file while it is sent
+				checksum := sha256.New()
+				var fileReader io.Reader = fileBuf
+				if options.Verify == VerifyChecksum {
+					fileReader = io.TeeReader(fileBuf, checksum)
+				}
+
 				// create file
-				var prevSentSize int64 = 0
 				objId, err := handleMakeFile(
-					dev, storageId, &fObj, &fInfo, fileBuf,
-					true,
+					dev, storageId, &fObj, fileReader, size,
+					true, canSetProps, listing,
 					func(total, sent int64, objId uint32, err error) error {
 						if err != nil {
 							return err
@@ -502,9 +993,42 @@ func UploadFiles(dev *mtp.Device, storageId uint32, sources []string, destinatio
 				)
 
 				if err != nil {
-					return err
+					// the failed upload may have left objects behind, the directory is listed again
+					delete(directoryListings, fileParentId)
+
+					return fileFailed(err, true)
 				}
 
+				if options.Verify != VerifyNone {
+					err := verifyObject(dev, objId, destinationFilePath, size, checksum.Sum(nil), options.Verify)
+					if err != nil {
+						// the corrupted object is not left on the device
+						_ = dev.DeleteObject(objId)
+						delete(directoryListings, fileParentId)
+
+						// report the mismatch in the progress stream, an error returned by [progressCb] aborts the upload
+						if cbErr := progressCb(&pInfo, err); cbErr != nil {
+							_ = fileFailed(err, true)
+
+							return cbErr
+						}
+
+						return fileFailed(err, true)
+					}
+
+					pInfo.FilesVerified += 1
+				}
+
+				modTimePreserved, err := preserveObjectModTime(dev, objId, fInfo.ModTime(), canSetProps)
+				if err != nil {
+					return fileFailed(err, true)
+				}
+
+				reporter.item.ModTimePreserved = modTimePreserved
+				reporter.modTimeChecked(modTimePreserved)
+
+				reporter.succeeded(size)
+
 				pInfo.FilesSent = bulkFilesSent
 				pInfo.FilesSentProgress = Percent(float32(bulkFilesSent), float32(totalFiles))
 
@@ -518,45 +1042,197 @@ func UploadFiles(dev *mtp.Device, storageId uint32, sources []string, destinatio
 		)
 
 		if err != nil {
-			switch err.(type) {
-			case InvalidPathError:
-				return destParentId, bulkFilesSent, bulkSizeSent, err
+			return destParentId, bulkFilesSent, bulkSizeSent, reporter.report, transferError(err, "uploading files")
+		}
 
-			case *os.PathError:
-				if errors.Is(err, os.ErrPermission) {
-					return destParentId, bulkFilesSent, bulkSizeSent, FilePermissionError{error: err}
-				}
+		// the children are written before their parents
+		for i := len(directories) - 1; i >= 0; i-- {
+			modTimePreserved, err := preserveObjectModTime(dev, directories[i].objectId, directories[i].modTime, canSetProps)
+			if err != nil {
+				return destParentId, bulkFilesSent, bulkSizeSent, reporter.report, transferError(err, "uploading files")
+			}
 
-				if errors.Is(err, os.ErrNotExist) {
-					return destParentId, bulkFilesSent, bulkSizeSent, InvalidPathError{error: err}
-				}
+			reporter.modTimeChecked(modTimePreserved)
+		}
+	}
 
-				return destParentId, bulkFilesSent, bulkSizeSent, LocalFileError{error: err}
-			default:
-				return destParentId, bulkFilesSent, bulkSizeSent,
-					FileTransferError{error: fmt.Errorf("an error occured while uploading files. %+v", err.Error())}
+	pInfo.Status = Completed
+	if err := progressCb(&pInfo, nil); err != nil {
+		return destParentId, bulkFilesSent, bulkSizeSent, reporter.report, err
+	}
+
+	return destParentId, bulkFilesSent, bulkSizeSent, reporter.report, nil
+}
+
+// UploadFilesContext - [UploadFiles] which stops once [ctx] is done
+// the transfer is aborted between the usb chunks and the partially sent object is deleted
+// returns a [CanceledError] along with the totals sent so far if [ctx] was canceled
+func UploadFilesContext(ctx context.Context, dev Device, storageId uint32, sources []string, destination string, preprocessFiles bool, preprocessCb LocalPreprocessCb, progressCb ProgressCb) (destinationObjectId uint32, bulkFilesSent int64, bulkSizeSent int64, err error) {
+	destinationObjectId, bulkFilesSent, bulkSizeSent, err = UploadFiles(newContextDevice(ctx, dev), storageId, sources, destination,
+		preprocessFiles, preprocessCb, progressCb)
+
+	return destinationObjectId, bulkFilesSent, bulkSizeSent, canceledError(ctx, err)
+}
+
+// UploadStream - transfer [size] bytes of [r] to the device as the file [name]
+// parent: objectId or fullPath of the destination directory. the directory is created if only [fullPath] is given and it does not Exists
+// an existing file with the same [name] is overwritten
+// the object format code is detected using the extension of [name] or the leading bytes of [r]
+// [modTime] is set using the [mtp.OPC_DateModified] prop if the device stamps the file with the time of the upload and it supports setting the props
+// use [UploadStreamSpooled] if the size of [r] is unknown
+// return:
+// [objectId]: objectId of the uploaded file
+func UploadStream(dev Device, storageId uint32, parent FileProp, name string, r io.Reader, size int64, modTime time.Time, progressCb ProgressCb) (objectId uint32, err error) {
+	parentId, parentPath, err := handleUploadParent(dev, storageId, parent)
+	if err != nil {
+		return 0, err
+	}
+
+	deviceInfo, err := FetchDeviceInfo(dev)
+	if err != nil {
+		return 0, err
+	}
+
+	canSetProps := operationSupported(deviceInfo, mtp.OC_MTP_SetObjectPropValue)
+
+	// peek at the leading bytes of the stream to detect its format
+	br := bufio.NewReaderSize(r, contentSniffSize)
+	header, _ := br.Peek(contentSniffSize)
+	r = br
+
+	fObj := mtp.ObjectInfo{
+		StorageID:        storageId,
+		ObjectFormat:     detectObjectFormat(name, header, deviceInfo.PlaybackFormats),
+		ParentObject:     parentId,
+		Filename:         name,
+		CompressedSize:   compressedSize(size),
+		ModificationDate: modTime,
+	}
+
+	pInfo := ProgressInfo{
+		FileInfo: &FileInfo{
+			Info:       &fObj,
+			Size:       size,
+			ModTime:    modTime,
+			Name:       name,
+			FullPath:   getFullPath(parentPath, name),
+			ParentPath: parentPath,
+			Extension:  extension(name, false),
+			ParentId:   parentId,
+		},
+		StartTime:      time.Now(),
+		LatestSentTime: time.Now(),
+		TotalFiles:     1,
+		ActiveFileSize: &TransferSizeInfo{},
+		BulkFileSize:   &TransferSizeInfo{Total: size},
+		Status:         InProgress,
+	}
+
+	var prevSentSize int64 = 0
+	objectId, err = handleMakeFile(dev, storageId, &fObj, r, size, true, canSetProps, nil,
+		func(total, sent int64, objId uint32, err error) error {
+			if err != nil {
+				return err
 			}
-		}
+
+			pInfo.FileInfo.ObjectId = objId
+			pInfo.ActiveFileSize.Total = total
+			pInfo.ActiveFileSize.Sent = sent
+			pInfo.ActiveFileSize.Progress = Percent(float32(sent), float32(total))
+
+			chunkSize := sent - prevSentSize
+
+			pInfo.BulkFileSize.Sent = sent
+			pInfo.BulkFileSize.Progress = pInfo.ActiveFileSize.Progress
+
+			pInfo.Speed = transferRate(chunkSize, pInfo.LatestSentTime)
+			if err = progressCb(&pInfo, nil); err != nil {
+				return err
+			}
+
+			pInfo.LatestSentTime = time.Now()
+			prevSentSize = sent
+
+			return nil
+		},
+	)
+	if err != nil {
+		return objectId, FileTransferError{error: fmt.Errorf("an error occured while uploading the stream. %w", err)}
+	}
+
+	if _, err := preserveObjectModTime(dev, objectId, modTime, canSetProps); err != nil {
+		return objectId, FileTransferError{error: fmt.Errorf("an error occured while uploading the stream. %w", err)}
 	}
 
+	pInfo.FileInfo.ObjectId = objectId
+	pInfo.FilesSent = 1
+	pInfo.FilesSentProgress = 100
 	pInfo.Status = Completed
 	if err := progressCb(&pInfo, nil); err != nil {
-		return destParentId, bulkFilesSent, bulkSizeSent, err
+		return objectId, err
 	}
 
-	return destParentId, bulkFilesSent, bulkSizeSent, nil
+	return objectId, nil
+}
+
+// UploadStreamSpooled - [UploadStream] for a reader of unknown size
+// [r] is copied to a temporary file first to find its size, the temporary file is removed afterwards
+func UploadStreamSpooled(dev Device, storageId uint32, parent FileProp, name string, r io.Reader, modTime time.Time, progressCb ProgressCb) (objectId uint32, err error) {
+	spool, err := ioutil.TempFile("", spoolFilePattern)
+	if err != nil {
+		return 0, LocalFileError{error: err}
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	size, err := io.Copy(spool, r)
+	if err != nil {
+		return 0, LocalFileError{error: err}
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return 0, LocalFileError{error: err}
+	}
+
+	return UploadStream(dev, storageId, parent, name, spool, size, modTime, progressCb)
 }
 
 // Transfer files from the device to the local disk
 // sources: can be the list of files/directories that are to be sent to the local disk
 // destination: fullPath to the destination directory
+// if [preprocessFiles] is true then the files are downloaded in the order they were sent to [preprocessCb]
+// an interrupted download leaves a hidden temporary file ("."+name+".mtpx-part") next to the destination file,
+// it is continued or removed only by a later download of the same file, so the caller has to remove it if the download is never retried
 // return:
 // [totalFiles]: total transferred files (directory count not included)
 // [totalSize]: total size of the uploaded files
-func DownloadFiles(dev *mtp.Device, storageId uint32, sources []string, destination string,
+func DownloadFiles(dev Device, storageId uint32, sources []string, destination string,
 	preprocessFiles bool, preprocessCb MtpPreprocessCb, progressCb ProgressCb) (bulkFilesSent int64, bulkSizeSent int64, err error) {
+	bulkFilesSent, bulkSizeSent, _, err = DownloadFilesWithOptions(dev, storageId, sources, destination, preprocessFiles, DownloadOptions{}, preprocessCb, progressCb)
+
+	return bulkFilesSent, bulkSizeSent, err
+}
+
+// DownloadFilesWithOptions - [DownloadFiles] with the [options] to resolve the conflicts with the existing local files
+// the skipped and the renamed files are reported using [ProgressInfo.ConflictAction], [ProgressInfo.FilesSkipped] and [ProgressInfo.FilesRenamed]
+// the skipped files are not counted in [bulkFilesSent]
+// the files are downloaded into hidden temporary files which are renamed into place once they are complete
+// the temporary file left by an interrupted download is continued by the next download of the file, it is removed if the file is skipped,
+// it is left behind if the file is never downloaded again
+// returns a [FileConflictError] if a conflict was resolved using [ConflictFail]
+// if [options.ContinueOnError] is true then the failed files are listed in [report] and the download carries on with the next file,
+// the failed files are not counted in [bulkFilesSent] and [bulkSizeSent]
+// the download is still aborted if it was canceled, [progressCb] returned an error or the session with the device was lost (eg: the device was disconnected)
+// if [options.Verify] is set then each downloaded file is verified; a mismatch is sent to [progressCb] and fails the file with a [FileVerificationError]
+// the checksum of the local file is compared with the checksum of the object read back from the device, the mismatching local file is kept
+// [report]: outcome of every file, it is returned along with the error too
+func DownloadFilesWithOptions(dev Device, storageId uint32, sources []string, destination string,
+	preprocessFiles bool, options DownloadOptions, preprocessCb MtpPreprocessCb, progressCb ProgressCb) (bulkFilesSent int64, bulkSizeSent int64, report *TransferReport, err error) {
 	_destination := fixSlash(destination)
 
+	reporter := newTransferReporter(options.ContinueOnError)
+	progressCb = reporter.progressCb(progressCb)
+
 	pInfo := ProgressInfo{
 		FileInfo:          &FileInfo{},
 		StartTime:         time.Now(),
@@ -587,6 +1263,9 @@ func DownloadFiles(dev *mtp.Device, storageId uint32, sources []string, destinat
 	var totalSize int64 = 0
 
 	var cache = downloadFilesObjectCache{}
+
+	// the keys of [cache] in the order the objects were preprocessed, they are downloaded in the same order
+	var cacheOrder []string
 	if preprocessFiles {
 		for _, source := range sources {
 			_source := fixSlash(source)
@@ -602,6 +1281,10 @@ func DownloadFiles(dev *mtp.Device, storageId uint32, sources []string, destinat
 						fi.FullPath, sourceParentPath, _destination,
 					)
 
+					if _, ok := cache[destinationFilePath]; !ok {
+						cacheOrder = append(cacheOrder, destinationFilePath)
+					}
+
 					cache[destinationFilePath] = downloadFilesObjectCacheContainer{
 						fileInfo:                  fi,
 						sourceParentPath:          sourceParentPath,
@@ -628,7 +1311,7 @@ func DownloadFiles(dev *mtp.Device, storageId uint32, sources []string, destinat
 				})
 
 			if err != nil {
-				return bulkFilesSent, bulkSizeSent, err
+				return bulkFilesSent, bulkSizeSent, reporter.report, err
 			}
 
 			totalFiles += _totalFiles
@@ -645,10 +1328,13 @@ func DownloadFiles(dev *mtp.Device, storageId uint32, sources []string, destinat
 		bulkSizeSent:  bulkSizeSent,
 		totalFiles:    totalFiles,
 		totalSize:     totalSize,
+		options:       &options,
+		reporter:      reporter,
 	}
 
 	if len(cache) > 0 {
-		for _, c := range cache {
+		for _, destinationFilePath := range cacheOrder {
+			c := cache[destinationFilePath]
 			dfProps.sourceParentPath = c.sourceParentPath
 			dfProps.destinationFileParentPath = c.destinationFileParentPath
 			dfProps.destinationFilePath = c.destinationFilePath
@@ -665,7 +1351,7 @@ func DownloadFiles(dev *mtp.Device, storageId uint32, sources []string, destinat
 
 			_, err := GetObjectFromPath(dev, storageId, _source)
 			if err != nil {
-				return dfProps.bulkFilesSent, dfProps.bulkSizeSent, err
+				return dfProps.bulkFilesSent, dfProps.bulkSizeSent, reporter.report, err
 			}
 
 			_, _, _, wErr := Walk(dev, storageId, _source, true, true, false,
@@ -693,10 +1379,67 @@ func DownloadFiles(dev *mtp.Device, storageId uint32, sources []string, destinat
 
 	pInfo.Status = Completed
 	if err := progressCb(&pInfo, nil); err != nil {
-		return dfProps.bulkFilesSent, dfProps.bulkSizeSent, err
+		return dfProps.bulkFilesSent, dfProps.bulkSizeSent, reporter.report, err
+	}
+
+	return dfProps.bulkFilesSent, dfProps.bulkSizeSent, reporter.report, nil
+}
+
+// DownloadFilesContext - [DownloadFiles] which stops once [ctx] is done
+// the transfer is aborted between the usb chunks and the partially written local file is removed
+// returns a [CanceledError] along with the totals received so far if [ctx] was canceled
+func DownloadFilesContext(ctx context.Context, dev Device, storageId uint32, sources []string, destination string,
+	preprocessFiles bool, preprocessCb MtpPreprocessCb, progressCb ProgressCb) (bulkFilesSent int64, bulkSizeSent int64, err error) {
+	bulkFilesSent, bulkSizeSent, err = DownloadFiles(newContextDevice(ctx, dev), storageId, sources, destination,
+		preprocessFiles, preprocessCb, progressCb)
+
+	return bulkFilesSent, bulkSizeSent, canceledError(ctx, err)
+}
+
+// DownloadTo - transfer the contents of a device file to [w]
+// [fileProp] accepts either the objectId or the fullPath of the file, like [FileExists]
+// return:
+// [written]: number of bytes written to [w]
+func DownloadTo(dev Device, storageId uint32, fileProp FileProp, w io.Writer, progressCb SizeProgressCb) (written int64, err error) {
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, fileProp)
+	if err != nil {
+		return 0, err
+	}
+
+	if fi.IsDir {
+		return 0, InvalidPathError{error: fmt.Errorf("the object %d is a directory", fi.ObjectId)}
+	}
+
+	cw := &countingWriter{w: w}
+
+	var totalSent int64 = 0
+	err = dev.GetObject(fi.ObjectId, cw, func(sent int64) error {
+		if err := progressCb(fi.Size, sent, fi.ObjectId, nil); err != nil {
+			return err
+		}
+
+		totalSent = sent
+
+		return nil
+	})
+	if err != nil {
+		return cw.n, FileTransferError{error: fmt.Errorf("an error occured while downloading the file. %w", err)}
+	}
+
+	if cw.n != fi.Size {
+		return cw.n, FileSizeMismatchError{
+			error: fmt.Errorf("%d bytes of the object %d were received, expected %d bytes", cw.n, fi.ObjectId, fi.Size),
+		}
+	}
+
+	// fix the incorrect sent size
+	if totalSent < fi.Size {
+		if err := progressCb(fi.Size, fi.Size, fi.ObjectId, nil); err != nil {
+			return cw.n, err
+		}
 	}
 
-	return dfProps.bulkFilesSent, dfProps.bulkSizeSent, nil
+	return cw.n, nil
 }
 
 func main() {}
@@ -0,0 +1,115 @@
+package mtpx
+
+import (
+	"bytes"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPreserveModTimes(t *testing.T) {
+	if isUsbTestDevice() {
+		t.Skip("the modification time tests require the simulated device")
+	}
+
+	const destination = "/mtp-test-files/temp_dir/test_PreserveModTimes"
+
+	// a simulated device which stamps the uploaded objects with the time of the upload
+	newStampingDevice := func(canSetProps bool) (*mtpxtest.Device, uint32) {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		sim := dev.(*mtpxtest.Device)
+		sim.StampModificationDate = true
+
+		if !canSetProps {
+			removeOperation(sim, mtp.OC_MTP_SetObjectPropValue)
+		}
+
+		storages, err := FetchStorages(sim)
+		So(err, ShouldBeNil)
+
+		return sim, storages[0].Sid
+	}
+
+	upload := func(dev Device, sid uint32) (*TransferReport, error) {
+		_, _, report, err := uploadTestMockDir1(dev, sid, destination, UploadOptions{}, nil)
+
+		return report, err
+	}
+
+	modTimeOf := func(dev Device, sid uint32, fullPath string) string {
+		fi, err := GetObjectFromPath(dev, sid, fullPath)
+		So(err, ShouldBeNil)
+
+		return fi.ModTime.Format(mtpDateFormat)
+	}
+
+	localModTimeOf := func(fullPath string) string {
+		fi, err := os.Stat(fullPath)
+		So(err, ShouldBeNil)
+
+		return fi.ModTime().Format(mtpDateFormat)
+	}
+
+	Convey("Preserve the modification times of the uploaded files | UploadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		report, err := upload(dev, sid)
+		So(err, ShouldBeNil)
+		So(report.ModTimesPreserved, ShouldBeTrue)
+		So(report.Succeeded, ShouldHaveLength, mockDir1TotalFiles)
+
+		for _, item := range report.Succeeded {
+			So(item.ModTimePreserved, ShouldBeTrue)
+		}
+	})
+
+	Convey("Set the modification times of a stamping device | UploadFilesWithOptions", t, func() {
+		dev, sid := newStampingDevice(true)
+		source := getTestMocksAsset("mock_dir1")
+
+		report, err := upload(dev, sid)
+		So(err, ShouldBeNil)
+		So(report.ModTimesPreserved, ShouldBeTrue)
+
+		for _, item := range report.Succeeded {
+			So(item.ModTimePreserved, ShouldBeTrue)
+			So(modTimeOf(dev, sid, item.DestinationPath), ShouldEqual, localModTimeOf(item.SourcePath))
+		}
+
+		// the directories are stamped after their contents
+		So(modTimeOf(dev, sid, destination+"/mock_dir1"), ShouldEqual, localModTimeOf(source))
+		So(modTimeOf(dev, sid, destination+"/mock_dir1/3/2"), ShouldEqual, localModTimeOf(source+"/3/2"))
+	})
+
+	Convey("The device cannot set the modification times | UploadFilesWithOptions", t, func() {
+		dev, sid := newStampingDevice(false)
+
+		report, err := upload(dev, sid)
+		So(err, ShouldBeNil)
+		So(report.ModTimesPreserved, ShouldBeFalse)
+		So(report.Succeeded, ShouldHaveLength, mockDir1TotalFiles)
+
+		for _, item := range report.Succeeded {
+			So(item.ModTimePreserved, ShouldBeFalse)
+		}
+	})
+
+	Convey("Preserve the modification time of a stream | UploadStream", t, func() {
+		dev, sid := newStampingDevice(true)
+
+		modTime := time.Date(2019, 5, 6, 7, 8, 9, 0, time.Local)
+		data := []byte("stream")
+		_, err := UploadStream(dev, sid, FileProp{0, destination}, "stream.txt", bytes.NewReader(data), int64(len(data)), modTime,
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+		So(modTimeOf(dev, sid, destination+"/stream.txt"), ShouldEqual, modTime.Format(mtpDateFormat))
+	})
+}
@@ -0,0 +1,178 @@
+package mtpx
+
+import (
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"testing"
+)
+
+// remove [opCode] from the operations supported by the simulated device
+func removeOperation(sim *mtpxtest.Device, opCode uint16) {
+	var operations []uint16
+	for _, code := range sim.DeviceInfo.OperationsSupported {
+		if code != opCode {
+			operations = append(operations, code)
+		}
+	}
+
+	sim.DeviceInfo.OperationsSupported = operations
+}
+
+func TestMoveFile(t *testing.T) {
+	if isUsbTestDevice() {
+		t.Skip("the move tests require the simulated device")
+	}
+
+	const destination = "/mtp-test-files/temp_dir/test_MoveFile"
+
+	newMoveTestDevice := func(canMove bool) (*mtpxtest.Device, uint32, uint32) {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		sim := dev.(*mtpxtest.Device)
+		if !canMove {
+			removeOperation(sim, mtp.OC_MoveObject)
+		}
+
+		storages, err := FetchStorages(sim)
+		So(err, ShouldBeNil)
+
+		return sim, storages[0].Sid, storages[1].Sid
+	}
+
+	Convey("Move a file | MoveFile", t, func() {
+		sim, sid, _ := newMoveTestDevice(true)
+		dev := mtpxtest.NewFaultInjector(sim)
+
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/mock_dir1/a.txt")
+		So(err, ShouldBeNil)
+
+		objectId, err := MoveFile(dev, sid, FileProp{0, "/mtp-test-files/mock_dir1/a.txt"}, destination)
+		So(err, ShouldBeNil)
+		So(objectId, ShouldEqual, fi.ObjectId)
+		So(dev.Calls(mtpxtest.OpRunTransaction), ShouldEqual, 1)
+		So(dev.Calls(mtpxtest.OpSendObject), ShouldEqual, 0)
+
+		_, ok := sim.Lookup(sid, "/mtp-test-files/mock_dir1/a.txt")
+		So(ok, ShouldBeFalse)
+
+		data, err := sim.ReadFile(sid, destination+"/a.txt")
+		So(err, ShouldBeNil)
+		So(data, ShouldResemble, readTestMocksAsset("mock_dir1/a.txt"))
+
+		// the file is in [destination] already
+		objectId, err = MoveFile(dev, sid, FileProp{objectId, ""}, destination)
+		So(err, ShouldBeNil)
+		So(objectId, ShouldEqual, fi.ObjectId)
+	})
+
+	Convey("Move a directory to another storage | MoveFileToStorage", t, func() {
+		sim, sid, sdCardSid := newMoveTestDevice(true)
+
+		dirId, ok := sim.Lookup(sid, "/mtp-test-files/mock_dir1")
+		So(ok, ShouldBeTrue)
+
+		objectId, err := MoveFileToStorage(sim, sid, FileProp{dirId, ""}, sdCardSid, destination)
+		So(err, ShouldBeNil)
+		So(objectId, ShouldEqual, dirId)
+
+		_, ok = sim.Lookup(sid, "/mtp-test-files/mock_dir1")
+		So(ok, ShouldBeFalse)
+
+		data, err := sim.ReadFile(sdCardSid, destination+"/mock_dir1/3/2/b.txt")
+		So(err, ShouldBeNil)
+		So(data, ShouldResemble, readTestMocksAsset("mock_dir1/3/2/b.txt"))
+	})
+
+	Convey("Copy and delete if the device cannot move objects | MoveFileToStorage", t, func() {
+		sim, sid, sdCardSid := newMoveTestDevice(false)
+
+		source, err := GetObjectFromPath(sim, sid, "/mtp-test-files/mock_dir1/3")
+		So(err, ShouldBeNil)
+		sourceFile, err := GetObjectFromPath(sim, sid, "/mtp-test-files/mock_dir1/3/2/b.txt")
+		So(err, ShouldBeNil)
+
+		objectId, err := MoveFileToStorage(sim, sid, FileProp{0, "/mtp-test-files/mock_dir1/3"}, sdCardSid, destination)
+		So(err, ShouldBeNil)
+		So(objectId, ShouldNotEqual, source.ObjectId)
+
+		_, ok := sim.Lookup(sid, "/mtp-test-files/mock_dir1/3")
+		So(ok, ShouldBeFalse)
+
+		moved, err := GetObjectFromPath(sim, sdCardSid, destination+"/3")
+		So(err, ShouldBeNil)
+		So(moved.ObjectId, ShouldEqual, objectId)
+		So(moved.IsDir, ShouldBeTrue)
+
+		movedFile, err := GetObjectFromPath(sim, sdCardSid, destination+"/3/2/b.txt")
+		So(err, ShouldBeNil)
+		So(movedFile.Size, ShouldEqual, sourceFile.Size)
+		So(movedFile.ModTime.Format(mtpDateFormat), ShouldEqual, sourceFile.ModTime.Format(mtpDateFormat))
+		So(movedFile.Info.ObjectFormat, ShouldEqual, sourceFile.Info.ObjectFormat)
+
+		data, err := sim.ReadFile(sdCardSid, destination+"/3/2/b.txt")
+		So(err, ShouldBeNil)
+		So(data, ShouldResemble, readTestMocksAsset("mock_dir1/3/2/b.txt"))
+	})
+
+	Convey("Copy and delete if the device cannot run raw transactions | MoveFile", t, func() {
+		sim, sid, _ := newMoveTestDevice(true)
+		dev := mtpxtest.NewFaultInjector(sim)
+
+		_, err := MoveFile(noTransactionDevice{dev}, sid, FileProp{0, "/mtp-test-files/mock_dir1/a.txt"}, destination)
+		So(err, ShouldBeNil)
+		So(dev.Calls(mtpxtest.OpRunTransaction), ShouldEqual, 0)
+
+		_, ok := sim.Lookup(sid, "/mtp-test-files/mock_dir1/a.txt")
+		So(ok, ShouldBeFalse)
+
+		data, err := sim.ReadFile(sid, destination+"/a.txt")
+		So(err, ShouldBeNil)
+		So(data, ShouldResemble, readTestMocksAsset("mock_dir1/a.txt"))
+	})
+
+	Convey("Keep the source if the copy fails | MoveFile", t, func() {
+		sim, sid, _ := newMoveTestDevice(false)
+		dev := mtpxtest.NewFaultInjector(sim, mtpxtest.Fault{
+			Op:  mtpxtest.OpSendObject,
+			Nth: 2,
+			Err: mtp.RCError(mtp.RC_StoreFull),
+		})
+
+		_, err := MoveFile(dev, sid, FileProp{0, "/mtp-test-files/mock_dir1"}, destination)
+		So(err, ShouldBeError)
+
+		_, ok := sim.Lookup(sid, "/mtp-test-files/mock_dir1/3/2/b.txt")
+		So(ok, ShouldBeTrue)
+
+		// the partial copy is removed
+		_, ok = sim.Lookup(sid, destination+"/mock_dir1")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Invalid moves | MoveFile", t, func() {
+		sim, sid, _ := newMoveTestDevice(true)
+
+		_, err := MoveFile(sim, sid, FileProp{0, "/mtp-test-files/mock_dir1"}, "/mtp-test-files/mock_dir1/3/2")
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		_, err = MoveFile(sim, sid, FileProp{0, "/mtp-test-files/mock_dir1/1/a.txt"}, "/mtp-test-files/mock_dir1")
+		So(err, ShouldHaveSameTypeAs, FileConflictError{})
+
+		_, err = MoveFile(sim, sid, FileProp{0, "/mtp-test-files/fake"}, destination)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+
+		_, ok := sim.Lookup(sid, "/mtp-test-files/mock_dir1/1/a.txt")
+		So(ok, ShouldBeTrue)
+	})
+}
+
+// read a file of the 'mtp-test-files'
+func readTestMocksAsset(fullPath string) []byte {
+	data, err := ioutil.ReadFile(getTestMocksAsset(fullPath))
+	So(err, ShouldBeNil)
+
+	return data
+}
@@ -0,0 +1,915 @@
+// Package mtpxtest provides an in-memory MTP responder which can be used in place of a real device.
+// It satisfies the mtpx.Device interface and mimics the behaviour of an Android phone closely enough to run the mtpx test suites without any hardware.
+package mtpxtest
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// size of a single usb bulk transfer
+// the progress callbacks are invoked once per chunk just like the usb stack does
+const chunkSize = 0x4000
+
+// storage id of the first storage; subsequent storages are numbered like Android does (0x10001, 0x20001, ...)
+const firstStorageId = 0x10001
+
+// parent object of the objects in the root directory of a storage
+const rootParent = 0
+
+// the format used by MTP to encode the date props
+const dateFormat = "20060102T150405"
+
+type storage struct {
+	id   uint32
+	info mtp.StorageInfo
+}
+
+type object struct {
+	handle uint32
+	info   mtp.ObjectInfo
+	data   []byte
+}
+
+type uint32Value struct {
+	Value uint32
+}
+
+type uint16Value struct {
+	Value uint16
+}
+
+// Device - a simulated MTP device
+// the zero value is not usable, use [New] instead
+type Device struct {
+	// returned by GetDeviceInfo
+	// it may be modified to simulate different handsets (eg: to remove supported operations)
+	DeviceInfo mtp.DeviceInfo
+
+	// stamp the objects sent by the host with the current time instead of their ModificationDate, like most Android devices do
+	StampModificationDate bool
+
+	// fail to delete the directories which are not empty with RC_GeneralError, like some handsets do
+	RefuseNonEmptyDeletes bool
+
+	mu         sync.Mutex
+	storages   []*storage
+	objects    map[uint32]*object
+	lastHandle uint32
+
+	// objectId of the object created by the most recent SendObjectInfo, awaiting SendObject
+	pendingHandle uint32
+
+	// set when the host aborted a transaction before reading its response
+	// like on a real device, the next transaction goes out of sync and the connection gets closed
+	desynced bool
+
+	closed bool
+}
+
+// New - create a simulated device without any storages
+// use [AddStorage] to add one
+func New() *Device {
+	return &Device{
+		DeviceInfo: mtp.DeviceInfo{
+			StandardVersion:      100,
+			MTPVendorExtensionID: 6,
+			MTPVersion:           100,
+			MTPExtension:         "microsoft.com: 1.0; android.com: 1.0;",
+			OperationsSupported: []uint16{
+				mtp.OC_GetDeviceInfo, mtp.OC_OpenSession, mtp.OC_CloseSession,
+				mtp.OC_GetStorageIDs, mtp.OC_GetStorageInfo, mtp.OC_GetNumObjects,
+				mtp.OC_GetObjectHandles, mtp.OC_GetObjectInfo, mtp.OC_GetObject,
+				mtp.OC_DeleteObject, mtp.OC_SendObjectInfo, mtp.OC_SendObject,
+				mtp.OC_MTP_GetObjectPropsSupported, mtp.OC_MTP_GetObjectPropDesc,
+				mtp.OC_MTP_GetObjectPropValue, mtp.OC_MTP_SetObjectPropValue,
+				mtp.OC_GetPartialObject, mtp.OC_ANDROID_GET_PARTIAL_OBJECT64,
+				mtp.OC_MoveObject, mtp.OC_CopyObject,
+			},
+			PlaybackFormats: []uint16{
+				mtp.OFC_Undefined, mtp.OFC_Association, mtp.OFC_Text, mtp.OFC_HTML,
+				mtp.OFC_WAV, mtp.OFC_MP3, mtp.OFC_MPEG, mtp.OFC_EXIF_JPEG, mtp.OFC_GIF,
+				mtp.OFC_PNG, mtp.OFC_MTP_MP4, mtp.OFC_MTP_3GP, mtp.OFC_MTP_AAC, mtp.OFC_MTP_OGG,
+			},
+			Manufacturer:  "mtpxtest",
+			Model:         "Simulated Device",
+			DeviceVersion: "1.0",
+			SerialNumber:  "MTPXTEST0001",
+		},
+		objects: map[uint32]*object{},
+	}
+}
+
+// AddStorage - add a new storage to the device
+// [capacity] is the size of the storage in bytes
+// returns the storage id
+func (d *Device) AddStorage(description string, capacity uint64) uint32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sid := uint32(firstStorageId + len(d.storages)<<16)
+
+	storageType := uint16(mtp.ST_FixedRAM)
+	if len(d.storages) > 0 {
+		storageType = mtp.ST_RemovableRAM
+	}
+
+	d.storages = append(d.storages, &storage{
+		id: sid,
+		info: mtp.StorageInfo{
+			StorageType:        storageType,
+			FilesystemType:     mtp.FST_GenericHierarchical,
+			AccessCapability:   mtp.AC_ReadWrite,
+			MaxCapability:      capacity,
+			FreeSpaceInBytes:   capacity,
+			FreeSpaceInImages:  0xFFFFFFFF,
+			StorageDescription: description,
+		},
+	})
+
+	return sid
+}
+
+// Close - close the device
+// every operation on a closed device fails
+func (d *Device) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+
+	return nil
+}
+
+// Closed - returns true if [Close] was called
+func (d *Device) Closed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.closed
+}
+
+func (d *Device) GetDeviceInfo(info *mtp.DeviceInfo) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkSession(); err != nil {
+		return err
+	}
+
+	return roundTrip(&d.DeviceInfo, info)
+}
+
+func (d *Device) GetStorageIDs(info *mtp.Uint32Array) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkSession(); err != nil {
+		return err
+	}
+
+	info.Values = []uint32{}
+	for _, s := range d.storages {
+		info.Values = append(info.Values, s.id)
+	}
+
+	return nil
+}
+
+func (d *Device) GetStorageInfo(ID uint32, info *mtp.StorageInfo) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkSession(); err != nil {
+		return err
+	}
+
+	s := d.storage(ID)
+	if s == nil {
+		return mtp.RCError(mtp.RC_InvalidStorageId)
+	}
+
+	return roundTrip(&s.info, info)
+}
+
+func (d *Device) GetObjectHandles(storageID, objFormatCode, parent uint32, info *mtp.Uint32Array) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkSession(); err != nil {
+		return err
+	}
+
+	if storageID != mtp.GOH_ALL_STORAGE && d.storage(storageID) == nil {
+		return mtp.RCError(mtp.RC_InvalidStorageId)
+	}
+
+	// [parent] 0 lists every object in the storage, [mtp.GOH_ROOT_PARENT] lists the root directory
+	allObjects := parent == 0
+	if parent == mtp.GOH_ROOT_PARENT {
+		parent = rootParent
+	} else if !allObjects {
+		p, ok := d.objects[parent]
+		if !ok {
+			return mtp.RCError(mtp.RC_InvalidObjectHandle)
+		}
+
+		if p.info.ObjectFormat != mtp.OFC_Association {
+			return mtp.RCError(mtp.RC_InvalidParentObject)
+		}
+	}
+
+	var handles []uint32
+	for h, o := range d.objects {
+		if storageID != mtp.GOH_ALL_STORAGE && o.info.StorageID != storageID {
+			continue
+		}
+
+		if !allObjects && o.info.ParentObject != parent {
+			continue
+		}
+
+		if objFormatCode != mtp.GOH_ALL_FORMATS && uint32(o.info.ObjectFormat) != objFormatCode {
+			continue
+		}
+
+		handles = append(handles, h)
+	}
+
+	sort.Slice(handles, func(i, j int) bool { return handles[i] < handles[j] })
+	info.Values = handles
+
+	return nil
+}
+
+func (d *Device) GetObjectInfo(handle uint32, info *mtp.ObjectInfo) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkSession(); err != nil {
+		return err
+	}
+
+	o, ok := d.objects[handle]
+	if !ok {
+		return mtp.RCError(mtp.RC_InvalidObjectHandle)
+	}
+
+	return roundTrip(&o.info, info)
+}
+
+func (d *Device) GetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkSession(); err != nil {
+		return err
+	}
+
+	o, ok := d.objects[objHandle]
+	if !ok {
+		return mtp.RCError(mtp.RC_InvalidObjectHandle)
+	}
+
+	var v interface{}
+	switch objPropCode {
+	case mtp.OPC_StorageID:
+		v = &uint32Value{Value: o.info.StorageID}
+
+	case mtp.OPC_ObjectFormat:
+		v = &uint16Value{Value: o.info.ObjectFormat}
+
+	case mtp.OPC_ObjectSize:
+		v = &mtp.Uint64Value{Value: uint64(len(o.data))}
+
+	case mtp.OPC_ObjectFileName:
+		v = &mtp.StringValue{Value: o.info.Filename}
+
+	case mtp.OPC_DateModified:
+		v = &mtp.StringValue{Value: o.info.ModificationDate.Format(dateFormat)}
+
+	case mtp.OPC_ParentObject:
+		v = &uint32Value{Value: o.info.ParentObject}
+
+	default:
+		return mtp.RCError(mtp.RC_MTP_ObjectProp_Not_Supported)
+	}
+
+	return roundTrip(v, value)
+}
+
+// SetObjectPropValue - set the prop [objPropCode] of an object, it fails with RC_OperationNotSupported once OC_MTP_SetObjectPropValue is removed from [DeviceInfo]
+func (d *Device) SetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkSession(); err != nil {
+		return err
+	}
+
+	if !d.supports(mtp.OC_MTP_SetObjectPropValue) {
+		return mtp.RCError(mtp.RC_OperationNotSupported)
+	}
+
+	o, ok := d.objects[objHandle]
+	if !ok {
+		return mtp.RCError(mtp.RC_InvalidObjectHandle)
+	}
+
+	switch objPropCode {
+	case mtp.OPC_ObjectFileName:
+		var v mtp.StringValue
+		if err := roundTrip(value, &v); err != nil {
+			return mtp.RCError(mtp.RC_MTP_Invalid_ObjectProp_Format)
+		}
+
+		if v.Value == "" {
+			return mtp.RCError(mtp.RC_MTP_Invalid_ObjectProp_Value)
+		}
+
+		// Android fails to rename an object if an object with the same name already exists (including the object itself)
+		if d.child(o.info.StorageID, o.info.ParentObject, v.Value) != nil {
+			return mtp.RCError(mtp.RC_GeneralError)
+		}
+
+		o.info.Filename = v.Value
+
+		return nil
+
+	case mtp.OPC_DateModified:
+		var v mtp.StringValue
+		if err := roundTrip(value, &v); err != nil {
+			return mtp.RCError(mtp.RC_MTP_Invalid_ObjectProp_Format)
+		}
+
+		modTime, err := time.Parse(dateFormat, v.Value)
+		if err != nil {
+			return mtp.RCError(mtp.RC_MTP_Invalid_ObjectProp_Value)
+		}
+
+		o.info.ModificationDate = modTime
+
+		return nil
+
+	default:
+		return mtp.RCError(mtp.RC_MTP_ObjectProp_Not_Supported)
+	}
+}
+
+func (d *Device) SendObjectInfo(wantStorageID, wantParent uint32, info *mtp.ObjectInfo) (storageID, parent, handle uint32, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkSession(); err != nil {
+		return 0, 0, 0, err
+	}
+
+	s := d.storage(wantStorageID)
+	if s == nil {
+		return 0, 0, 0, mtp.RCError(mtp.RC_InvalidStorageId)
+	}
+
+	parent = wantParent
+	if parent == mtp.GOH_ROOT_PARENT {
+		parent = rootParent
+	}
+
+	if parent != rootParent {
+		p, ok := d.objects[parent]
+		if !ok || p.info.StorageID != s.id || p.info.ObjectFormat != mtp.OFC_Association {
+			return 0, 0, 0, mtp.RCError(mtp.RC_InvalidParentObject)
+		}
+	}
+
+	o := &object{}
+	if err := roundTrip(info, &o.info); err != nil {
+		return 0, 0, 0, mtp.RCError(mtp.RC_InvalidDataSet)
+	}
+
+	if o.info.Filename == "" {
+		return 0, 0, 0, mtp.RCError(mtp.RC_InvalidDataSet)
+	}
+
+	if d.StampModificationDate {
+		o.info.ModificationDate = now()
+	}
+
+	if d.child(s.id, parent, o.info.Filename) != nil {
+		return 0, 0, 0, mtp.RCError(mtp.RC_GeneralError)
+	}
+
+	if uint64(o.info.CompressedSize) > s.info.FreeSpaceInBytes {
+		return 0, 0, 0, mtp.RCError(mtp.RC_StoreFull)
+	}
+
+	o.info.StorageID = s.id
+	o.info.ParentObject = parent
+	d.insert(o)
+
+	d.pendingHandle = 0
+	if o.info.ObjectFormat != mtp.OFC_Association {
+		d.pendingHandle = o.handle
+	}
+
+	return s.id, wantParent, o.handle, nil
+}
+
+func (d *Device) SendObject(r io.Reader, size int64, progressCb mtp.ProgressFunc) error {
+	d.mu.Lock()
+	if err := d.checkSession(); err != nil {
+		d.mu.Unlock()
+
+		return err
+	}
+
+	o, ok := d.objects[d.pendingHandle]
+	d.pendingHandle = 0
+	d.mu.Unlock()
+
+	if !ok {
+		return mtp.RCError(mtp.RC_NoValidObjectInfo)
+	}
+
+	// the reported size reflects the bytes which actually reached the device
+	defer func() {
+		d.mu.Lock()
+		o.info.CompressedSize = compressedSize(int64(len(o.data)))
+		d.mu.Unlock()
+	}()
+
+	// an empty object is transferred as a lone header packet
+	if size == 0 {
+		if err := progressCb(0); err != nil {
+			d.abortDataPhase()
+
+			return err
+		}
+	}
+
+	var sent int64
+	buf := make([]byte, chunkSize)
+
+	for sent < size {
+		toRead := buf
+		if int64(len(toRead)) > size-sent {
+			toRead = buf[:size-sent]
+		}
+
+		n, err := io.ReadFull(r, toRead)
+		if n > 0 {
+			d.mu.Lock()
+			o.data = append(o.data, toRead[:n]...)
+			d.updateFreeSpace(o.info.StorageID, -int64(n))
+			d.mu.Unlock()
+
+			sent += int64(n)
+		}
+
+		if err != nil {
+			d.abortDataPhase()
+
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+
+			return err
+		}
+
+		if err := progressCb(sent); err != nil {
+			d.abortDataPhase()
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Device) GetObject(handle uint32, w io.Writer, progressCb mtp.ProgressFunc) error {
+	d.mu.Lock()
+	if err := d.checkSession(); err != nil {
+		d.mu.Unlock()
+
+		return err
+	}
+
+	o, ok := d.objects[handle]
+	var data []byte
+	if ok {
+		data = o.data
+	}
+	d.mu.Unlock()
+
+	if !ok {
+		return mtp.RCError(mtp.RC_InvalidObjectHandle)
+	}
+
+	if o.info.ObjectFormat == mtp.OFC_Association {
+		return mtp.RCError(mtp.RC_InvalidObjectFormatCode)
+	}
+
+	if err := writeChunks(w, data, progressCb); err != nil {
+		d.abortDataPhase()
+
+		return err
+	}
+
+	return nil
+}
+
+func (d *Device) DeleteObject(handle uint32) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkSession(); err != nil {
+		return err
+	}
+
+	o, ok := d.objects[handle]
+	if !ok {
+		return mtp.RCError(mtp.RC_InvalidObjectHandle)
+	}
+
+	if d.RefuseNonEmptyDeletes && len(d.children(o.info.StorageID, handle)) > 0 {
+		return mtp.RCError(mtp.RC_GeneralError)
+	}
+
+	d.remove(handle)
+
+	return nil
+}
+
+// RunTransaction - run an operation which has no dedicated method
+// GetPartialObject, Android's GetPartialObject64, MoveObject and CopyObject are supported, they fail with RC_OperationNotSupported once removed from [DeviceInfo]
+func (d *Device) RunTransaction(req *mtp.Container, rep *mtp.Container, dest io.Writer, src io.Reader, writeSize int64, progressCb mtp.ProgressFunc) error {
+	d.mu.Lock()
+	if err := d.checkSession(); err != nil {
+		d.mu.Unlock()
+
+		return err
+	}
+
+	supported := d.supports(req.Code)
+
+	var offset, size int64
+	var handle uint32
+	rc := uint16(mtp.RC_OK)
+
+	switch {
+	case !supported:
+		rc = mtp.RC_OperationNotSupported
+
+	case req.Code == mtp.OC_GetPartialObject && len(req.Param) == 3:
+		handle, offset, size = req.Param[0], int64(req.Param[1]), int64(req.Param[2])
+
+	case req.Code == mtp.OC_ANDROID_GET_PARTIAL_OBJECT64 && len(req.Param) == 4:
+		handle, offset, size = req.Param[0], int64(req.Param[1])|int64(req.Param[2])<<32, int64(req.Param[3])
+
+	case req.Code == mtp.OC_GetPartialObject || req.Code == mtp.OC_ANDROID_GET_PARTIAL_OBJECT64:
+		rc = mtp.RC_ParameterNotSupported
+
+	case req.Code == mtp.OC_MoveObject && len(req.Param) == 3:
+		rc = d.moveObject(req.Param[0], req.Param[1], req.Param[2])
+		d.mu.Unlock()
+
+		return response(req, rep, rc)
+
+	case req.Code == mtp.OC_CopyObject && len(req.Param) == 3:
+		handle, rc = d.copyObject(req.Param[0], req.Param[1], req.Param[2])
+		d.mu.Unlock()
+
+		if err := response(req, rep, rc); err != nil {
+			return err
+		}
+
+		// the handle of the copy
+		rep.Param = []uint32{handle}
+
+		return nil
+
+	default:
+		rc = mtp.RC_OperationNotSupported
+	}
+
+	var data []byte
+	if rc == mtp.RC_OK {
+		o, ok := d.objects[handle]
+
+		switch {
+		case !ok:
+			rc = mtp.RC_InvalidObjectHandle
+
+		case o.info.ObjectFormat == mtp.OFC_Association:
+			rc = mtp.RC_InvalidObjectFormatCode
+
+		case offset > int64(len(o.data)):
+			rc = mtp.RC_InvalidParameter
+
+		default:
+			end := offset + size
+			if end > int64(len(o.data)) {
+				end = int64(len(o.data))
+			}
+
+			data = o.data[offset:end]
+		}
+	}
+	d.mu.Unlock()
+
+	if err := response(req, rep, rc); err != nil {
+		return err
+	}
+
+	if dest == nil {
+		dest = ioutil.Discard
+	}
+
+	if err := writeChunks(dest, data, progressCb); err != nil {
+		d.abortDataPhase()
+
+		return err
+	}
+
+	// the number of bytes sent
+	rep.Param = []uint32{uint32(len(data))}
+
+	return nil
+}
+
+// move [handle] along with its descendants into [parent] of the storage [sid]
+// the handles of the moved objects are kept like on Android
+func (d *Device) moveObject(handle, sid, parent uint32) uint16 {
+	o, s, parent, rc := d.destination(handle, sid, parent)
+	if rc != mtp.RC_OK {
+		return rc
+	}
+
+	if c := d.child(s.id, parent, o.info.Filename); c != nil && c != o {
+		return mtp.RC_GeneralError
+	}
+
+	tree := d.descendants(o)
+	if o.info.StorageID != s.id {
+		size := treeSize(tree)
+		if uint64(size) > s.info.FreeSpaceInBytes {
+			return mtp.RC_StoreFull
+		}
+
+		d.updateFreeSpace(o.info.StorageID, size)
+		d.updateFreeSpace(s.id, -size)
+	}
+
+	for _, t := range tree {
+		t.info.StorageID = s.id
+	}
+	o.info.ParentObject = parent
+
+	return mtp.RC_OK
+}
+
+// copy [handle] along with its descendants into [parent] of the storage [sid]
+// returns the handle of the copy
+func (d *Device) copyObject(handle, sid, parent uint32) (uint32, uint16) {
+	o, s, parent, rc := d.destination(handle, sid, parent)
+	if rc != mtp.RC_OK {
+		return 0, rc
+	}
+
+	if d.child(s.id, parent, o.info.Filename) != nil {
+		return 0, mtp.RC_GeneralError
+	}
+
+	if uint64(treeSize(d.descendants(o))) > s.info.FreeSpaceInBytes {
+		return 0, mtp.RC_StoreFull
+	}
+
+	return d.clone(o, s.id, parent).handle, mtp.RC_OK
+}
+
+// validate the destination [parent] of the storage [sid] of a MoveObject or a CopyObject of [handle]
+func (d *Device) destination(handle, sid, parent uint32) (*object, *storage, uint32, uint16) {
+	o, ok := d.objects[handle]
+	if !ok {
+		return nil, nil, 0, mtp.RC_InvalidObjectHandle
+	}
+
+	s := d.storage(sid)
+	if s == nil {
+		return nil, nil, 0, mtp.RC_InvalidStorageId
+	}
+
+	if parent == mtp.GOH_ROOT_PARENT {
+		parent = rootParent
+	}
+
+	// an object cannot be placed into itself or its descendants
+	for p := parent; p != rootParent; p = d.objects[p].info.ParentObject {
+		if po, ok := d.objects[p]; !ok || po.info.StorageID != s.id || po.info.ObjectFormat != mtp.OFC_Association || p == handle {
+			return nil, nil, 0, mtp.RC_InvalidParentObject
+		}
+	}
+
+	return o, s, parent, mtp.RC_OK
+}
+
+// set the response of a [RunTransaction]
+// returns an error if [rc] is not RC_OK
+func response(req *mtp.Container, rep *mtp.Container, rc uint16) error {
+	rep.Code = rc
+	rep.TransactionID = req.TransactionID
+	rep.Param = nil
+
+	if rc != mtp.RC_OK {
+		return mtp.RCError(rc)
+	}
+
+	return nil
+}
+
+// returns an error if the device is not usable
+func (d *Device) checkSession() error {
+	if d.closed {
+		return fmt.Errorf("mtp: cannot run operation, device is not open")
+	}
+
+	if d.desynced {
+		d.desynced = false
+		d.closed = true
+
+		return mtp.SyncError("transaction ID mismatch")
+	}
+
+	return nil
+}
+
+// returns true if the operation [opCode] is listed in [DeviceInfo]
+func (d *Device) supports(opCode uint16) bool {
+	for _, code := range d.DeviceInfo.OperationsSupported {
+		if code == opCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Device) abortDataPhase() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.desynced = true
+}
+
+// fetch the storage using [sid]
+// returns nil if the storage does not exist
+func (d *Device) storage(sid uint32) *storage {
+	for _, s := range d.storages {
+		if s.id == sid {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// fetch a child of [parent] by [filename]
+// the lookup is case insensitive like the filesystems on Android
+func (d *Device) child(sid, parent uint32, filename string) *object {
+	for _, o := range d.objects {
+		if o.info.StorageID == sid && o.info.ParentObject == parent && strings.EqualFold(o.info.Filename, filename) {
+			return o
+		}
+	}
+
+	return nil
+}
+
+// list the children of [parent] sorted by their handles
+func (d *Device) children(sid, parent uint32) []*object {
+	var result []*object
+	for _, o := range d.objects {
+		if o.info.StorageID == sid && o.info.ParentObject == parent {
+			result = append(result, o)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].handle < result[j].handle })
+
+	return result
+}
+
+// list [o] and all of its descendants
+func (d *Device) descendants(o *object) []*object {
+	result := []*object{o}
+	for _, c := range d.children(o.info.StorageID, o.handle) {
+		result = append(result, d.descendants(c)...)
+	}
+
+	return result
+}
+
+// copy [o] and all of its descendants into [parent] of the storage [sid]
+func (d *Device) clone(o *object, sid, parent uint32) *object {
+	c := &object{info: o.info, data: append([]byte(nil), o.data...)}
+	c.info.StorageID = sid
+	c.info.ParentObject = parent
+	d.insert(c)
+	d.updateFreeSpace(sid, -int64(len(c.data)))
+
+	for _, child := range d.children(o.info.StorageID, o.handle) {
+		d.clone(child, sid, c.handle)
+	}
+
+	return c
+}
+
+// the total size of the objects of [tree]
+func treeSize(tree []*object) int64 {
+	var size int64
+	for _, t := range tree {
+		size += int64(len(t.data))
+	}
+
+	return size
+}
+
+// assign a new handle to [o] and add it to the object tree
+func (d *Device) insert(o *object) {
+	d.lastHandle += 1
+	o.handle = d.lastHandle
+	d.objects[o.handle] = o
+}
+
+// remove [handle] and all of its descendants
+func (d *Device) remove(handle uint32) {
+	o := d.objects[handle]
+
+	for _, c := range d.children(o.info.StorageID, handle) {
+		d.remove(c.handle)
+	}
+
+	d.updateFreeSpace(o.info.StorageID, int64(len(o.data)))
+	delete(d.objects, handle)
+
+	if d.pendingHandle == handle {
+		d.pendingHandle = 0
+	}
+}
+
+func (d *Device) updateFreeSpace(sid uint32, delta int64) {
+	s := d.storage(sid)
+	if s == nil {
+		return
+	}
+
+	s.info.FreeSpaceInBytes = uint64(int64(s.info.FreeSpaceInBytes) + delta)
+}
+
+// write [data] to [w] in usb sized chunks while reporting the progress
+func writeChunks(w io.Writer, data []byte, progressCb mtp.ProgressFunc) error {
+	var sent int64
+
+	for {
+		end := sent + chunkSize
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+
+		n, err := w.Write(data[sent:end])
+		sent += int64(n)
+		if err != nil {
+			return err
+		}
+
+		if err := progressCb(sent); err != nil {
+			return err
+		}
+
+		if sent >= int64(len(data)) {
+			return nil
+		}
+	}
+}
+
+// copy [src] into [dest] by encoding and decoding it the way the usb transport does
+// this makes sure that the values are truncated (eg: dates are reduced to seconds) exactly like on a real device
+func roundTrip(src, dest interface{}) error {
+	var buf bytes.Buffer
+	if err := mtp.Encode(&buf, src); err != nil {
+		return err
+	}
+
+	return mtp.Decode(&buf, dest)
+}
+
+// current time truncated to the precision supported by MTP
+func now() time.Time {
+	return time.Now().Truncate(time.Second)
+}
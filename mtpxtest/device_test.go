@@ -0,0 +1,242 @@
+package mtpxtest
+
+import (
+	"bytes"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func newTestDevice() (*Device, uint32, uint32) {
+	dev := New()
+	sid1 := dev.AddStorage("Internal shared storage", 1<<20)
+	sid2 := dev.AddStorage("SD card", 1<<20)
+
+	return dev, sid1, sid2
+}
+
+func TestStorages(t *testing.T) {
+	Convey("Testing storages | Device", t, func() {
+		dev, sid1, sid2 := newTestDevice()
+
+		So(sid1, ShouldEqual, 0x10001)
+		So(sid2, ShouldEqual, 0x20001)
+
+		sids := mtp.Uint32Array{}
+		So(dev.GetStorageIDs(&sids), ShouldBeNil)
+		So(sids.Values, ShouldResemble, []uint32{sid1, sid2})
+
+		_, err := dev.WriteFile(sid1, "/a.txt", []byte("12345"), time.Now())
+		So(err, ShouldBeNil)
+
+		var info mtp.StorageInfo
+		So(dev.GetStorageInfo(sid1, &info), ShouldBeNil)
+		So(info.StorageDescription, ShouldEqual, "Internal shared storage")
+		So(info.FreeSpaceInBytes, ShouldEqual, 1<<20-5)
+
+		So(dev.GetStorageInfo(0x30001, &info), ShouldEqual, mtp.RCError(mtp.RC_InvalidStorageId))
+
+		// the storages are independent of each other
+		_, ok := dev.Lookup(sid2, "/a.txt")
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestObjects(t *testing.T) {
+	Convey("Testing object handles and props | Device", t, func() {
+		dev, sid, _ := newTestDevice()
+
+		modTime := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+		dirId, err := dev.MakeDirectory(sid, "/DCIM/Camera", modTime)
+		So(err, ShouldBeNil)
+
+		fileId, err := dev.WriteFile(sid, "/DCIM/Camera/IMG_1.jpg", []byte("jpeg"), modTime)
+		So(err, ShouldBeNil)
+
+		handles := mtp.Uint32Array{}
+		So(dev.GetObjectHandles(sid, mtp.GOH_ALL_ASSOCS, mtp.GOH_ROOT_PARENT, &handles), ShouldBeNil)
+		So(len(handles.Values), ShouldEqual, 1)
+
+		So(dev.GetObjectHandles(sid, mtp.GOH_ALL_ASSOCS, dirId, &handles), ShouldBeNil)
+		So(handles.Values, ShouldResemble, []uint32{fileId})
+
+		var dirInfo mtp.ObjectInfo
+		So(dev.GetObjectInfo(dirId, &dirInfo), ShouldBeNil)
+		So(dirInfo.ObjectFormat, ShouldEqual, mtp.OFC_Association)
+		So(dirInfo.Filename, ShouldEqual, "Camera")
+
+		var fileInfo mtp.ObjectInfo
+		So(dev.GetObjectInfo(fileId, &fileInfo), ShouldBeNil)
+		So(fileInfo.ParentObject, ShouldEqual, dirId)
+		So(fileInfo.CompressedSize, ShouldEqual, 4)
+		// dates are transferred with a precision of seconds
+		So(fileInfo.ModificationDate, ShouldEqual, modTime.Truncate(time.Second))
+
+		var size mtp.Uint64Value
+		So(dev.GetObjectPropValue(fileId, mtp.OPC_ObjectSize, &size), ShouldBeNil)
+		So(size.Value, ShouldEqual, 4)
+
+		var name mtp.StringValue
+		So(dev.GetObjectPropValue(fileId, mtp.OPC_ObjectFileName, &name), ShouldBeNil)
+		So(name.Value, ShouldEqual, "IMG_1.jpg")
+
+		// lookups are case insensitive
+		objectId, ok := dev.Lookup(sid, "/dcim/CAMERA/img_1.JPG")
+		So(ok, ShouldBeTrue)
+		So(objectId, ShouldEqual, fileId)
+
+		// set the modification date
+		So(dev.SetObjectPropValue(fileId, mtp.OPC_DateModified, &mtp.StringValue{Value: "20210304T050607"}), ShouldBeNil)
+		So(dev.GetObjectInfo(fileId, &fileInfo), ShouldBeNil)
+		So(fileInfo.ModificationDate, ShouldEqual, time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC))
+
+		err = dev.SetObjectPropValue(fileId, mtp.OPC_DateModified, &mtp.StringValue{Value: "yesterday"})
+		So(err, ShouldEqual, mtp.RCError(mtp.RC_MTP_Invalid_ObjectProp_Value))
+	})
+
+	Convey("Testing invalid object handles | Device", t, func() {
+		dev, sid, _ := newTestDevice()
+
+		var info mtp.ObjectInfo
+		So(dev.GetObjectInfo(1234567, &info), ShouldEqual, mtp.RCError(mtp.RC_InvalidObjectHandle))
+		So(dev.DeleteObject(1234567), ShouldEqual, mtp.RCError(mtp.RC_InvalidObjectHandle))
+
+		handles := mtp.Uint32Array{}
+		So(dev.GetObjectHandles(sid, mtp.GOH_ALL_ASSOCS, 1234567, &handles), ShouldEqual, mtp.RCError(mtp.RC_InvalidObjectHandle))
+	})
+
+	Convey("Testing rename | Device", t, func() {
+		dev, sid, _ := newTestDevice()
+
+		fileId, err := dev.WriteFile(sid, "/a.txt", []byte("a"), time.Now())
+		So(err, ShouldBeNil)
+		_, err = dev.WriteFile(sid, "/b.txt", []byte("b"), time.Now())
+		So(err, ShouldBeNil)
+
+		So(dev.SetObjectPropValue(fileId, mtp.OPC_ObjectFileName, &mtp.StringValue{Value: "c.txt"}), ShouldBeNil)
+
+		// renaming to an existing name fails with a general error
+		So(dev.SetObjectPropValue(fileId, mtp.OPC_ObjectFileName, &mtp.StringValue{Value: "c.txt"}), ShouldEqual, mtp.RCError(mtp.RC_GeneralError))
+		So(dev.SetObjectPropValue(fileId, mtp.OPC_ObjectFileName, &mtp.StringValue{Value: "B.TXT"}), ShouldEqual, mtp.RCError(mtp.RC_GeneralError))
+
+		data, err := dev.ReadFile(sid, "/c.txt")
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "a")
+
+		// the operation can be removed to simulate a device which does not support it
+		dev.DeviceInfo.OperationsSupported = []uint16{mtp.OC_GetObject}
+		So(dev.SetObjectPropValue(fileId, mtp.OPC_ObjectFileName, &mtp.StringValue{Value: "d.txt"}), ShouldEqual, mtp.RCError(mtp.RC_OperationNotSupported))
+	})
+
+	Convey("Testing delete | Device", t, func() {
+		dev, sid, _ := newTestDevice()
+
+		dirId, err := dev.MakeDirectory(sid, "/a/b", time.Now())
+		So(err, ShouldBeNil)
+		_, err = dev.WriteFile(sid, "/a/b/c.txt", []byte("c"), time.Now())
+		So(err, ShouldBeNil)
+
+		aId, _ := dev.Lookup(sid, "/a")
+		So(dev.DeleteObject(aId), ShouldBeNil)
+
+		var info mtp.ObjectInfo
+		So(dev.GetObjectInfo(dirId, &info), ShouldEqual, mtp.RCError(mtp.RC_InvalidObjectHandle))
+
+		var storageInfo mtp.StorageInfo
+		So(dev.GetStorageInfo(sid, &storageInfo), ShouldBeNil)
+		So(storageInfo.FreeSpaceInBytes, ShouldEqual, 1<<20)
+	})
+}
+
+func TestTransfers(t *testing.T) {
+	Convey("Testing SendObjectInfo and SendObject | Device", t, func() {
+		dev, sid, _ := newTestDevice()
+
+		data := bytes.Repeat([]byte("x"), 3*chunkSize+1)
+		_, _, objectId, err := dev.SendObjectInfo(sid, mtp.GOH_ROOT_PARENT, &mtp.ObjectInfo{
+			ObjectFormat:   mtp.OFC_Undefined,
+			Filename:       "x.txt",
+			CompressedSize: uint32(len(data)),
+		})
+		So(err, ShouldBeNil)
+
+		var progress []int64
+		err = dev.SendObject(bytes.NewReader(data), int64(len(data)), func(sent int64) error {
+			progress = append(progress, sent)
+
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(progress, ShouldResemble, []int64{chunkSize, 2 * chunkSize, 3 * chunkSize, int64(len(data))})
+
+		var buf bytes.Buffer
+		So(dev.GetObject(objectId, &buf, mtp.EmptyProgressFunc), ShouldBeNil)
+		So(buf.Bytes(), ShouldResemble, data)
+
+		// an object with the same name cannot be created twice
+		_, _, _, err = dev.SendObjectInfo(sid, mtp.GOH_ROOT_PARENT, &mtp.ObjectInfo{Filename: "X.TXT"})
+		So(err, ShouldEqual, mtp.RCError(mtp.RC_GeneralError))
+
+		// SendObject requires a preceding SendObjectInfo
+		So(dev.SendObject(bytes.NewReader(data), 1, mtp.EmptyProgressFunc), ShouldEqual, mtp.RCError(mtp.RC_NoValidObjectInfo))
+	})
+
+	Convey("Testing a storage without free space | Device", t, func() {
+		dev, sid, _ := newTestDevice()
+
+		_, _, _, err := dev.SendObjectInfo(sid, mtp.GOH_ROOT_PARENT, &mtp.ObjectInfo{
+			Filename:       "large.bin",
+			CompressedSize: 2 << 20,
+		})
+		So(err, ShouldEqual, mtp.RCError(mtp.RC_StoreFull))
+	})
+
+	Convey("Testing an aborted transaction | Device", t, func() {
+		dev, sid, _ := newTestDevice()
+
+		objectId, err := dev.WriteFile(sid, "/a.txt", []byte("a"), time.Now())
+		So(err, ShouldBeNil)
+
+		var buf bytes.Buffer
+		err = dev.GetObject(objectId, &buf, func(sent int64) error {
+			return mtp.RCError(mtp.RC_TransactionCanceled)
+		})
+		So(err, ShouldBeError)
+
+		// the next transaction goes out of sync and the connection is closed
+		var info mtp.ObjectInfo
+		So(dev.GetObjectInfo(objectId, &info), ShouldHaveSameTypeAs, mtp.SyncError(""))
+		So(dev.Closed(), ShouldBeTrue)
+		So(dev.GetObjectInfo(objectId, &info), ShouldBeError)
+	})
+
+	Convey("Testing partial objects | Device", t, func() {
+		dev, sid, _ := newTestDevice()
+
+		objectId, err := dev.WriteFile(sid, "/a.txt", []byte("0123456789"), time.Now())
+		So(err, ShouldBeNil)
+
+		var buf bytes.Buffer
+		req := mtp.Container{Code: mtp.OC_GetPartialObject, Param: []uint32{objectId, 2, 5}}
+		rep := mtp.Container{}
+		So(dev.RunTransaction(&req, &rep, &buf, nil, 0, mtp.EmptyProgressFunc), ShouldBeNil)
+		So(buf.String(), ShouldEqual, "23456")
+		So(rep.Param, ShouldResemble, []uint32{5})
+
+		// the size is capped at the end of the object
+		buf.Reset()
+		req = mtp.Container{Code: mtp.OC_ANDROID_GET_PARTIAL_OBJECT64, Param: []uint32{objectId, 8, 0, 100}}
+		So(dev.RunTransaction(&req, &rep, &buf, nil, 0, mtp.EmptyProgressFunc), ShouldBeNil)
+		So(buf.String(), ShouldEqual, "89")
+
+		req = mtp.Container{Code: mtp.OC_GetPartialObject, Param: []uint32{objectId, 11, 1}}
+		So(dev.RunTransaction(&req, &rep, &buf, nil, 0, mtp.EmptyProgressFunc), ShouldEqual, mtp.RCError(mtp.RC_InvalidParameter))
+
+		// the operations can be removed to simulate a device which does not support them
+		dev.DeviceInfo.OperationsSupported = []uint16{mtp.OC_GetObject}
+		req = mtp.Container{Code: mtp.OC_GetPartialObject, Param: []uint32{objectId, 0, 1}}
+		So(dev.RunTransaction(&req, &rep, &buf, nil, 0, mtp.EmptyProgressFunc), ShouldEqual, mtp.RCError(mtp.RC_OperationNotSupported))
+		So(rep.Code, ShouldEqual, mtp.RC_OperationNotSupported)
+	})
+}
@@ -0,0 +1,372 @@
+package mtpxtest
+
+import (
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/usb"
+	"io"
+	"sync"
+	"time"
+)
+
+// Operations - the MTP operations of a device
+// it mirrors mtpx.Device (mtpxtest cannot import mtpx since the mtpx tests import mtpxtest)
+type Operations interface {
+	Close() error
+	GetDeviceInfo(info *mtp.DeviceInfo) error
+	GetStorageIDs(info *mtp.Uint32Array) error
+	GetStorageInfo(ID uint32, info *mtp.StorageInfo) error
+	GetObjectHandles(storageID, objFormatCode, parent uint32, info *mtp.Uint32Array) error
+	GetObjectInfo(handle uint32, info *mtp.ObjectInfo) error
+	GetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error
+	SetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error
+	SendObjectInfo(wantStorageID, wantParent uint32, info *mtp.ObjectInfo) (storageID, parent, handle uint32, err error)
+	SendObject(r io.Reader, size int64, progressCb mtp.ProgressFunc) error
+	GetObject(handle uint32, w io.Writer, progressCb mtp.ProgressFunc) error
+	DeleteObject(handle uint32) error
+	RunTransaction(req *mtp.Container, rep *mtp.Container, dest io.Writer, src io.Reader, writeSize int64, progressCb mtp.ProgressFunc) error
+}
+
+// Op - name of a device operation
+type Op string
+
+const (
+	OpClose              Op = "Close"
+	OpGetDeviceInfo      Op = "GetDeviceInfo"
+	OpGetStorageIDs      Op = "GetStorageIDs"
+	OpGetStorageInfo     Op = "GetStorageInfo"
+	OpGetObjectHandles   Op = "GetObjectHandles"
+	OpGetObjectInfo      Op = "GetObjectInfo"
+	OpGetObjectPropValue Op = "GetObjectPropValue"
+	OpSetObjectPropValue Op = "SetObjectPropValue"
+	OpSendObjectInfo     Op = "SendObjectInfo"
+	OpSendObject         Op = "SendObject"
+	OpGetObject          Op = "GetObject"
+	OpDeleteObject       Op = "DeleteObject"
+	OpRunTransaction     Op = "RunTransaction"
+)
+
+// ErrDisconnected - returned by every operation once the connection was dropped
+// it is the same error libusb returns when the device is unplugged
+const ErrDisconnected = usb.ERROR_NO_DEVICE
+
+// Fault - a rule describing when and how an operation fails
+type Fault struct {
+	// operation to fail
+	Op Op
+
+	// fail the [Nth] call of [Op] (starting at 1)
+	// 0 fails every call
+	Nth int
+
+	// error returned by the operation
+	// if [Err] is nil and [Truncate] is false then the operation succeeds after the [Delay]
+	Err error
+
+	// GetObject, SendObject and RunTransaction only: transfer [TruncateAt] bytes of the object and then fail with [Err]
+	// io.ErrUnexpectedEOF is returned if [Err] is nil
+	Truncate   bool
+	TruncateAt int64
+
+	// stall the operation for the duration before executing it
+	Delay time.Duration
+
+	// drop the connection; the operation and every operation after it fails with [ErrDisconnected]
+	Disconnect bool
+}
+
+// FaultInjector - wraps a device and injects failures into its operations
+type FaultInjector struct {
+	dev Operations
+
+	mu           sync.Mutex
+	faults       []Fault
+	calls        map[Op]int
+	disconnected bool
+}
+
+// NewFaultInjector - wrap [dev] and inject [faults] into it
+// the faults are evaluated in order and the first matching one is applied
+func NewFaultInjector(dev Operations, faults ...Fault) *FaultInjector {
+	return &FaultInjector{
+		dev:    dev,
+		faults: faults,
+		calls:  map[Op]int{},
+	}
+}
+
+// Inject - add a fault
+func (f *FaultInjector) Inject(fault Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.faults = append(f.faults, fault)
+}
+
+// Reset - remove all the faults and restore a dropped connection
+// the call counters are kept
+func (f *FaultInjector) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.faults = nil
+	f.disconnected = false
+}
+
+// Calls - number of times [op] was called
+func (f *FaultInjector) Calls(op Op) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[op]
+}
+
+// count the call and find the fault which applies to it
+// returns nil if the operation should run normally
+func (f *FaultInjector) fault(op Op) *Fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls[op] += 1
+
+	if f.disconnected {
+		return &Fault{Op: op, Err: ErrDisconnected}
+	}
+
+	for _, fault := range f.faults {
+		if fault.Op != op {
+			continue
+		}
+
+		if fault.Nth != 0 && fault.Nth != f.calls[op] {
+			continue
+		}
+
+		if fault.Disconnect {
+			f.disconnected = true
+			fault.Err = ErrDisconnected
+		}
+
+		return &fault
+	}
+
+	return nil
+}
+
+// apply [fault] to an operation which does not transfer any data
+// returns nil if the operation should be executed
+func (f *FaultInjector) apply(fault *Fault) error {
+	if fault == nil {
+		return nil
+	}
+
+	time.Sleep(fault.Delay)
+
+	return fault.Err
+}
+
+func (f *FaultInjector) Close() error {
+	if err := f.apply(f.fault(OpClose)); err != nil {
+		return err
+	}
+
+	return f.dev.Close()
+}
+
+func (f *FaultInjector) GetDeviceInfo(info *mtp.DeviceInfo) error {
+	if err := f.apply(f.fault(OpGetDeviceInfo)); err != nil {
+		return err
+	}
+
+	return f.dev.GetDeviceInfo(info)
+}
+
+func (f *FaultInjector) GetStorageIDs(info *mtp.Uint32Array) error {
+	if err := f.apply(f.fault(OpGetStorageIDs)); err != nil {
+		return err
+	}
+
+	return f.dev.GetStorageIDs(info)
+}
+
+func (f *FaultInjector) GetStorageInfo(ID uint32, info *mtp.StorageInfo) error {
+	if err := f.apply(f.fault(OpGetStorageInfo)); err != nil {
+		return err
+	}
+
+	return f.dev.GetStorageInfo(ID, info)
+}
+
+func (f *FaultInjector) GetObjectHandles(storageID, objFormatCode, parent uint32, info *mtp.Uint32Array) error {
+	if err := f.apply(f.fault(OpGetObjectHandles)); err != nil {
+		return err
+	}
+
+	return f.dev.GetObjectHandles(storageID, objFormatCode, parent, info)
+}
+
+func (f *FaultInjector) GetObjectInfo(handle uint32, info *mtp.ObjectInfo) error {
+	if err := f.apply(f.fault(OpGetObjectInfo)); err != nil {
+		return err
+	}
+
+	return f.dev.GetObjectInfo(handle, info)
+}
+
+func (f *FaultInjector) GetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error {
+	if err := f.apply(f.fault(OpGetObjectPropValue)); err != nil {
+		return err
+	}
+
+	return f.dev.GetObjectPropValue(objHandle, objPropCode, value)
+}
+
+func (f *FaultInjector) SetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error {
+	if err := f.apply(f.fault(OpSetObjectPropValue)); err != nil {
+		return err
+	}
+
+	return f.dev.SetObjectPropValue(objHandle, objPropCode, value)
+}
+
+func (f *FaultInjector) SendObjectInfo(wantStorageID, wantParent uint32, info *mtp.ObjectInfo) (storageID, parent, handle uint32, err error) {
+	if err := f.apply(f.fault(OpSendObjectInfo)); err != nil {
+		return 0, 0, 0, err
+	}
+
+	return f.dev.SendObjectInfo(wantStorageID, wantParent, info)
+}
+
+func (f *FaultInjector) SendObject(r io.Reader, size int64, progressCb mtp.ProgressFunc) error {
+	fault := f.fault(OpSendObject)
+	if fault == nil || !fault.Truncate {
+		if err := f.apply(fault); err != nil {
+			return err
+		}
+
+		return f.dev.SendObject(r, size, progressCb)
+	}
+
+	time.Sleep(fault.Delay)
+
+	// only the first [TruncateAt] bytes reach the device
+	limit := fault.TruncateAt
+	if limit > size {
+		limit = size
+	}
+
+	if err := f.dev.SendObject(io.LimitReader(r, limit), limit, progressCb); err != nil {
+		return err
+	}
+
+	return truncateError(fault)
+}
+
+func (f *FaultInjector) GetObject(handle uint32, w io.Writer, progressCb mtp.ProgressFunc) error {
+	fault := f.fault(OpGetObject)
+	if fault == nil || !fault.Truncate {
+		if err := f.apply(fault); err != nil {
+			return err
+		}
+
+		return f.dev.GetObject(handle, w, progressCb)
+	}
+
+	time.Sleep(fault.Delay)
+
+	// only the first [TruncateAt] bytes reach the host
+	tw := &truncatedWriter{w: w, remaining: fault.TruncateAt}
+	err := f.dev.GetObject(handle, tw, func(sent int64) error {
+		if sent > fault.TruncateAt {
+			return nil
+		}
+
+		return progressCb(sent)
+	})
+	if err != nil {
+		return err
+	}
+
+	return truncateError(fault)
+}
+
+func (f *FaultInjector) DeleteObject(handle uint32) error {
+	if err := f.apply(f.fault(OpDeleteObject)); err != nil {
+		return err
+	}
+
+	return f.dev.DeleteObject(handle)
+}
+
+func (f *FaultInjector) RunTransaction(req *mtp.Container, rep *mtp.Container, dest io.Writer, src io.Reader, writeSize int64, progressCb mtp.ProgressFunc) error {
+	fault := f.fault(OpRunTransaction)
+	if fault == nil || !fault.Truncate {
+		if err := f.apply(fault); err != nil {
+			return err
+		}
+
+		return f.dev.RunTransaction(req, rep, dest, src, writeSize, progressCb)
+	}
+
+	time.Sleep(fault.Delay)
+
+	// only the first [TruncateAt] bytes of the data phase are transferred
+	if src != nil {
+		limit := fault.TruncateAt
+		if limit > writeSize {
+			limit = writeSize
+		}
+
+		src = io.LimitReader(src, limit)
+		writeSize = limit
+	}
+
+	if dest != nil {
+		dest = &truncatedWriter{w: dest, remaining: fault.TruncateAt}
+	}
+
+	err := f.dev.RunTransaction(req, rep, dest, src, writeSize, func(sent int64) error {
+		if sent > fault.TruncateAt {
+			return nil
+		}
+
+		return progressCb(sent)
+	})
+	if err != nil {
+		return err
+	}
+
+	return truncateError(fault)
+}
+
+func truncateError(fault *Fault) error {
+	if fault.Err != nil {
+		return fault.Err
+	}
+
+	return io.ErrUnexpectedEOF
+}
+
+// discards everything written after [remaining] bytes
+type truncatedWriter struct {
+	w         io.Writer
+	remaining int64
+}
+
+func (t *truncatedWriter) Write(p []byte) (int, error) {
+	if t.remaining <= 0 {
+		return len(p), nil
+	}
+
+	n := len(p)
+	if int64(n) > t.remaining {
+		n = int(t.remaining)
+	}
+
+	written, err := t.w.Write(p[:n])
+	t.remaining -= int64(written)
+	if err != nil {
+		return written, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,69 @@
+package mtpxtest
+
+import (
+	"bytes"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestFaultInjector(t *testing.T) {
+	Convey("Fail the Nth call | FaultInjector", t, func() {
+		dev, sid, _ := newTestDevice()
+		f := NewFaultInjector(dev, Fault{Op: OpGetStorageInfo, Nth: 2, Err: mtp.RCError(mtp.RC_StoreNotAvailable)})
+
+		var info mtp.StorageInfo
+		So(f.GetStorageInfo(sid, &info), ShouldBeNil)
+		So(f.GetStorageInfo(sid, &info), ShouldEqual, mtp.RCError(mtp.RC_StoreNotAvailable))
+		So(f.GetStorageInfo(sid, &info), ShouldBeNil)
+		So(f.Calls(OpGetStorageInfo), ShouldEqual, 3)
+	})
+
+	Convey("Truncate SendObject | FaultInjector", t, func() {
+		dev, sid, _ := newTestDevice()
+		f := NewFaultInjector(dev, Fault{Op: OpSendObject, Truncate: true, TruncateAt: 3})
+
+		data := []byte("0123456789")
+		_, _, objectId, err := f.SendObjectInfo(sid, mtp.GOH_ROOT_PARENT, &mtp.ObjectInfo{
+			Filename:       "a.txt",
+			CompressedSize: uint32(len(data)),
+		})
+		So(err, ShouldBeNil)
+
+		err = f.SendObject(bytes.NewReader(data), int64(len(data)), mtp.EmptyProgressFunc)
+		So(err, ShouldEqual, io.ErrUnexpectedEOF)
+
+		// the partial object stays on the device
+		var info mtp.ObjectInfo
+		So(f.GetObjectInfo(objectId, &info), ShouldBeNil)
+		So(info.CompressedSize, ShouldEqual, 3)
+	})
+
+	Convey("Truncate GetObject | FaultInjector", t, func() {
+		dev, sid, _ := newTestDevice()
+		f := NewFaultInjector(dev, Fault{Op: OpGetObject, Truncate: true, TruncateAt: 4, Err: mtp.RCError(mtp.RC_IncompleteTransfer)})
+
+		objectId, err := dev.WriteFile(sid, "/a.txt", []byte("0123456789"), time.Now())
+		So(err, ShouldBeNil)
+
+		var buf bytes.Buffer
+		So(f.GetObject(objectId, &buf, mtp.EmptyProgressFunc), ShouldEqual, mtp.RCError(mtp.RC_IncompleteTransfer))
+		So(buf.String(), ShouldEqual, "0123")
+	})
+
+	Convey("Drop the connection | FaultInjector", t, func() {
+		dev, sid, _ := newTestDevice()
+		f := NewFaultInjector(dev, Fault{Op: OpGetStorageIDs, Disconnect: true})
+
+		sids := mtp.Uint32Array{}
+		So(f.GetStorageIDs(&sids), ShouldEqual, ErrDisconnected)
+
+		var info mtp.StorageInfo
+		So(f.GetStorageInfo(sid, &info), ShouldEqual, ErrDisconnected)
+
+		f.Reset()
+		So(f.GetStorageInfo(sid, &info), ShouldBeNil)
+	})
+}
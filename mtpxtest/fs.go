@@ -0,0 +1,206 @@
+package mtpxtest
+
+import (
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MakeDirectory - create the directory [fullPath] recursively
+// existing directories are reused
+// returns the objectId of the directory
+func (d *Device) MakeDirectory(storageId uint32, fullPath string, modTime time.Time) (uint32, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.makeDirectory(storageId, fullPath, modTime)
+}
+
+// WriteFile - create or replace the file [fullPath] with [data]
+// the parent directories are created if they do not exist
+// returns the objectId of the file
+func (d *Device) WriteFile(storageId uint32, fullPath string, data []byte, modTime time.Time) (uint32, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	parentId, err := d.makeDirectory(storageId, path.Dir(cleanPath(fullPath)), now())
+	if err != nil {
+		return 0, err
+	}
+
+	name := path.Base(cleanPath(fullPath))
+	if existing := d.child(storageId, parentId, name); existing != nil {
+		if existing.info.ObjectFormat == mtp.OFC_Association {
+			return 0, fmt.Errorf("%s is a directory", fullPath)
+		}
+
+		d.remove(existing.handle)
+	}
+
+	o := &object{
+		info: mtp.ObjectInfo{
+			StorageID:        storageId,
+			ObjectFormat:     mtp.OFC_Undefined,
+			ParentObject:     parentId,
+			Filename:         name,
+			CompressedSize:   compressedSize(int64(len(data))),
+			ModificationDate: modTime.Truncate(time.Second),
+		},
+		data: append([]byte{}, data...),
+	}
+	d.insert(o)
+	d.updateFreeSpace(storageId, -int64(len(data)))
+
+	return o.handle, nil
+}
+
+// ReadFile - fetch the contents of the file [fullPath]
+func (d *Device) ReadFile(storageId uint32, fullPath string) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	o, err := d.lookup(storageId, fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.info.ObjectFormat == mtp.OFC_Association {
+		return nil, fmt.Errorf("%s is a directory", fullPath)
+	}
+
+	return append([]byte{}, o.data...), nil
+}
+
+// Lookup - fetch the objectId of [fullPath]
+// like on Android the lookup is case insensitive
+func (d *Device) Lookup(storageId uint32, fullPath string) (objectId uint32, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	o, err := d.lookup(storageId, fullPath)
+	if err != nil {
+		return 0, false
+	}
+
+	return o.handle, true
+}
+
+// ImportLocal - copy the local file or directory [source] into the directory [destination] on the device
+// the modification times of the local files are preserved, symlinks are not followed
+func (d *Device) ImportLocal(storageId uint32, source, destination string) error {
+	sourceParent := filepath.Dir(filepath.Clean(source))
+
+	return filepath.Walk(source, func(p string, fInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fInfo.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+
+		rel, err := filepath.Rel(sourceParent, p)
+		if err != nil {
+			return err
+		}
+
+		fullPath := path.Join(cleanPath(destination), filepath.ToSlash(rel))
+
+		if fInfo.IsDir() {
+			_, err := d.MakeDirectory(storageId, fullPath, fInfo.ModTime())
+
+			return err
+		}
+
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		_, err = d.WriteFile(storageId, fullPath, data, fInfo.ModTime())
+
+		return err
+	})
+}
+
+func (d *Device) makeDirectory(storageId uint32, fullPath string, modTime time.Time) (uint32, error) {
+	if d.storage(storageId) == nil {
+		return 0, mtp.RCError(mtp.RC_InvalidStorageId)
+	}
+
+	parentId := uint32(rootParent)
+
+	for _, name := range splitPath(fullPath) {
+		if c := d.child(storageId, parentId, name); c != nil {
+			if c.info.ObjectFormat != mtp.OFC_Association {
+				return 0, fmt.Errorf("%s is not a directory", c.info.Filename)
+			}
+
+			parentId = c.handle
+
+			continue
+		}
+
+		o := &object{
+			info: mtp.ObjectInfo{
+				StorageID:        storageId,
+				ObjectFormat:     mtp.OFC_Association,
+				ParentObject:     parentId,
+				Filename:         name,
+				ModificationDate: modTime.Truncate(time.Second),
+			},
+		}
+		d.insert(o)
+
+		parentId = o.handle
+	}
+
+	return parentId, nil
+}
+
+func (d *Device) lookup(storageId uint32, fullPath string) (*object, error) {
+	var o *object
+	parentId := uint32(rootParent)
+
+	for _, name := range splitPath(fullPath) {
+		o = d.child(storageId, parentId, name)
+		if o == nil {
+			return nil, fmt.Errorf("path not found: %s", fullPath)
+		}
+
+		parentId = o.handle
+	}
+
+	if o == nil {
+		return nil, fmt.Errorf("%s is the root directory", fullPath)
+	}
+
+	return o, nil
+}
+
+func cleanPath(fullPath string) string {
+	return path.Clean("/" + filepath.ToSlash(fullPath))
+}
+
+func splitPath(fullPath string) []string {
+	p := strings.TrimPrefix(cleanPath(fullPath), "/")
+	if p == "" {
+		return nil
+	}
+
+	return strings.Split(p, "/")
+}
+
+// the size reported in ObjectInfo; objects larger than 4GB report 0xFFFFFFFF
+func compressedSize(size int64) uint32 {
+	if size > 0xFFFFFFFF {
+		return 0xFFFFFFFF
+	}
+
+	return uint32(size)
+}
@@ -0,0 +1,597 @@
+package mtpxtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/usb"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TraceEntry - a single recorded operation
+// the values exchanged with the device are stored in their MTP encoding
+type TraceEntry struct {
+	Op Op `json:"op"`
+
+	// numeric arguments of the operation (handles, storage ids, prop codes, sizes)
+	// RunTransaction: the operation code, the request params and the size of the data sent
+	Args []int64 `json:"args,omitempty"`
+
+	// filename of the object sent using SendObjectInfo
+	Name string `json:"name,omitempty"`
+
+	// value sent to the device (SetObjectPropValue, SendObjectInfo, the data phase of RunTransaction)
+	Input []byte `json:"input,omitempty"`
+
+	// value returned by the device; the object data for GetObject and RunTransaction
+	Output []byte `json:"output,omitempty"`
+
+	// values returned by SendObjectInfo (storageId, parent, handle); the response params of RunTransaction
+	Results []uint32 `json:"results,omitempty"`
+
+	// values reported to the progress callback of SendObject, GetObject and RunTransaction
+	Progress []int64 `json:"progress,omitempty"`
+
+	Err *TraceError `json:"err,omitempty"`
+}
+
+// TraceError - a recorded error
+type TraceError struct {
+	// one of: "rc" (mtp.RCError), "usb" (usb.Error), "sync" (mtp.SyncError), "other"
+	Kind    string `json:"kind"`
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ReplayMismatchError - the replayed session made a call which was not recorded
+type ReplayMismatchError struct {
+	Op   Op
+	Args []int64
+}
+
+func (e ReplayMismatchError) Error() string {
+	return fmt.Sprintf("mtpxtest: no recorded %s call matching the arguments %v", e.Op, e.Args)
+}
+
+// Recorder - wraps a device and writes every operation to a trace
+// the trace is written as JSON lines and can be served back using [Replayer]
+type Recorder struct {
+	dev Operations
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder - record the operations on [dev] to [w]
+func NewRecorder(dev Operations, w io.Writer) *Recorder {
+	return &Recorder{
+		dev: dev,
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Err - returns the first error which occured while writing the trace
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+func (r *Recorder) record(e *TraceEntry, err error) {
+	e.Err = newTraceError(err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	r.err = r.enc.Encode(e)
+}
+
+func (r *Recorder) Close() error {
+	err := r.dev.Close()
+	r.record(&TraceEntry{Op: OpClose}, err)
+
+	return err
+}
+
+func (r *Recorder) GetDeviceInfo(info *mtp.DeviceInfo) error {
+	err := r.dev.GetDeviceInfo(info)
+	r.record(&TraceEntry{Op: OpGetDeviceInfo, Output: encodeValue(info, err)}, err)
+
+	return err
+}
+
+func (r *Recorder) GetStorageIDs(info *mtp.Uint32Array) error {
+	err := r.dev.GetStorageIDs(info)
+	r.record(&TraceEntry{Op: OpGetStorageIDs, Output: encodeValue(info, err)}, err)
+
+	return err
+}
+
+func (r *Recorder) GetStorageInfo(ID uint32, info *mtp.StorageInfo) error {
+	err := r.dev.GetStorageInfo(ID, info)
+	r.record(&TraceEntry{Op: OpGetStorageInfo, Args: []int64{int64(ID)}, Output: encodeValue(info, err)}, err)
+
+	return err
+}
+
+func (r *Recorder) GetObjectHandles(storageID, objFormatCode, parent uint32, info *mtp.Uint32Array) error {
+	err := r.dev.GetObjectHandles(storageID, objFormatCode, parent, info)
+	r.record(&TraceEntry{
+		Op:     OpGetObjectHandles,
+		Args:   []int64{int64(storageID), int64(objFormatCode), int64(parent)},
+		Output: encodeValue(info, err),
+	}, err)
+
+	return err
+}
+
+func (r *Recorder) GetObjectInfo(handle uint32, info *mtp.ObjectInfo) error {
+	err := r.dev.GetObjectInfo(handle, info)
+	r.record(&TraceEntry{Op: OpGetObjectInfo, Args: []int64{int64(handle)}, Output: encodeValue(info, err)}, err)
+
+	return err
+}
+
+func (r *Recorder) GetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error {
+	err := r.dev.GetObjectPropValue(objHandle, objPropCode, value)
+	r.record(&TraceEntry{
+		Op:     OpGetObjectPropValue,
+		Args:   []int64{int64(objHandle), int64(objPropCode)},
+		Output: encodeValue(value, err),
+	}, err)
+
+	return err
+}
+
+func (r *Recorder) SetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error {
+	err := r.dev.SetObjectPropValue(objHandle, objPropCode, value)
+	r.record(&TraceEntry{
+		Op:    OpSetObjectPropValue,
+		Args:  []int64{int64(objHandle), int64(objPropCode)},
+		Input: encodeValue(value, nil),
+	}, err)
+
+	return err
+}
+
+func (r *Recorder) SendObjectInfo(wantStorageID, wantParent uint32, info *mtp.ObjectInfo) (storageID, parent, handle uint32, err error) {
+	storageID, parent, handle, err = r.dev.SendObjectInfo(wantStorageID, wantParent, info)
+	r.record(&TraceEntry{
+		Op:      OpSendObjectInfo,
+		Args:    []int64{int64(wantStorageID), int64(wantParent)},
+		Name:    info.Filename,
+		Input:   encodeValue(info, nil),
+		Results: []uint32{storageID, parent, handle},
+	}, err)
+
+	return storageID, parent, handle, err
+}
+
+func (r *Recorder) SendObject(rd io.Reader, size int64, progressCb mtp.ProgressFunc) error {
+	var progress []int64
+	err := r.dev.SendObject(rd, size, func(sent int64) error {
+		progress = append(progress, sent)
+
+		return progressCb(sent)
+	})
+	r.record(&TraceEntry{Op: OpSendObject, Args: []int64{size}, Progress: progress}, err)
+
+	return err
+}
+
+func (r *Recorder) GetObject(handle uint32, w io.Writer, progressCb mtp.ProgressFunc) error {
+	var buf bytes.Buffer
+	var progress []int64
+	err := r.dev.GetObject(handle, io.MultiWriter(w, &buf), func(sent int64) error {
+		progress = append(progress, sent)
+
+		return progressCb(sent)
+	})
+	r.record(&TraceEntry{Op: OpGetObject, Args: []int64{int64(handle)}, Output: buf.Bytes(), Progress: progress}, err)
+
+	return err
+}
+
+func (r *Recorder) DeleteObject(handle uint32) error {
+	err := r.dev.DeleteObject(handle)
+	r.record(&TraceEntry{Op: OpDeleteObject, Args: []int64{int64(handle)}}, err)
+
+	return err
+}
+
+func (r *Recorder) RunTransaction(req *mtp.Container, rep *mtp.Container, dest io.Writer, src io.Reader, writeSize int64, progressCb mtp.ProgressFunc) error {
+	var input, output bytes.Buffer
+	if src != nil {
+		src = io.TeeReader(src, &input)
+	}
+	if dest != nil {
+		dest = io.MultiWriter(dest, &output)
+	}
+
+	var progress []int64
+	err := r.dev.RunTransaction(req, rep, dest, src, writeSize, func(sent int64) error {
+		progress = append(progress, sent)
+
+		return progressCb(sent)
+	})
+	r.record(&TraceEntry{
+		Op:       OpRunTransaction,
+		Args:     transactionArgs(req, writeSize),
+		Input:    input.Bytes(),
+		Output:   output.Bytes(),
+		Results:  rep.Param,
+		Progress: progress,
+	}, err)
+
+	return err
+}
+
+// Replayer - serves a recorded trace as a device
+// every call is answered by the first unused entry recorded with the same operation and arguments,
+// so the order of independent calls may differ from the recorded session
+type Replayer struct {
+	mu      sync.Mutex
+	entries []TraceEntry
+	used    []bool
+}
+
+// NewReplayer - read a trace written by [Recorder]
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	var entries []TraceEntry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<30)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var e TraceEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &Replayer{entries: entries, used: make([]bool, len(entries))}, nil
+}
+
+// OpenReplayer - read the trace file [filename]
+func OpenReplayer(filename string) (*Replayer, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return NewReplayer(f)
+}
+
+// Remaining - number of recorded entries which were not replayed yet
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, used := range r.used {
+		if !used {
+			count += 1
+		}
+	}
+
+	return count
+}
+
+// find and consume the entry matching [e]
+func (r *Replayer) next(e *TraceEntry) (*TraceEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := e.key()
+	for i := range r.entries {
+		if r.used[i] || r.entries[i].key() != key {
+			continue
+		}
+
+		r.used[i] = true
+
+		return &r.entries[i], nil
+	}
+
+	return nil, ReplayMismatchError{Op: e.Op, Args: e.Args}
+}
+
+// replay an operation which returns a value
+func (r *Replayer) replay(e *TraceEntry, value interface{}) error {
+	recorded, err := r.next(e)
+	if err != nil {
+		return err
+	}
+
+	if recorded.Err != nil {
+		return recorded.Err.error()
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	return mtp.Decode(&decodeReader{bytes.NewReader(recorded.Output)}, value)
+}
+
+func (r *Replayer) Close() error {
+	return r.replay(&TraceEntry{Op: OpClose}, nil)
+}
+
+func (r *Replayer) GetDeviceInfo(info *mtp.DeviceInfo) error {
+	return r.replay(&TraceEntry{Op: OpGetDeviceInfo}, info)
+}
+
+func (r *Replayer) GetStorageIDs(info *mtp.Uint32Array) error {
+	return r.replay(&TraceEntry{Op: OpGetStorageIDs}, info)
+}
+
+func (r *Replayer) GetStorageInfo(ID uint32, info *mtp.StorageInfo) error {
+	return r.replay(&TraceEntry{Op: OpGetStorageInfo, Args: []int64{int64(ID)}}, info)
+}
+
+func (r *Replayer) GetObjectHandles(storageID, objFormatCode, parent uint32, info *mtp.Uint32Array) error {
+	return r.replay(&TraceEntry{
+		Op:   OpGetObjectHandles,
+		Args: []int64{int64(storageID), int64(objFormatCode), int64(parent)},
+	}, info)
+}
+
+func (r *Replayer) GetObjectInfo(handle uint32, info *mtp.ObjectInfo) error {
+	return r.replay(&TraceEntry{Op: OpGetObjectInfo, Args: []int64{int64(handle)}}, info)
+}
+
+func (r *Replayer) GetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error {
+	return r.replay(&TraceEntry{Op: OpGetObjectPropValue, Args: []int64{int64(objHandle), int64(objPropCode)}}, value)
+}
+
+func (r *Replayer) SetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error {
+	return r.replay(&TraceEntry{
+		Op:    OpSetObjectPropValue,
+		Args:  []int64{int64(objHandle), int64(objPropCode)},
+		Input: encodeValue(value, nil),
+	}, nil)
+}
+
+func (r *Replayer) SendObjectInfo(wantStorageID, wantParent uint32, info *mtp.ObjectInfo) (storageID, parent, handle uint32, err error) {
+	recorded, err := r.next(&TraceEntry{
+		Op:   OpSendObjectInfo,
+		Args: []int64{int64(wantStorageID), int64(wantParent)},
+		Name: info.Filename,
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if recorded.Err != nil {
+		return 0, 0, 0, recorded.Err.error()
+	}
+
+	if len(recorded.Results) != 3 {
+		return 0, 0, 0, fmt.Errorf("mtpxtest: invalid SendObjectInfo entry: %v", recorded.Results)
+	}
+
+	return recorded.Results[0], recorded.Results[1], recorded.Results[2], nil
+}
+
+func (r *Replayer) SendObject(rd io.Reader, size int64, progressCb mtp.ProgressFunc) error {
+	recorded, err := r.next(&TraceEntry{Op: OpSendObject, Args: []int64{size}})
+	if err != nil {
+		return err
+	}
+
+	var read int64
+	for _, sent := range recorded.Progress {
+		n, err := io.CopyN(ioutil.Discard, rd, sent-read)
+		read += n
+		if err != nil {
+			return err
+		}
+
+		if err := progressCb(sent); err != nil {
+			return err
+		}
+	}
+
+	if recorded.Err != nil {
+		return recorded.Err.error()
+	}
+
+	return nil
+}
+
+func (r *Replayer) GetObject(handle uint32, w io.Writer, progressCb mtp.ProgressFunc) error {
+	recorded, err := r.next(&TraceEntry{Op: OpGetObject, Args: []int64{int64(handle)}})
+	if err != nil {
+		return err
+	}
+
+	if err := writeRecorded(recorded, w, progressCb); err != nil {
+		return err
+	}
+
+	if recorded.Err != nil {
+		return recorded.Err.error()
+	}
+
+	return nil
+}
+
+func (r *Replayer) DeleteObject(handle uint32) error {
+	return r.replay(&TraceEntry{Op: OpDeleteObject, Args: []int64{int64(handle)}}, nil)
+}
+
+func (r *Replayer) RunTransaction(req *mtp.Container, rep *mtp.Container, dest io.Writer, src io.Reader, writeSize int64, progressCb mtp.ProgressFunc) error {
+	recorded, err := r.next(&TraceEntry{Op: OpRunTransaction, Args: transactionArgs(req, writeSize)})
+	if err != nil {
+		return err
+	}
+
+	if src != nil {
+		if _, err := io.CopyN(ioutil.Discard, src, writeSize); err != nil {
+			return err
+		}
+	}
+
+	if dest != nil {
+		if err := writeRecorded(recorded, dest, progressCb); err != nil {
+			return err
+		}
+	}
+
+	rep.Code = mtp.RC_OK
+	rep.Param = recorded.Results
+
+	if recorded.Err != nil {
+		err := recorded.Err.error()
+
+		var rcErr mtp.RCError
+		if errors.As(err, &rcErr) {
+			rep.Code = uint16(rcErr)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// write the recorded object data to [w] in the recorded chunks
+func writeRecorded(recorded *TraceEntry, w io.Writer, progressCb mtp.ProgressFunc) error {
+	var written int64
+	for _, sent := range recorded.Progress {
+		if sent > int64(len(recorded.Output)) {
+			sent = int64(len(recorded.Output))
+		}
+
+		n, err := w.Write(recorded.Output[written:sent])
+		written += int64(n)
+		if err != nil {
+			return err
+		}
+
+		if err := progressCb(sent); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// the arguments of a transaction: operation code, request params and the size of the data sent
+func transactionArgs(req *mtp.Container, writeSize int64) []int64 {
+	args := []int64{int64(req.Code)}
+	for _, p := range req.Param {
+		args = append(args, int64(p))
+	}
+
+	return append(args, writeSize)
+}
+
+// the values used to match a call with the recorded entries
+func (e *TraceEntry) key() string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("%s|%v|%s", e.Op, e.Args, e.Name))
+
+	// the value of SendObjectInfo carries timestamps which differ between the sessions, it is matched using the filename instead
+	if e.Op == OpSetObjectPropValue {
+		sb.WriteString("|")
+		sb.WriteString(hex.EncodeToString(e.Input))
+	}
+
+	return sb.String()
+}
+
+func newTraceError(err error) *TraceError {
+	if err == nil {
+		return nil
+	}
+
+	var rcErr mtp.RCError
+	if errors.As(err, &rcErr) {
+		return &TraceError{Kind: "rc", Code: int(rcErr), Message: err.Error()}
+	}
+
+	var usbErr usb.Error
+	if errors.As(err, &usbErr) {
+		return &TraceError{Kind: "usb", Code: int(usbErr), Message: err.Error()}
+	}
+
+	var syncErr mtp.SyncError
+	if errors.As(err, &syncErr) {
+		return &TraceError{Kind: "sync", Message: string(syncErr)}
+	}
+
+	return &TraceError{Kind: "other", Message: err.Error()}
+}
+
+func (e *TraceError) error() error {
+	switch e.Kind {
+	case "rc":
+		return mtp.RCError(e.Code)
+
+	case "usb":
+		return usb.Error(e.Code)
+
+	case "sync":
+		return mtp.SyncError(e.Message)
+
+	default:
+		return errors.New(e.Message)
+	}
+}
+
+// MTP encoding of [value]
+// returns nil if the operation failed
+func encodeValue(value interface{}, err error) []byte {
+	if err != nil || value == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := mtp.Encode(&buf, value); err != nil {
+		return nil
+	}
+
+	return buf.Bytes()
+}
+
+// mtp.Decode reads empty arrays using a zero length read which bytes.Reader answers with io.EOF once the data was consumed
+type decodeReader struct {
+	r *bytes.Reader
+}
+
+func (d *decodeReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	return d.r.Read(p)
+}
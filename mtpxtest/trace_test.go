@@ -0,0 +1,80 @@
+package mtpxtest
+
+import (
+	"bytes"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestTrace(t *testing.T) {
+	Convey("Record and replay a session | Recorder | Replayer", t, func() {
+		dev, sid, _ := newTestDevice()
+
+		modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		objectId, err := dev.WriteFile(sid, "/a.txt", []byte("0123456789"), modTime)
+		So(err, ShouldBeNil)
+
+		var trace bytes.Buffer
+		rec := NewRecorder(dev, &trace)
+
+		var recInfo mtp.ObjectInfo
+		So(rec.GetObjectInfo(objectId, &recInfo), ShouldBeNil)
+
+		var recBuf bytes.Buffer
+		So(rec.GetObject(objectId, &recBuf, mtp.EmptyProgressFunc), ShouldBeNil)
+
+		So(rec.GetObjectInfo(1234567, &mtp.ObjectInfo{}), ShouldEqual, mtp.RCError(mtp.RC_InvalidObjectHandle))
+		So(rec.SetObjectPropValue(objectId, mtp.OPC_ObjectFileName, &mtp.StringValue{Value: "b.txt"}), ShouldBeNil)
+		So(rec.Err(), ShouldBeNil)
+
+		rep, err := NewReplayer(&trace)
+		So(err, ShouldBeNil)
+		So(rep.Remaining(), ShouldEqual, 4)
+
+		// the calls are matched using their arguments, the order may differ
+		So(rep.SetObjectPropValue(objectId, mtp.OPC_ObjectFileName, &mtp.StringValue{Value: "b.txt"}), ShouldBeNil)
+		So(rep.GetObjectInfo(1234567, &mtp.ObjectInfo{}), ShouldEqual, mtp.RCError(mtp.RC_InvalidObjectHandle))
+
+		var repInfo mtp.ObjectInfo
+		So(rep.GetObjectInfo(objectId, &repInfo), ShouldBeNil)
+		So(repInfo, ShouldResemble, recInfo)
+
+		var repBuf bytes.Buffer
+		var progress []int64
+		err = rep.GetObject(objectId, &repBuf, func(sent int64) error {
+			progress = append(progress, sent)
+
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(repBuf.String(), ShouldEqual, "0123456789")
+		So(progress, ShouldResemble, []int64{10})
+		So(rep.Remaining(), ShouldEqual, 0)
+
+		// every recorded entry is served once
+		err = rep.GetObjectInfo(objectId, &repInfo)
+		So(err, ShouldHaveSameTypeAs, ReplayMismatchError{})
+	})
+
+	Convey("Replay a sync error and a disconnect | Recorder | Replayer", t, func() {
+		dev, sid, _ := newTestDevice()
+		f := NewFaultInjector(dev,
+			Fault{Op: OpGetStorageInfo, Nth: 1, Err: mtp.SyncError("transaction ID mismatch")},
+			Fault{Op: OpGetStorageIDs, Disconnect: true},
+		)
+
+		var trace bytes.Buffer
+		rec := NewRecorder(f, &trace)
+
+		So(rec.GetStorageInfo(sid, &mtp.StorageInfo{}), ShouldHaveSameTypeAs, mtp.SyncError(""))
+		So(rec.GetStorageIDs(&mtp.Uint32Array{}), ShouldEqual, ErrDisconnected)
+
+		rep, err := NewReplayer(&trace)
+		So(err, ShouldBeNil)
+
+		So(rep.GetStorageInfo(sid, &mtp.StorageInfo{}), ShouldEqual, mtp.SyncError("transaction ID mismatch"))
+		So(rep.GetStorageIDs(&mtp.Uint32Array{}), ShouldEqual, ErrDisconnected)
+	})
+}
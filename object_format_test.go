@@ -0,0 +1,124 @@
+package mtpx
+
+import (
+	"bytes"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var pngHeader = []byte("\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0DIHDR")
+
+func TestObjectFormat(t *testing.T) {
+	Convey("Detect the object format | detectObjectFormat", t, func() {
+		supported := []uint16{mtp.OFC_Text, mtp.OFC_EXIF_JPEG, mtp.OFC_PNG, mtp.OFC_MP3}
+
+		So(detectObjectFormat("photo.jpg", nil, supported), ShouldEqual, mtp.OFC_EXIF_JPEG)
+		So(detectObjectFormat("PHOTO.JPEG", nil, supported), ShouldEqual, mtp.OFC_EXIF_JPEG)
+		So(detectObjectFormat("song.mp3", pngHeader, supported), ShouldEqual, mtp.OFC_MP3)
+
+		// the contents are sniffed if the extension is unknown
+		So(detectObjectFormat("image", pngHeader, supported), ShouldEqual, mtp.OFC_PNG)
+		So(detectObjectFormat("notes.log", []byte("plain text"), supported), ShouldEqual, mtp.OFC_Text)
+		So(detectObjectFormat("blob.bin", []byte{0x00, 0x01, 0x02}, supported), ShouldEqual, mtp.OFC_Undefined)
+
+		// the format is not supported by the device
+		So(detectObjectFormat("movie.mp4", nil, supported), ShouldEqual, mtp.OFC_Undefined)
+		So(detectObjectFormat("photo.jpg", nil, nil), ShouldEqual, mtp.OFC_Undefined)
+	})
+
+	if isUsbTestDevice() {
+		return
+	}
+
+	const destination = "/mtp-test-files/temp_dir/test_ObjectFormat"
+
+	objectFormatOf := func(dev Device, sid uint32, fullPath string) uint16 {
+		fi, err := GetObjectFromPath(dev, sid, fullPath)
+		So(err, ShouldBeNil)
+
+		return fi.Info.ObjectFormat
+	}
+
+	upload := func(dev Device, sid uint32, options UploadOptions) error {
+		_, _, _, _, err := UploadFilesWithOptions(dev, sid,
+			[]string{getTestMocksAsset("a.txt")},
+			destination,
+			false,
+			options,
+			func(fi *os.FileInfo, fullPath string, err error) error {
+				return nil
+			},
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+
+		return err
+	}
+
+	Convey("Set the object format of the uploaded files | UploadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		So(upload(dev, sid, UploadOptions{}), ShouldBeNil)
+		So(objectFormatOf(dev, sid, destination+"/a.txt"), ShouldEqual, mtp.OFC_Text)
+
+		var formats []uint16
+		So(upload(dev, sid, UploadOptions{
+			ObjectFormatCb: func(fi *os.FileInfo, fullPath string, format uint16) (uint16, error) {
+				formats = append(formats, format)
+
+				return mtp.OFC_Undefined, nil
+			},
+		}), ShouldBeNil)
+		So(formats, ShouldResemble, []uint16{mtp.OFC_Text})
+		So(objectFormatOf(dev, sid, destination+"/a.txt"), ShouldEqual, mtp.OFC_Undefined)
+	})
+
+	Convey("The format is not supported by the device | UploadFilesWithOptions", t, func() {
+		sim, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		sim.(*mtpxtest.Device).DeviceInfo.PlaybackFormats = []uint16{mtp.OFC_Undefined, mtp.OFC_Association}
+
+		storages, err := FetchStorages(sim)
+		So(err, ShouldBeNil)
+		sid := storages[0].Sid
+
+		So(upload(sim, sid, UploadOptions{}), ShouldBeNil)
+		So(objectFormatOf(sim, sid, destination+"/a.txt"), ShouldEqual, mtp.OFC_Undefined)
+	})
+
+	Convey("Sniff the object format of a stream | UploadStream", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		data := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{0}, 1024)...)
+		_, err := UploadStream(dev, sid, FileProp{0, destination}, "image", bytes.NewReader(data), int64(len(data)), time.Now(),
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+		So(objectFormatOf(dev, sid, destination+"/image"), ShouldEqual, mtp.OFC_PNG)
+
+		// the whole stream is sent
+		var buf bytes.Buffer
+		_, err = DownloadTo(dev, sid, FileProp{0, destination + "/image"}, &buf, func(total, sent int64, objectId uint32, err error) error {
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(buf.Bytes(), ShouldResemble, data)
+
+		_, err = UploadStream(dev, sid, FileProp{0, destination}, "song.mp3", strings.NewReader(""), 0, time.Now(),
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+		So(objectFormatOf(dev, sid, destination+"/song.mp3"), ShouldEqual, mtp.OFC_MP3)
+	})
+}
@@ -0,0 +1,358 @@
+package mtpx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TransferPlan - what an upload or a download would do, without transferring anything
+// it is made by [PlanUpload] or [PlanDownload] and can be serialized to JSON and executed later using [TransferPlan.Execute]
+type TransferPlan struct {
+	Kind TransferKind
+
+	StorageId   uint32
+	Sources     []string
+	Destination string
+
+	// the conflict policy used to plan and to execute the transfer
+	ConflictPolicy ConflictPolicy
+
+	// the options used to execute the transfer, see [UploadOptions] and [DownloadOptions]
+	ContinueOnError bool
+	Verify          VerifyMode
+
+	// the destination directories which do not exist yet
+	Directories []string
+
+	// the files to transfer, including the ones which would be skipped because of a conflict
+	Files []PlannedFile
+
+	// the files whose destination already Exists
+	Conflicts []ConflictInfo
+
+	// total number and size of the files which would be transferred
+	// the files which would be skipped are not counted
+	TotalFiles int64
+	TotalSize  int64
+
+	// the callbacks of the options the plan was made with
+	// they cannot be serialized, a plan restored from JSON is executed without them
+	conflictCb     ConflictCb
+	objectFormatCb ObjectFormatCb
+}
+
+// PlannedFile - a file of a [TransferPlan]
+type PlannedFile struct {
+	SourcePath      string
+	DestinationPath string
+	Size            int64
+	ModTime         time.Time
+
+	// objectId of the source file of a download
+	ObjectId uint32
+
+	// the policy which would be applied if the destination already Exists; empty if there is no conflict
+	// [ConflictAsk] is left to be decided by the [ConflictCb] while executing the plan
+	ConflictAction ConflictPolicy
+}
+
+// PlanUpload - plan [UploadFilesWithOptions] without writing anything to the device
+// the local files are walked and mapped to the device paths the same way [UploadFiles] does
+func PlanUpload(dev Device, storageId uint32, sources []string, destination string, options UploadOptions) (*TransferPlan, error) {
+	_destination := fixSlash(destination)
+
+	plan := &TransferPlan{
+		Kind:            UploadTransfer,
+		StorageId:       storageId,
+		Sources:         sources,
+		Destination:     _destination,
+		ConflictPolicy:  options.ConflictPolicy,
+		ContinueOnError: options.ContinueOnError,
+		Verify:          options.Verify,
+		conflictCb:      options.ConflictCb,
+		objectFormatCb:  options.ObjectFormatCb,
+	}
+
+	// the device objects of the destination paths; nil if the object does not exist
+	objects := map[string]*FileInfo{}
+	var lookup func(fullPath string) (*FileInfo, error)
+	lookup = func(fullPath string) (*FileInfo, error) {
+		if fullPath == PathSep {
+			return GetObjectFromObjectId(dev, ParentObjectId, "")
+		}
+
+		if fi, ok := objects[fullPath]; ok {
+			return fi, nil
+		}
+
+		parent, err := lookup(filepath.Dir(fullPath))
+		if err != nil {
+			return nil, err
+		}
+
+		var fi *FileInfo
+		if parent != nil {
+			fi, err = GetObjectFromParentIdAndFilename(dev, storageId, parent.ObjectId, filepath.Base(fullPath))
+			if err != nil {
+				switch err.(type) {
+				case FileNotFoundError:
+					fi = nil
+
+				default:
+					return nil, err
+				}
+			}
+		}
+
+		objects[fullPath] = fi
+
+		return fi, nil
+	}
+
+	// plan the directories which do not exist yet, starting with the topmost one
+	var planDirectory func(fullPath string) error
+	planDirectory = func(fullPath string) error {
+		if fullPath == PathSep {
+			return nil
+		}
+
+		if fi, err := lookup(fullPath); err != nil || fi != nil {
+			return err
+		}
+
+		if err := planDirectory(filepath.Dir(fullPath)); err != nil {
+			return err
+		}
+
+		if contains, _ := StringContains(plan.Directories, fullPath); !contains {
+			plan.Directories = append(plan.Directories, fullPath)
+		}
+
+		return nil
+	}
+
+	if err := planDirectory(_destination); err != nil {
+		return nil, err
+	}
+
+	for _, source := range sources {
+		_source := fixSlash(source)
+		sourceParentPath := filepath.Dir(_source)
+
+		_, _, _, err := walkLocalFiles([]string{_source}, func(fInfo *os.FileInfo, fullPath string, err error) error {
+			if err != nil {
+				return err
+			}
+
+			fullPath = fixSlash(fullPath)
+			destinationParentPath, destinationFilePath := mapSourcePathToDestinationPath(
+				fullPath, sourceParentPath, _destination,
+			)
+
+			if (*fInfo).IsDir() {
+				return planDirectory(destinationFilePath)
+			}
+
+			if err := planDirectory(destinationParentPath); err != nil {
+				return err
+			}
+
+			existing, err := lookup(destinationFilePath)
+			if err != nil {
+				return err
+			}
+
+			f := PlannedFile{
+				SourcePath:      fullPath,
+				DestinationPath: destinationFilePath,
+				Size:            (*fInfo).Size(),
+				ModTime:         (*fInfo).ModTime(),
+			}
+
+			if existing != nil {
+				f.ConflictAction = planConflict(plan, &ConflictInfo{
+					SourcePath:         fullPath,
+					SourceSize:         f.Size,
+					SourceModTime:      f.ModTime,
+					DestinationPath:    destinationFilePath,
+					DestinationSize:    existing.Size,
+					DestinationModTime: existing.ModTime,
+				})
+			}
+
+			addPlannedFile(plan, f)
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+// PlanDownload - plan [DownloadFilesWithOptions] without writing anything to the local disk
+// the device objects are walked and mapped to the local paths the same way [DownloadFiles] does
+func PlanDownload(dev Device, storageId uint32, sources []string, destination string, options DownloadOptions) (*TransferPlan, error) {
+	_destination := fixSlash(destination)
+
+	plan := &TransferPlan{
+		Kind:            DownloadTransfer,
+		StorageId:       storageId,
+		Sources:         sources,
+		Destination:     _destination,
+		ConflictPolicy:  options.ConflictPolicy,
+		ContinueOnError: options.ContinueOnError,
+		Verify:          options.Verify,
+		conflictCb:      options.ConflictCb,
+	}
+
+	planDirectory := func(fullPath string) {
+		if contains, _ := StringContains(plan.Directories, fullPath); contains || fileExistsLocal(fullPath) {
+			return
+		}
+
+		plan.Directories = append(plan.Directories, fullPath)
+	}
+
+	for _, source := range sources {
+		_source := fixSlash(source)
+		sourceParentPath := filepath.Dir(_source)
+
+		_, _, _, err := Walk(dev, storageId, _source, true, true, false,
+			func(objectId uint32, fi *FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+
+				destinationParentPath, destinationFilePath := mapSourcePathToDestinationPath(
+					fi.FullPath, sourceParentPath, _destination,
+				)
+
+				if fi.IsDir {
+					planDirectory(destinationFilePath)
+
+					return nil
+				}
+
+				// filter out disallowed files
+				if isDisallowedFiles(fi.Name) {
+					return nil
+				}
+
+				planDirectory(destinationParentPath)
+
+				f := PlannedFile{
+					SourcePath:      fi.FullPath,
+					DestinationPath: destinationFilePath,
+					Size:            fi.Size,
+					ModTime:         fi.ModTime,
+					ObjectId:        fi.ObjectId,
+				}
+
+				if stat, err := os.Lstat(destinationFilePath); err == nil {
+					f.ConflictAction = planConflict(plan, &ConflictInfo{
+						SourcePath:         fi.FullPath,
+						SourceSize:         fi.Size,
+						SourceModTime:      fi.ModTime,
+						DestinationPath:    destinationFilePath,
+						DestinationSize:    stat.Size(),
+						DestinationModTime: stat.ModTime(),
+					})
+				}
+
+				addPlannedFile(plan, f)
+
+				return nil
+			})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+// Execute - run the planned transfer
+// the sources are walked again, so the changes made since the plan was made are transferred as they are now
+// the transfer uses the options the plan was made with
+// [conflictCb] replaces the [ConflictCb] of the options if it is not nil, it is required if the [ConflictPolicy] of the plan is [ConflictAsk] and the plan was restored from JSON
+// return:
+// [bulkFilesSent]: total transferred files (directory count not included)
+// [bulkSizeSent]: total size of the transferred files
+// [report]: outcome of every file
+func (p *TransferPlan) Execute(dev Device, conflictCb ConflictCb, progressCb ProgressCb) (bulkFilesSent int64, bulkSizeSent int64, report *TransferReport, err error) {
+	if conflictCb == nil {
+		conflictCb = p.conflictCb
+	}
+
+	switch p.Kind {
+	case UploadTransfer:
+		options := UploadOptions{
+			ConflictPolicy:  p.ConflictPolicy,
+			ConflictCb:      conflictCb,
+			ContinueOnError: p.ContinueOnError,
+			Verify:          p.Verify,
+			ObjectFormatCb:  p.objectFormatCb,
+		}
+
+		_, bulkFilesSent, bulkSizeSent, report, err = UploadFilesWithOptions(dev, p.StorageId, p.Sources, p.Destination, false,
+			options,
+			func(fi *os.FileInfo, fullPath string, err error) error {
+				return nil
+			},
+			progressCb,
+		)
+
+		return bulkFilesSent, bulkSizeSent, report, err
+
+	case DownloadTransfer:
+		options := DownloadOptions{
+			ConflictPolicy:  p.ConflictPolicy,
+			ConflictCb:      conflictCb,
+			ContinueOnError: p.ContinueOnError,
+			Verify:          p.Verify,
+		}
+
+		return DownloadFilesWithOptions(dev, p.StorageId, p.Sources, p.Destination, false,
+			options,
+			func(fi *FileInfo, err error) error {
+				return nil
+			},
+			progressCb,
+		)
+	}
+
+	return 0, 0, nil, fmt.Errorf("invalid transfer plan kind: %s", p.Kind)
+}
+
+// the policy which would resolve the conflict [c]
+// [ConflictAsk] is kept as it is since the decision is made while executing the plan
+func planConflict(plan *TransferPlan, c *ConflictInfo) ConflictPolicy {
+	plan.Conflicts = append(plan.Conflicts, *c)
+
+	if plan.ConflictPolicy == ConflictAsk {
+		return ConflictAsk
+	}
+
+	action, err := resolveConflictPolicy(plan.ConflictPolicy, nil, c)
+	if err != nil && action == "" {
+		return plan.ConflictPolicy
+	}
+
+	return action
+}
+
+func addPlannedFile(plan *TransferPlan, f PlannedFile) {
+	plan.Files = append(plan.Files, f)
+
+	if f.ConflictAction == ConflictSkip {
+		return
+	}
+
+	plan.TotalFiles += 1
+	plan.TotalSize += f.Size
+}
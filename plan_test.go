@@ -0,0 +1,167 @@
+package mtpx
+
+import (
+	"encoding/json"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanTransfers(t *testing.T) {
+	Convey("Plan and execute an upload | PlanUpload", t, func() {
+		if isUsbTestDevice() {
+			SkipSo("the upload plan tests require the simulated device")
+
+			return
+		}
+
+		const destination = "/mtp-test-files/temp_dir/test_PlanUpload"
+
+		dev, sid := newFaultInjectorTestDevice()
+		sources := []string{getTestMocksAsset("mock_dir1")}
+
+		plan, err := PlanUpload(dev, sid, sources, destination, UploadOptions{ConflictPolicy: ConflictSkip})
+		So(err, ShouldBeNil)
+		So(plan.Kind, ShouldEqual, UploadTransfer)
+		So(len(plan.Files), ShouldEqual, mockDir1TotalFiles)
+		So(plan.TotalFiles, ShouldEqual, mockDir1TotalFiles)
+		So(plan.TotalSize, ShouldBeGreaterThan, 0)
+		So(plan.Conflicts, ShouldBeEmpty)
+		So(plan.Directories, ShouldContain, destination)
+		So(plan.Directories, ShouldContain, destination+"/mock_dir1/3/2")
+
+		// nothing was written
+		So(dev.Calls(mtpxtest.OpSendObjectInfo), ShouldEqual, 0)
+		So(dev.Calls(mtpxtest.OpSendObject), ShouldEqual, 0)
+
+		data, err := json.Marshal(plan)
+		So(err, ShouldBeNil)
+
+		var decoded TransferPlan
+		So(json.Unmarshal(data, &decoded), ShouldBeNil)
+		So(decoded.Files, ShouldHaveLength, mockDir1TotalFiles)
+
+		bulkFilesSent, bulkSizeSent, _, err := decoded.Execute(dev, nil, func(fi *ProgressInfo, err error) error {
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, mockDir1TotalFiles)
+		So(bulkSizeSent, ShouldEqual, plan.TotalSize)
+
+		// every file conflicts now
+		plan, err = PlanUpload(dev, sid, sources, destination, UploadOptions{ConflictPolicy: ConflictSkip})
+		So(err, ShouldBeNil)
+		So(plan.Directories, ShouldBeEmpty)
+		So(plan.Conflicts, ShouldHaveLength, mockDir1TotalFiles)
+		So(plan.TotalFiles, ShouldEqual, 0)
+		So(plan.TotalSize, ShouldEqual, 0)
+
+		for _, f := range plan.Files {
+			So(f.ConflictAction, ShouldEqual, ConflictSkip)
+		}
+	})
+
+	Convey("Execute with the options of the plan | TransferPlan.Execute", t, func() {
+		if isUsbTestDevice() {
+			SkipSo("the upload plan tests require the simulated device")
+
+			return
+		}
+
+		const destination = "/mtp-test-files/temp_dir/test_PlanExecute"
+
+		dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:  mtpxtest.OpSendObject,
+			Nth: 2,
+			Err: mtp.RCError(mtp.RC_AccessDenied),
+		})
+
+		var formats int
+		plan, err := PlanUpload(dev, sid, []string{getTestMocksAsset("mock_dir1")}, destination, UploadOptions{
+			ContinueOnError: true,
+			Verify:          VerifyChecksum,
+			ObjectFormatCb: func(fi *os.FileInfo, fullPath string, format uint16) (uint16, error) {
+				formats += 1
+
+				return format, nil
+			},
+		})
+		So(err, ShouldBeNil)
+
+		var lastInfo ProgressInfo
+		_, _, report, err := plan.Execute(dev, nil, func(fi *ProgressInfo, err error) error {
+			lastInfo = *fi
+
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(report.Failed, ShouldHaveLength, 1)
+		So(report.Succeeded, ShouldHaveLength, mockDir1TotalFiles-1)
+		So(lastInfo.FilesVerified, ShouldEqual, mockDir1TotalFiles-1)
+		So(formats, ShouldEqual, mockDir1TotalFiles)
+
+		// the serializable options survive the JSON round trip
+		data, err := json.Marshal(plan)
+		So(err, ShouldBeNil)
+
+		var decoded TransferPlan
+		So(json.Unmarshal(data, &decoded), ShouldBeNil)
+		So(decoded.ContinueOnError, ShouldBeTrue)
+		So(decoded.Verify, ShouldEqual, VerifyChecksum)
+
+		// the source paths are cleaned like the rest of the package does
+		plan, err = PlanUpload(dev, sid, []string{getTestMocksAsset("mock_dir1") + "/./a.txt"}, destination, UploadOptions{})
+		So(err, ShouldBeNil)
+		So(plan.Files, ShouldHaveLength, 1)
+		So(plan.Files[0].SourcePath, ShouldEqual, fixSlash(getTestMocksAsset("mock_dir1/a.txt")))
+	})
+
+	Convey("Plan and execute a download | PlanDownload", t, func() {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		defer Dispose(dev)
+
+		storages, err := FetchStorages(dev)
+		So(err, ShouldBeNil)
+		sid := storages[0].Sid
+
+		destination := newTempMocksDir("test_PlanDownload", true)
+		sources := []string{"/mtp-test-files/mock_dir1"}
+
+		plan, err := PlanDownload(dev, sid, sources, destination, DownloadOptions{ConflictPolicy: ConflictAsk})
+		So(err, ShouldBeNil)
+		So(plan.Kind, ShouldEqual, DownloadTransfer)
+		So(plan.TotalFiles, ShouldEqual, mockDir1TotalFiles)
+		So(plan.Conflicts, ShouldBeEmpty)
+		So(plan.Directories, ShouldContain, filepath.Join(destination, "mock_dir1", "3", "2"))
+
+		// nothing was written
+		So(existsLocal(filepath.Join(destination, "mock_dir1")), ShouldBeFalse)
+
+		bulkFilesSent, bulkSizeSent, _, err := plan.Execute(dev, nil, func(fi *ProgressInfo, err error) error {
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, mockDir1TotalFiles)
+		So(bulkSizeSent, ShouldEqual, plan.TotalSize)
+
+		// the conflicts are left to the callback
+		plan, err = PlanDownload(dev, sid, sources, destination, DownloadOptions{ConflictPolicy: ConflictAsk})
+		So(err, ShouldBeNil)
+		So(plan.Directories, ShouldBeEmpty)
+		So(plan.Conflicts, ShouldHaveLength, mockDir1TotalFiles)
+		So(plan.TotalFiles, ShouldEqual, mockDir1TotalFiles)
+
+		for _, f := range plan.Files {
+			So(f.ConflictAction, ShouldEqual, ConflictAsk)
+		}
+
+		// a missing source
+		_, err = PlanDownload(dev, sid, []string{"/mtp-test-files/fake"}, destination, DownloadOptions{})
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+}
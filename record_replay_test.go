@@ -0,0 +1,130 @@
+package mtpx
+
+import (
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// results of a session which should be identical when it is replayed
+type recordReplayResult struct {
+	storages         []StorageData
+	walked           []FileInfo
+	totalFiles       int64
+	totalDirectories int64
+	downloadedFiles  int64
+	downloadedSize   int64
+	downloadedData   []byte
+	downloadedPaths  []string
+	uploadedFiles    int64
+	uploadedSize     int64
+	errs             []error
+}
+
+func runRecordReplaySession(dev Device, destination string) recordReplayResult {
+	r := recordReplayResult{}
+
+	storages, err := FetchStorages(dev)
+	r.errs = append(r.errs, err)
+	r.storages = storages
+	sid := storages[0].Sid
+
+	_, r.totalFiles, r.totalDirectories, err = Walk(dev, sid, "/mtp-test-files/mock_dir1", true, true, false,
+		func(objectId uint32, fi *FileInfo, err error) error {
+			r.walked = append(r.walked, *fi)
+
+			return nil
+		})
+	r.errs = append(r.errs, err)
+
+	r.downloadedFiles, r.downloadedSize, err = DownloadFiles(dev, sid,
+		[]string{"/mtp-test-files/a.txt"},
+		destination,
+		false,
+		func(fi *FileInfo, err error) error {
+			return nil
+		},
+		func(fi *ProgressInfo, err error) error {
+			return nil
+		},
+	)
+	r.errs = append(r.errs, err)
+
+	r.downloadedData, err = ioutil.ReadFile(filepath.Join(destination, "a.txt"))
+	r.errs = append(r.errs, err)
+
+	// the preprocessed objects are downloaded in the same order every time
+	_, _, err = DownloadFiles(dev, sid,
+		[]string{"/mtp-test-files/mock_dir1"},
+		destination,
+		true,
+		func(fi *FileInfo, err error) error {
+			return nil
+		},
+		func(fi *ProgressInfo, err error) error {
+			if fi.Status == InProgress && fi.ActiveFileSize.Sent == fi.ActiveFileSize.Total {
+				r.downloadedPaths = append(r.downloadedPaths, fi.FileInfo.FullPath)
+			}
+
+			return nil
+		},
+	)
+	r.errs = append(r.errs, err)
+
+	err = DeleteFile(dev, sid, []FileProp{{0, "/mtp-test-files/temp_dir/test_RecordReplay"}})
+	r.errs = append(r.errs, err)
+
+	_, r.uploadedFiles, r.uploadedSize, err = UploadFiles(dev, sid,
+		[]string{getTestMocksAsset("mock_dir1")},
+		"/mtp-test-files/temp_dir/test_RecordReplay",
+		false,
+		func(fi *os.FileInfo, fullPath string, err error) error {
+			return nil
+		},
+		func(fi *ProgressInfo, err error) error {
+			return nil
+		},
+	)
+	r.errs = append(r.errs, err)
+
+	// a missing file
+	_, err = GetObjectFromPath(dev, sid, "/mtp-test-files/temp_dir/test_RecordReplay/does_not_exist.txt")
+	r.errs = append(r.errs, err)
+
+	return r
+}
+
+func TestRecordReplay(t *testing.T) {
+	Convey("Record a session and replay it offline | Recorder | Replayer", t, func() {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		defer Dispose(dev)
+
+		traceFile := newTempMocksAsset("test_RecordReplay.trace")
+		f, err := os.Create(traceFile)
+		So(err, ShouldBeNil)
+
+		rec := mtpxtest.NewRecorder(dev.(mtpxtest.Operations), f)
+		recorded := runRecordReplaySession(rec, newTempMocksDir("test_RecordReplay/recorded", true))
+
+		So(rec.Err(), ShouldBeNil)
+		So(f.Close(), ShouldBeNil)
+
+		So(recorded.totalFiles, ShouldBeGreaterThan, 0)
+		So(recorded.downloadedFiles, ShouldEqual, 1)
+		So(recorded.uploadedFiles, ShouldEqual, recorded.totalFiles)
+		So(recorded.errs[len(recorded.errs)-1], ShouldHaveSameTypeAs, InvalidPathError{})
+
+		rep, err := mtpxtest.OpenReplayer(traceFile)
+		So(err, ShouldBeNil)
+
+		replayed := runRecordReplaySession(rep, newTempMocksDir("test_RecordReplay/replayed", true))
+
+		So(replayed, ShouldResemble, recorded)
+		So(rep.Remaining(), ShouldEqual, 0)
+	})
+}
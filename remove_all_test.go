@@ -0,0 +1,168 @@
+package mtpx
+
+import (
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestRemoveAll(t *testing.T) {
+	if isUsbTestDevice() {
+		t.Skip("the remove tests require the simulated device")
+	}
+
+	const source = "/mtp-test-files/mock_dir1"
+
+	newRemoveTestDevice := func(faults ...mtpxtest.Fault) (*mtpxtest.Device, *mtpxtest.FaultInjector, uint32) {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		storages, err := FetchStorages(dev)
+		So(err, ShouldBeNil)
+
+		return dev.(*mtpxtest.Device), mtpxtest.NewFaultInjector(dev.(*mtpxtest.Device), faults...), storages[0].Sid
+	}
+
+	// the files and the directories of [source] including itself
+	sourceTotals := func(dev Device, sid uint32) (totalFiles, totalDirectories int64) {
+		_, totalFiles, totalDirectories, err := Walk(dev, sid, source, true, false, false, func(objectId uint32, fi *FileInfo, err error) error {
+			return nil
+		})
+		So(err, ShouldBeNil)
+
+		return totalFiles, totalDirectories + 1
+	}
+
+	removeAll := func(dev Device, sid uint32, dryRun bool) ([]string, int64, int64, error) {
+		var removed []string
+		totalFiles, totalDirectories, err := RemoveAll(dev, sid, []FileProp{{0, source}}, dryRun, func(fi *FileInfo, err error) error {
+			So(err, ShouldBeNil)
+			removed = append(removed, fi.FullPath)
+
+			return nil
+		})
+
+		return removed, totalFiles, totalDirectories, err
+	}
+
+	// the contents are reported before their directory
+	shouldBeBottomUp := func(removed []string) {
+		_, index3 := StringContains(removed, source+"/3")
+		_, index32 := StringContains(removed, source+"/3/2")
+		_, index32b := StringContains(removed, source+"/3/2/b.txt")
+
+		So(index32b, ShouldBeLessThan, index32)
+		So(index32, ShouldBeLessThan, index3)
+		So(removed[len(removed)-1], ShouldEqual, source)
+	}
+
+	Convey("List the objects without deleting them | RemoveAll", t, func() {
+		sim, dev, sid := newRemoveTestDevice()
+		expectedFiles, expectedDirectories := sourceTotals(dev, sid)
+
+		removed, totalFiles, totalDirectories, err := removeAll(dev, sid, true)
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, expectedFiles)
+		So(totalDirectories, ShouldEqual, expectedDirectories)
+		So(removed, ShouldHaveLength, expectedFiles+expectedDirectories)
+		shouldBeBottomUp(removed)
+
+		So(dev.Calls(mtpxtest.OpDeleteObject), ShouldEqual, 0)
+		_, ok := sim.Lookup(sid, source+"/3/2/b.txt")
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Remove a directory | RemoveAll", t, func() {
+		sim, dev, sid := newRemoveTestDevice()
+		expectedFiles, expectedDirectories := sourceTotals(dev, sid)
+
+		removed, totalFiles, totalDirectories, err := removeAll(dev, sid, false)
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, expectedFiles)
+		So(totalDirectories, ShouldEqual, expectedDirectories)
+		shouldBeBottomUp(removed)
+
+		So(dev.Calls(mtpxtest.OpDeleteObject), ShouldEqual, 1)
+		_, ok := sim.Lookup(sid, source)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Remove the contents one by one if the device refuses to delete a directory | RemoveAll", t, func() {
+		sim, dev, sid := newRemoveTestDevice()
+		sim.RefuseNonEmptyDeletes = true
+		expectedFiles, expectedDirectories := sourceTotals(dev, sid)
+
+		removed, totalFiles, totalDirectories, err := removeAll(dev, sid, false)
+		So(err, ShouldBeNil)
+		So(totalFiles, ShouldEqual, expectedFiles)
+		So(totalDirectories, ShouldEqual, expectedDirectories)
+		shouldBeBottomUp(removed)
+
+		So(dev.Calls(mtpxtest.OpDeleteObject), ShouldEqual, 1+expectedFiles+expectedDirectories)
+		_, ok := sim.Lookup(sid, source)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Do not remove the contents of a protected directory | RemoveAll", t, func() {
+		for _, rc := range []uint16{mtp.RC_ObjectWriteProtected, mtp.RC_AccessDenied, mtp.RC_StoreReadOnly} {
+			sim, dev, sid := newRemoveTestDevice(mtpxtest.Fault{
+				Op:  mtpxtest.OpDeleteObject,
+				Err: mtp.RCError(rc),
+			})
+
+			_, totalFiles, totalDirectories, err := removeAll(dev, sid, false)
+			So(err, ShouldHaveSameTypeAs, FileObjectError{})
+			So(err.(FileObjectError).error, ShouldEqual, mtp.RCError(rc))
+			So(totalFiles, ShouldEqual, 0)
+			So(totalDirectories, ShouldEqual, 0)
+			So(dev.Calls(mtpxtest.OpDeleteObject), ShouldEqual, 1)
+
+			_, ok := sim.Lookup(sid, source+"/a.txt")
+			So(ok, ShouldBeTrue)
+		}
+	})
+
+	Convey("Report the object which could not be removed | RemoveAll", t, func() {
+		sim, dev, sid := newRemoveTestDevice(mtpxtest.Fault{
+			Op:  mtpxtest.OpDeleteObject,
+			Nth: 3,
+			Err: mtp.RCError(mtp.RC_AccessDenied),
+		})
+		sim.RefuseNonEmptyDeletes = true
+
+		var failed []string
+		totalFiles, _, err := RemoveAll(dev, sid, []FileProp{{0, source}}, false, func(fi *FileInfo, err error) error {
+			if err != nil {
+				failed = append(failed, fi.FullPath)
+			}
+
+			return nil
+		})
+		So(err, ShouldHaveSameTypeAs, FileObjectError{})
+		So(totalFiles, ShouldEqual, 1)
+		So(failed, ShouldHaveLength, 1)
+
+		_, ok := sim.Lookup(sid, failed[0])
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Distinguish the missing objects from the failures | RemoveAll", t, func() {
+		_, dev, sid := newRemoveTestDevice(mtpxtest.Fault{
+			Op:  mtpxtest.OpDeleteObject,
+			Err: mtpxtest.ErrDisconnected,
+		})
+		noCb := func(fi *FileInfo, err error) error {
+			return nil
+		}
+
+		_, _, err := RemoveAll(dev, sid, []FileProp{{0, "/mtp-test-files/fake"}}, false, noCb)
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+
+		_, _, err = RemoveAll(dev, sid, []FileProp{{1234567, ""}}, false, noCb)
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+
+		_, _, err = RemoveAll(dev, sid, []FileProp{{0, source + "/a.txt"}}, false, noCb)
+		So(err, ShouldHaveSameTypeAs, FileObjectError{})
+	})
+}
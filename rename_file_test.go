@@ -10,7 +10,7 @@ import (
 )
 
 func TestRenameFile(t *testing.T) {
-	dev, err := Initialize(Init{})
+	dev, err := initTestDevice()
 	if err != nil {
 		log.Panic(err)
 	}
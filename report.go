@@ -0,0 +1,92 @@
+package mtpx
+
+import (
+	"errors"
+	"time"
+)
+
+// keeps the [TransferReport] of an upload or a download up to date
+type transferReporter struct {
+	report *TransferReport
+
+	continueOnError bool
+
+	// the file or the directory being transferred
+	item  TransferReportItem
+	start time.Time
+
+	// the error returned by the progress callback, it always aborts the transfer
+	abortErr error
+
+	// set once the device failed to keep a modification time
+	modTimeLost bool
+}
+
+func newTransferReporter(continueOnError bool) *transferReporter {
+	return &transferReporter{report: &TransferReport{}, continueOnError: continueOnError}
+}
+
+// wrap [progressCb] to keep a tab on the errors returned by it
+func (r *transferReporter) progressCb(progressCb ProgressCb) ProgressCb {
+	return func(fi *ProgressInfo, err error) error {
+		if cbErr := progressCb(fi, err); cbErr != nil {
+			r.abortErr = cbErr
+
+			return cbErr
+		}
+
+		return nil
+	}
+}
+
+// start transferring an item
+func (r *transferReporter) begin(sourcePath, destinationPath string, isDir bool, size int64) {
+	r.item = TransferReportItem{
+		SourcePath:      sourcePath,
+		DestinationPath: destinationPath,
+		IsDir:           isDir,
+		Size:            size,
+	}
+	r.start = time.Now()
+}
+
+func (r *transferReporter) succeeded(sizeSent int64) {
+	r.item.SizeSent = sizeSent
+	r.item.Duration = time.Since(r.start)
+	r.report.Succeeded = append(r.report.Succeeded, r.item)
+}
+
+// record whether the device kept the modification time of an uploaded file or directory
+func (r *transferReporter) modTimeChecked(preserved bool) {
+	if !preserved {
+		r.modTimeLost = true
+	}
+
+	r.report.ModTimesPreserved = !r.modTimeLost
+}
+
+func (r *transferReporter) skipped() {
+	r.item.Duration = time.Since(r.start)
+	r.report.Skipped = append(r.report.Skipped, r.item)
+}
+
+// report the failed item
+// returns nil if the transfer should carry on with the next item, [err] otherwise
+// the transfer is aborted if it was canceled, the progress callback failed or the device is gone
+func (r *transferReporter) failed(err, typedErr error, sizeSent int64) error {
+	r.item.SizeSent = sizeSent
+	r.item.Duration = time.Since(r.start)
+	r.item.Err = typedErr
+	r.report.Failed = append(r.report.Failed, r.item)
+
+	if !r.continueOnError || r.abortErr != nil {
+		return err
+	}
+
+	var canceledErr CanceledError
+	if errors.As(err, &canceledErr) || isSessionLost(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,312 @@
+package mtpx
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// a device which sends fewer bytes than the size of the object
+type shortObjectDevice struct {
+	Device
+}
+
+func (d shortObjectDevice) GetObject(handle uint32, w io.Writer, progressCb mtp.ProgressFunc) error {
+	var buf bytes.Buffer
+	if err := d.Device.GetObject(handle, &buf, progressCb); err != nil {
+		return err
+	}
+
+	_, err := w.Write(buf.Bytes()[:buf.Len()/2])
+
+	return err
+}
+
+// a device which cannot run raw transactions, eg: a [Device] implemented outside of mtpx
+type noTransactionDevice struct {
+	Device
+}
+
+func downloadTestFile(dev Device, sid uint32, destination string) (int64, error) {
+	var firstSent int64 = -1
+
+	_, _, err := DownloadFiles(dev, sid,
+		[]string{"/mtp-test-files/4mb_txt_file"},
+		destination,
+		false,
+		func(fi *FileInfo, err error) error {
+			return nil
+		},
+		func(fi *ProgressInfo, err error) error {
+			if firstSent < 0 {
+				firstSent = fi.ActiveFileSize.Sent
+			}
+
+			return nil
+		},
+	)
+
+	return firstSent, err
+}
+
+func TestResumeDownload(t *testing.T) {
+	if isUsbTestDevice() {
+		t.Skip("the resume tests require the simulated device")
+	}
+
+	const partialSize = 1<<20 + 123
+
+	expected, err := ioutil.ReadFile(getTestMocksAsset("4mb_txt_file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Continue a partial local file | DownloadFiles", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		destination := newTempMocksDir("test_ResumeDownload", true)
+		localFile := filepath.Join(destination, "4mb_txt_file")
+
+		err := ioutil.WriteFile(tempDownloadPath(localFile), expected[:partialSize], 0644)
+		So(err, ShouldBeNil)
+
+		firstSent, err := downloadTestFile(dev, sid, destination)
+		So(err, ShouldBeNil)
+		So(firstSent, ShouldBeGreaterThan, partialSize)
+
+		// the tail of the partial file is verified and then the rest is downloaded
+		So(dev.Calls(mtpxtest.OpGetObject), ShouldEqual, 0)
+		So(dev.Calls(mtpxtest.OpRunTransaction), ShouldEqual, 2)
+
+		data, err := ioutil.ReadFile(localFile)
+		So(err, ShouldBeNil)
+		So(bytes.Equal(data, expected), ShouldBeTrue)
+	})
+
+	Convey("Failed download is continued by the next attempt | DownloadFiles", t, func() {
+		const truncateAt = 1 << 20
+
+		dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:         mtpxtest.OpGetObject,
+			Nth:        1,
+			Truncate:   true,
+			TruncateAt: truncateAt,
+		})
+
+		destination := newTempMocksDir("test_ResumeDownload", true)
+		localFile := filepath.Join(destination, "4mb_txt_file")
+
+		_, err := downloadTestFile(dev, sid, destination)
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+
+		// the partial file is kept aside
+		So(existsLocal(localFile), ShouldBeFalse)
+		stat, err := os.Stat(tempDownloadPath(localFile))
+		So(err, ShouldBeNil)
+		So(stat.Size(), ShouldEqual, truncateAt)
+
+		_, err = downloadTestFile(dev, sid, destination)
+		So(err, ShouldBeNil)
+		So(dev.Calls(mtpxtest.OpGetObject), ShouldEqual, 1)
+
+		data, err := ioutil.ReadFile(localFile)
+		So(err, ShouldBeNil)
+		So(bytes.Equal(data, expected), ShouldBeTrue)
+	})
+
+	Convey("A different local file is downloaded again | DownloadFiles", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		destination := newTempMocksDir("test_ResumeDownload", true)
+		localFile := filepath.Join(destination, "4mb_txt_file")
+
+		err := ioutil.WriteFile(tempDownloadPath(localFile), bytes.Repeat([]byte("x"), partialSize), 0644)
+		So(err, ShouldBeNil)
+
+		firstSent, err := downloadTestFile(dev, sid, destination)
+		So(err, ShouldBeNil)
+		So(firstSent, ShouldBeLessThan, partialSize)
+		So(dev.Calls(mtpxtest.OpGetObject), ShouldEqual, 1)
+
+		data, err := ioutil.ReadFile(localFile)
+		So(err, ShouldBeNil)
+		So(bytes.Equal(data, expected), ShouldBeTrue)
+	})
+
+	Convey("Partial downloads are not supported by the device | DownloadFiles", t, func() {
+		sim, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		info := &sim.(*mtpxtest.Device).DeviceInfo
+		var operations []uint16
+		for _, code := range info.OperationsSupported {
+			if code != mtp.OC_GetPartialObject && code != mtp.OC_ANDROID_GET_PARTIAL_OBJECT64 {
+				operations = append(operations, code)
+			}
+		}
+		info.OperationsSupported = operations
+
+		storages, err := FetchStorages(sim)
+		So(err, ShouldBeNil)
+		dev := mtpxtest.NewFaultInjector(sim.(*mtpxtest.Device))
+
+		destination := newTempMocksDir("test_ResumeDownload", true)
+		localFile := filepath.Join(destination, "4mb_txt_file")
+
+		err = ioutil.WriteFile(tempDownloadPath(localFile), expected[:partialSize], 0644)
+		So(err, ShouldBeNil)
+
+		_, err = downloadTestFile(dev, storages[0].Sid, destination)
+		So(err, ShouldBeNil)
+		So(dev.Calls(mtpxtest.OpRunTransaction), ShouldEqual, 0)
+		So(dev.Calls(mtpxtest.OpGetObject), ShouldEqual, 1)
+
+		data, err := ioutil.ReadFile(localFile)
+		So(err, ShouldBeNil)
+		So(bytes.Equal(data, expected), ShouldBeTrue)
+	})
+
+	Convey("The device cannot run raw transactions | DownloadFiles", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		destination := newTempMocksDir("test_ResumeDownload", true)
+		localFile := filepath.Join(destination, "4mb_txt_file")
+
+		err := ioutil.WriteFile(tempDownloadPath(localFile), expected[:partialSize], 0644)
+		So(err, ShouldBeNil)
+
+		_, err = downloadTestFile(noTransactionDevice{dev}, sid, destination)
+		So(err, ShouldBeNil)
+		So(dev.Calls(mtpxtest.OpRunTransaction), ShouldEqual, 0)
+		So(dev.Calls(mtpxtest.OpGetObject), ShouldEqual, 1)
+
+		data, err := ioutil.ReadFile(localFile)
+		So(err, ShouldBeNil)
+		So(bytes.Equal(data, expected), ShouldBeTrue)
+
+		_, err = OpenFile(noTransactionDevice{dev}, sid, FileProp{0, "/mtp-test-files/4mb_txt_file"})
+		So(err, ShouldHaveSameTypeAs, PartialReadNotSupportedError{})
+	})
+
+	Convey("The downloaded file is smaller than the object | DownloadFiles", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		_, err := downloadTestFile(shortObjectDevice{dev}, sid, newTempMocksDir("test_ResumeDownload", true))
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+		So(errors.As(err, &FileSizeMismatchError{}), ShouldBeTrue)
+	})
+}
+
+func TestAtomicDownload(t *testing.T) {
+	if isUsbTestDevice() {
+		t.Skip("the atomic download tests require the simulated device")
+	}
+
+	expected, err := ioutil.ReadFile(getTestMocksAsset("4mb_txt_file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("The file is renamed into place once it is complete | DownloadFiles", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		destination := newTempMocksDir("test_AtomicDownload", true)
+		localFile := filepath.Join(destination, "4mb_txt_file")
+
+		_, err := downloadTestFile(dev, sid, destination)
+		So(err, ShouldBeNil)
+		So(existsLocal(tempDownloadPath(localFile)), ShouldBeFalse)
+
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/4mb_txt_file")
+		So(err, ShouldBeNil)
+
+		stat, err := os.Stat(localFile)
+		So(err, ShouldBeNil)
+		So(stat.ModTime().Unix(), ShouldEqual, fi.ModTime.Unix())
+	})
+
+	Convey("A failed download leaves the existing file untouched | DownloadFiles", t, func() {
+		dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:         mtpxtest.OpGetObject,
+			Nth:        1,
+			Truncate:   true,
+			TruncateAt: 1 << 20,
+		})
+
+		destination := newTempMocksDir("test_AtomicDownload", true)
+		localFile := filepath.Join(destination, "4mb_txt_file")
+
+		err := ioutil.WriteFile(localFile, []byte("an older file"), 0644)
+		So(err, ShouldBeNil)
+
+		_, err = downloadTestFile(dev, sid, destination)
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+
+		data, err := ioutil.ReadFile(localFile)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "an older file")
+	})
+
+	Convey("The leftover of a skipped file is removed | DownloadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		destination := newTempMocksDir("test_AtomicDownload", true)
+		localFile := filepath.Join(destination, "4mb_txt_file")
+
+		So(ioutil.WriteFile(localFile, expected, 0644), ShouldBeNil)
+		So(ioutil.WriteFile(tempDownloadPath(localFile), expected[:1<<20], 0644), ShouldBeNil)
+
+		_, _, _, err := DownloadFilesWithOptions(dev, sid,
+			[]string{"/mtp-test-files/4mb_txt_file"},
+			destination,
+			false,
+			DownloadOptions{ConflictPolicy: ConflictSkip},
+			func(fi *FileInfo, err error) error {
+				return nil
+			},
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+		So(existsLocal(tempDownloadPath(localFile)), ShouldBeFalse)
+	})
+
+	Convey("The partial file is removed if it cannot be continued | DownloadFiles", t, func() {
+		sim, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		info := &sim.(*mtpxtest.Device).DeviceInfo
+		var operations []uint16
+		for _, code := range info.OperationsSupported {
+			if code != mtp.OC_GetPartialObject && code != mtp.OC_ANDROID_GET_PARTIAL_OBJECT64 {
+				operations = append(operations, code)
+			}
+		}
+		info.OperationsSupported = operations
+
+		storages, err := FetchStorages(sim)
+		So(err, ShouldBeNil)
+		dev := mtpxtest.NewFaultInjector(sim.(*mtpxtest.Device), mtpxtest.Fault{
+			Op:         mtpxtest.OpGetObject,
+			Nth:        1,
+			Truncate:   true,
+			TruncateAt: 1 << 20,
+		})
+
+		destination := newTempMocksDir("test_AtomicDownload", true)
+		localFile := filepath.Join(destination, "4mb_txt_file")
+
+		_, err = downloadTestFile(dev, storages[0].Sid, destination)
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+		So(existsLocal(localFile), ShouldBeFalse)
+		So(existsLocal(tempDownloadPath(localFile)), ShouldBeFalse)
+	})
+}
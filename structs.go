@@ -2,14 +2,69 @@ package mtpx
 
 import (
 	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"io"
 	"os"
 	"time"
 )
 
+// Device - the mtp operations used by mtpx
+// *mtp.Device satisfies this interface, any other implementation (eg: a simulated device) can be passed to the public functions
+type Device interface {
+	Close() error
+	GetDeviceInfo(info *mtp.DeviceInfo) error
+	GetStorageIDs(info *mtp.Uint32Array) error
+	GetStorageInfo(ID uint32, info *mtp.StorageInfo) error
+	GetObjectHandles(storageID, objFormatCode, parent uint32, info *mtp.Uint32Array) error
+	GetObjectInfo(handle uint32, info *mtp.ObjectInfo) error
+	GetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error
+	SetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error
+	SendObjectInfo(wantStorageID, wantParent uint32, info *mtp.ObjectInfo) (storageID, parent, handle uint32, err error)
+	SendObject(r io.Reader, size int64, progressCb mtp.ProgressFunc) error
+	GetObject(handle uint32, w io.Writer, progressCb mtp.ProgressFunc) error
+	DeleteObject(handle uint32) error
+}
+
+// the optional raw transactions of a [Device], *mtp.Device implements them
+// they are used by the operations which have no dedicated method (eg: partial object downloads, MoveObject and CopyObject), the callers fall back if a device does not implement them
+type transactionRunner interface {
+	RunTransaction(req *mtp.Container, rep *mtp.Container, dest io.Writer, src io.Reader, writeSize int64, progressCb mtp.ProgressFunc) error
+}
+
 type allowedSecondExtMap map[string]string
 
 type Init struct {
 	DebugMode bool
+
+	// select the device to open, the zero values match any device
+	// use [ListDevices] to find the values of the attached devices
+	SerialNumber string
+	VendorId     uint16
+	ProductId    uint16
+	Bus          uint8
+	Address      uint8
+}
+
+// UsbDevice - an mtp device attached to the usb bus
+// [Manufacturer], [Model] and [SerialNumber] are empty if the device could not be opened (eg: insufficient permissions)
+type UsbDevice struct {
+	VendorId     uint16
+	ProductId    uint16
+	Manufacturer string
+	Model        string
+	SerialNumber string
+	Bus          uint8
+	Address      uint8
+}
+
+type WatchEvent struct {
+	Type   WatchEventType
+	Device UsbDevice
+
+	// the storages of the device; set for [StoragesAvailable] events
+	Storages []StorageData
+
+	// the error which occured while listing the devices; set for [WatchFailed] events
+	Err error
 }
 
 type StorageData struct {
@@ -33,6 +88,10 @@ type FileInfo struct {
 
 type WalkCb func(objectId uint32, fi *FileInfo, err error) error
 
+// RemoveCb - called for each object removed by [RemoveAll]
+// [err] is set if the object could not be removed
+type RemoveCb func(fi *FileInfo, err error) error
+
 type TransferSizeInfo struct {
 	// total size to transfer
 	// note: the value will be 0 if pre-processing was not allowed
@@ -74,18 +133,141 @@ type ProgressInfo struct {
 	// size information of the current file which is being transferred
 	ActiveFileSize *TransferSizeInfo
 
+	// the policy applied to the current file if its destination already existed
+	// empty if there was no conflict
+	ConflictAction ConflictPolicy
+
+	// total files skipped because their destination already existed
+	FilesSkipped int64
+
+	// total files renamed because their destination already existed
+	FilesRenamed int64
+
+	// total files which passed the verification
+	// note: the value will be 0 if the verification was not enabled
+	FilesVerified int64
+
 	// total size information of the files for the transfer session
 	BulkFileSize *TransferSizeInfo
 
 	Status TransferStatus
 }
 
+// ConflictInfo - a file whose destination already Exists
+type ConflictInfo struct {
+	SourcePath    string
+	SourceSize    int64
+	SourceModTime time.Time
+
+	DestinationPath    string
+	DestinationSize    int64
+	DestinationModTime time.Time
+}
+
+// ConflictCb - decide how to resolve a conflict when the [ConflictPolicy] is [ConflictAsk]
+// returning [ConflictAsk] is not allowed
+type ConflictCb func(c *ConflictInfo) (ConflictPolicy, error)
+
+// UploadOptions - the options of [UploadFilesWithOptions]
+type UploadOptions struct {
+	// what to do when a file with the same name Exists on the device
+	ConflictPolicy ConflictPolicy
+
+	// called for each conflict if [ConflictPolicy] is [ConflictAsk]
+	ConflictCb ConflictCb
+
+	// keep uploading the remaining files if a file fails; the failures are listed in the [TransferReport]
+	ContinueOnError bool
+
+	// verify each file after it was transferred; a mismatch fails the file with a [FileVerificationError]
+	Verify VerifyMode
+
+	// called for each file to override its detected object format code
+	ObjectFormatCb ObjectFormatCb
+}
+
+// DownloadOptions - the options of [DownloadFilesWithOptions]
+type DownloadOptions struct {
+	// what to do when a local file with the same name Exists
+	ConflictPolicy ConflictPolicy
+
+	// called for each conflict if [ConflictPolicy] is [ConflictAsk]
+	ConflictCb ConflictCb
+
+	// keep downloading the remaining files if a file fails; the failures are listed in the [TransferReport]
+	ContinueOnError bool
+
+	// verify each file after it was transferred; a mismatch fails the file with a [FileVerificationError]
+	Verify VerifyMode
+}
+
+// DeleteOptions - the options of [DeleteFileWithOptions]
+type DeleteOptions struct {
+	// move the objects into the hidden trash directory of the storage instead of deleting them
+	Trash bool
+}
+
+// TrashItem - an object moved into the trash of a storage
+type TrashItem struct {
+	// name of the directory of the trash holding the object
+	Id string
+
+	// full path of the object before it was moved into the trash
+	OriginalPath string
+
+	DeletedAt time.Time
+	IsDir     bool
+
+	// the object in the trash, it can be addressed using its [FileInfo.ObjectId] or [FileInfo.FullPath]
+	// it is not stored in the manifest
+	FileInfo *FileInfo `json:"-"`
+}
+
+// TransferReport - the outcome of every file of an upload or a download
+type TransferReport struct {
+	Succeeded []TransferReportItem
+	Skipped   []TransferReportItem
+
+	// the failed files and directories
+	// the contents of a failed directory are not transferred
+	Failed []TransferReportItem
+
+	// uploads only: whether the device kept the modification times of every uploaded file and directory
+	// false if a modification time did not stick or if nothing was uploaded
+	ModTimesPreserved bool
+}
+
+// TransferReportItem - a file or a directory of a [TransferReport]
+type TransferReportItem struct {
+	SourcePath      string
+	DestinationPath string
+	IsDir           bool
+
+	// size of the source file
+	Size int64
+
+	// bytes transferred
+	SizeSent int64
+
+	Duration time.Duration
+
+	// uploads only: whether the device kept the modification time of the source file
+	ModTimePreserved bool
+
+	// the typed error of a failed item; nil otherwise
+	Err error
+}
+
 type SizeProgressCb func(total, sent int64, objectId uint32, err error) error
 
 type LocalWalkCb func(fi *os.FileInfo, fullPath string, err error) error
 
 type ProgressCb func(fi *ProgressInfo, err error) error
 
+// ObjectFormatCb - choose the object format code of an uploaded file
+// [format] is the code detected using the extension or the contents of the file, it is [mtp.OFC_Undefined] if the format is unknown or not supported by the device
+type ObjectFormatCb func(fi *os.FileInfo, fullPath string, format uint16) (uint16, error)
+
 type LocalPreprocessCb func(fi *os.FileInfo, fullPath string, err error) error
 
 type MtpPreprocessCb func(fi *FileInfo, err error) error
@@ -98,6 +280,37 @@ type FileProp struct {
 type processDownloadFilesProps struct {
 	destinationFileParentPath, destinationFilePath, sourceParentPath string
 	bulkFilesSent, bulkSizeSent, totalFiles, totalSize               int64
+	options                                                          *DownloadOptions
+	reporter                                                         *transferReporter
+}
+
+type processCopyObjectsProps struct {
+	storageId                   uint32
+	canSetProps                 bool
+	pInfo                       *ProgressInfo
+	progressCb                  ProgressCb
+	bulkFilesSent, bulkSizeSent int64
+}
+
+// the manifest of the trash of a storage
+type trashManifest struct {
+	Items []TrashItem
+}
+
+// a directory made by an upload
+type uploadedDirectory struct {
+	objectId uint32
+	modTime  time.Time
+}
+
+// the objects of a directory on the device by their lower cased names
+// the lookups on the device are case insensitive
+type directoryListing map[string]listedObject
+
+// an object of a [directoryListing]
+type listedObject struct {
+	objectId uint32
+	name     string
 }
 
 type downloadFilesObjectCache map[string]downloadFilesObjectCacheContainer
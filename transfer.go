@@ -0,0 +1,221 @@
+package mtpx
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Transfer - an upload or a download running in the background
+// use [UploadFilesAsync] or [DownloadFilesAsync] to start one
+type Transfer struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	progressCb ProgressCb
+
+	mu       sync.Mutex
+	status   TransferStatus
+	resumed  chan struct{}
+	lastInfo *ProgressInfo
+
+	done                chan struct{}
+	destinationObjectId uint32
+	bulkFilesSent       int64
+	bulkSizeSent        int64
+	err                 error
+}
+
+// UploadFilesAsync - start [UploadFiles] in the background
+// see [UploadFiles] for the parameters
+func UploadFilesAsync(dev Device, storageId uint32, sources []string, destination string, preprocessFiles bool, preprocessCb LocalPreprocessCb, progressCb ProgressCb) *Transfer {
+	t := newTransfer(progressCb)
+
+	go func() {
+		destinationObjectId, bulkFilesSent, bulkSizeSent, err := UploadFiles(t.device(dev), storageId, sources, destination,
+			preprocessFiles, preprocessCb, t.progress)
+
+		t.finish(destinationObjectId, bulkFilesSent, bulkSizeSent, err)
+	}()
+
+	return t
+}
+
+// DownloadFilesAsync - start [DownloadFiles] in the background
+// see [DownloadFiles] for the parameters
+func DownloadFilesAsync(dev Device, storageId uint32, sources []string, destination string,
+	preprocessFiles bool, preprocessCb MtpPreprocessCb, progressCb ProgressCb) *Transfer {
+	t := newTransfer(progressCb)
+
+	go func() {
+		bulkFilesSent, bulkSizeSent, err := DownloadFiles(t.device(dev), storageId, sources, destination,
+			preprocessFiles, preprocessCb, t.progress)
+
+		t.finish(0, bulkFilesSent, bulkSizeSent, err)
+	}()
+
+	return t
+}
+
+func newTransfer(progressCb ProgressCb) *Transfer {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Transfer{
+		ctx:        ctx,
+		cancel:     cancel,
+		progressCb: progressCb,
+		status:     InProgress,
+		done:       make(chan struct{}),
+	}
+}
+
+func (t *Transfer) device(dev Device) Device {
+	d := newContextDevice(t.ctx, dev)
+	d.wait = t.wait
+
+	return d
+}
+
+// Pause - pause the transfer before the next device operation
+// a running transaction is never stalled, the usb bus is idle while paused
+// a download is paused in between the chunks of an object if the device supports partial object downloads, an upload once the current file was sent
+// the progress callback is called with the [Paused] status
+func (t *Transfer) Pause() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.status != InProgress {
+		return
+	}
+
+	t.status = Paused
+	t.resumed = make(chan struct{})
+}
+
+// Resume - continue a paused transfer from where it was paused
+func (t *Transfer) Resume() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.status != Paused {
+		return
+	}
+
+	t.status = InProgress
+	close(t.resumed)
+}
+
+// Cancel - abort the transfer
+// see [UploadFilesContext] and [DownloadFilesContext] for the clean up of the partially transferred file
+func (t *Transfer) Cancel() {
+	t.cancel()
+}
+
+// Status - the current status of the transfer
+func (t *Transfer) Status() TransferStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.status
+}
+
+// Done - closed once the transfer has finished
+func (t *Transfer) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait - wait for the transfer to finish
+// returns a [CanceledError] if the transfer was canceled
+// return:
+// [bulkFilesSent]: total transferred files (directory count not included)
+// [bulkSizeSent]: total size of the transferred files
+func (t *Transfer) Wait() (bulkFilesSent int64, bulkSizeSent int64, err error) {
+	<-t.done
+
+	return t.bulkFilesSent, t.bulkSizeSent, t.err
+}
+
+// DestinationObjectId - objectId of the destination directory of an upload
+// it is available once the transfer has finished
+func (t *Transfer) DestinationObjectId() uint32 {
+	<-t.done
+
+	return t.destinationObjectId
+}
+
+// keep track of the latest progress to report the status changes
+func (t *Transfer) progress(fi *ProgressInfo, err error) error {
+	t.mu.Lock()
+	t.lastInfo = fi
+	t.mu.Unlock()
+
+	return t.progressCb(fi, err)
+}
+
+// report the status of the transfer using the latest progress
+func (t *Transfer) notify(status TransferStatus) error {
+	t.mu.Lock()
+	fi := t.lastInfo
+	t.mu.Unlock()
+
+	if fi == nil {
+		return nil
+	}
+
+	fi.Status = status
+
+	return t.progressCb(fi, nil)
+}
+
+// block while the transfer is paused
+// it runs on the transfer goroutine, in between the device operations
+func (t *Transfer) wait() error {
+	t.mu.Lock()
+	if t.status != Paused {
+		t.mu.Unlock()
+
+		return nil
+	}
+	resumed := t.resumed
+	t.mu.Unlock()
+
+	if err := t.notify(Paused); err != nil {
+		return err
+	}
+
+	select {
+	case <-resumed:
+	case <-t.ctx.Done():
+		return CanceledError{error: t.ctx.Err()}
+	}
+
+	return t.notify(InProgress)
+}
+
+func (t *Transfer) finish(destinationObjectId uint32, bulkFilesSent, bulkSizeSent int64, err error) {
+	err = canceledError(t.ctx, err)
+
+	status := Completed
+	if err != nil {
+		status = Failed
+
+		if errors.As(err, &CanceledError{}) {
+			status = Canceled
+		}
+	}
+
+	if status == Canceled {
+		_ = t.notify(Canceled)
+	}
+
+	t.mu.Lock()
+	t.status = status
+	t.mu.Unlock()
+
+	t.destinationObjectId = destinationObjectId
+	t.bulkFilesSent = bulkFilesSent
+	t.bulkSizeSent = bulkSizeSent
+	t.err = err
+
+	t.cancel()
+	close(t.done)
+}
@@ -0,0 +1,168 @@
+package mtpx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestTransferReport(t *testing.T) {
+	if isUsbTestDevice() {
+		t.Skip("the transfer report tests require the simulated device")
+	}
+
+	const destination = "/mtp-test-files/temp_dir/test_TransferReport"
+
+	upload := func(dev Device, sid uint32, options UploadOptions, progressCb ProgressCb) (int64, *TransferReport, error) {
+		_, bulkFilesSent, report, err := uploadTestMockDir1(dev, sid, destination, options, progressCb)
+
+		return bulkFilesSent, report, err
+	}
+
+	download := func(dev Device, sid uint32, options DownloadOptions) (int64, *TransferReport, error) {
+		_, bulkFilesSent, report, err := downloadTestMockDir1(dev, sid, newTempMocksDir("test_TransferReport", true), options, nil)
+
+		return bulkFilesSent, report, err
+	}
+
+	noProgress := func(fi *ProgressInfo, err error) error {
+		return nil
+	}
+
+	Convey("Report the uploaded files | UploadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		bulkFilesSent, report, err := upload(dev, sid, UploadOptions{}, noProgress)
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, mockDir1TotalFiles)
+		So(report.Succeeded, ShouldHaveLength, mockDir1TotalFiles)
+		So(report.Failed, ShouldBeEmpty)
+
+		for _, item := range report.Succeeded {
+			So(item.SizeSent, ShouldEqual, item.Size)
+			So(item.Err, ShouldBeNil)
+		}
+
+		_, report, err = upload(dev, sid, UploadOptions{ConflictPolicy: ConflictSkip}, noProgress)
+		So(err, ShouldBeNil)
+		So(report.Succeeded, ShouldBeEmpty)
+		So(report.Skipped, ShouldHaveLength, mockDir1TotalFiles)
+	})
+
+	Convey("Abort on the first failure | UploadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:  mtpxtest.OpSendObject,
+			Nth: 2,
+			Err: mtp.RCError(mtp.RC_AccessDenied),
+		})
+
+		bulkFilesSent, report, err := upload(dev, sid, UploadOptions{}, noProgress)
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+		So(report.Succeeded, ShouldHaveLength, 1)
+		So(report.Failed, ShouldHaveLength, 1)
+		So(bulkFilesSent, ShouldEqual, 2)
+	})
+
+	Convey("Continue past the failed files | UploadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:  mtpxtest.OpSendObject,
+			Nth: 2,
+			Err: mtp.RCError(mtp.RC_AccessDenied),
+		})
+
+		bulkFilesSent, report, err := upload(dev, sid, UploadOptions{ContinueOnError: true}, noProgress)
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, mockDir1TotalFiles-1)
+		So(report.Succeeded, ShouldHaveLength, mockDir1TotalFiles-1)
+		So(report.Failed, ShouldHaveLength, 1)
+
+		failed := report.Failed[0]
+		So(failed.IsDir, ShouldBeFalse)
+		So(failed.SourcePath, ShouldNotBeEmpty)
+		So(failed.DestinationPath, ShouldStartWith, destination+"/mock_dir1/")
+		So(failed.Err, ShouldHaveSameTypeAs, FileTransferError{})
+		So(errors.Is(failed.Err, mtp.RCError(mtp.RC_AccessDenied)), ShouldBeTrue)
+	})
+
+	Convey("Abort if the session with the device is lost | UploadFilesWithOptions", t, func() {
+		sessionErrs := []error{
+			mtp.SyncError("transaction ID mismatch"),
+			fmt.Errorf("mtp: cannot run operation SendObject, device is not open"),
+			DeviceDisconnectedError{error: fmt.Errorf("the device was disconnected")},
+			mtpxtest.ErrDisconnected,
+		}
+
+		for _, sessionErr := range sessionErrs {
+			dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+				Op:  mtpxtest.OpSendObject,
+				Nth: 2,
+				Err: sessionErr,
+			})
+
+			_, report, err := upload(dev, sid, UploadOptions{ContinueOnError: true}, noProgress)
+			So(err, ShouldHaveSameTypeAs, FileTransferError{})
+			So(report.Succeeded, ShouldHaveLength, 1)
+			So(report.Failed, ShouldHaveLength, 1)
+
+			// the remaining files are not sent to the dead session
+			So(dev.Calls(mtpxtest.OpSendObject), ShouldEqual, 2)
+		}
+	})
+
+	Convey("Abort if the device is disconnected | DownloadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:         mtpxtest.OpGetObject,
+			Nth:        2,
+			Disconnect: true,
+		})
+
+		_, report, err := download(dev, sid, DownloadOptions{ContinueOnError: true})
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+		So(report.Succeeded, ShouldHaveLength, 1)
+		So(report.Failed, ShouldHaveLength, 1)
+		So(dev.Calls(mtpxtest.OpGetObject), ShouldEqual, 2)
+	})
+
+	Convey("The progress callback aborts the upload | UploadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		_, report, err := upload(dev, sid, UploadOptions{ContinueOnError: true}, func(fi *ProgressInfo, err error) error {
+			return errors.New("stop")
+		})
+		So(err, ShouldBeError)
+		So(report.Failed, ShouldHaveLength, 1)
+		So(report.Succeeded, ShouldBeEmpty)
+	})
+
+	Convey("Continue past the failed files | DownloadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice(mtpxtest.Fault{
+			Op:  mtpxtest.OpGetObject,
+			Nth: 3,
+			Err: mtp.RCError(mtp.RC_AccessDenied),
+		})
+
+		bulkFilesSent, report, err := download(dev, sid, DownloadOptions{})
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+		So(report.Succeeded, ShouldHaveLength, 2)
+		So(report.Failed, ShouldHaveLength, 1)
+		So(bulkFilesSent, ShouldEqual, 3)
+
+		dev.Reset()
+		dev.Inject(mtpxtest.Fault{
+			Op:  mtpxtest.OpGetObject,
+			Nth: dev.Calls(mtpxtest.OpGetObject) + 2,
+			Err: mtp.RCError(mtp.RC_AccessDenied),
+		})
+
+		bulkFilesSent, report, err = download(dev, sid, DownloadOptions{ContinueOnError: true})
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, mockDir1TotalFiles-1)
+		So(report.Succeeded, ShouldHaveLength, mockDir1TotalFiles-1)
+		So(report.Failed, ShouldHaveLength, 1)
+		So(report.Failed[0].Err, ShouldHaveSameTypeAs, FileTransferError{})
+		So(existsLocal(report.Succeeded[0].DestinationPath), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,218 @@
+package mtpx
+
+import (
+	"errors"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// records the progress of a transfer
+type testTransferProgress struct {
+	mu       sync.Mutex
+	statuses []TransferStatus
+	sent     int64
+	paused   chan struct{}
+}
+
+func newTestTransferProgress() *testTransferProgress {
+	return &testTransferProgress{paused: make(chan struct{}, 1)}
+}
+
+func (p *testTransferProgress) progressCb(fi *ProgressInfo, err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.statuses) < 1 || p.statuses[len(p.statuses)-1] != fi.Status {
+		p.statuses = append(p.statuses, fi.Status)
+	}
+	p.sent = fi.BulkFileSize.Sent
+
+	if fi.Status == Paused {
+		p.paused <- struct{}{}
+	}
+
+	return nil
+}
+
+func (p *testTransferProgress) snapshot() ([]TransferStatus, int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]TransferStatus(nil), p.statuses...), p.sent
+}
+
+func newTransferTestDevice() (*mtpxtest.FaultInjector, uint32) {
+	dev, err := initTestDevice()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return mtpxtest.NewFaultInjector(dev.(*mtpxtest.Device)), storages[0].Sid
+}
+
+func TestTransfer(t *testing.T) {
+	if isUsbTestDevice() {
+		t.Skip("the transfer tests require the simulated device")
+	}
+
+	Convey("Pause and resume in the middle of a file | DownloadFilesAsync", t, func() {
+		dev, sid := newTransferTestDevice()
+		p := newTestTransferProgress()
+
+		destination := newTempMocksDir("test_Transfer", true)
+
+		// [tr] is assigned after the transfer was started
+		var tr *Transfer
+		trAssigned := make(chan struct{})
+		pause := func() {
+			<-trAssigned
+			tr.Pause()
+		}
+
+		var pauseOnce sync.Once
+		tr = DownloadFilesAsync(dev, sid,
+			[]string{"/mtp-test-files/4mb_txt_file"},
+			destination,
+			false,
+			func(fi *FileInfo, err error) error {
+				return nil
+			},
+			func(fi *ProgressInfo, err error) error {
+				if fi.ActiveFileSize.Sent >= 1<<20 {
+					pauseOnce.Do(pause)
+				}
+
+				return p.progressCb(fi, err)
+			},
+		)
+		close(trAssigned)
+
+		<-p.paused
+		So(tr.Status(), ShouldEqual, Paused)
+
+		// the transfer is paused once the running chunk was received and it does not make progress while paused
+		_, sentAtPause := p.snapshot()
+		So(sentAtPause, ShouldEqual, pausableChunkSize)
+		time.Sleep(50 * time.Millisecond)
+		_, sent := p.snapshot()
+		So(sent, ShouldEqual, sentAtPause)
+
+		tr.Resume()
+
+		bulkFilesSent, bulkSizeSent, err := tr.Wait()
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, 1)
+		So(bulkSizeSent, ShouldEqual, largeTestMockSize)
+		So(tr.Status(), ShouldEqual, Completed)
+
+		statuses, _ := p.snapshot()
+		So(statuses, ShouldResemble, []TransferStatus{InProgress, Paused, InProgress, Completed})
+
+		// the file was downloaded in chunks and resumed, not downloaded again
+		So(dev.Calls(mtpxtest.OpGetObject), ShouldEqual, 0)
+		So(dev.Calls(mtpxtest.OpRunTransaction), ShouldEqual, largeTestMockSize/pausableChunkSize)
+
+		data, err := ioutil.ReadFile(filepath.Join(destination, "4mb_txt_file"))
+		So(err, ShouldBeNil)
+		So(len(data), ShouldEqual, largeTestMockSize)
+	})
+
+	Convey("Cancel a paused transfer | UploadFilesAsync", t, func() {
+		dev, sid := newTransferTestDevice()
+		p := newTestTransferProgress()
+
+		// [tr] is assigned after the transfer was started
+		var tr *Transfer
+		trAssigned := make(chan struct{})
+		pause := func() {
+			<-trAssigned
+			tr.Pause()
+		}
+
+		var pauseOnce sync.Once
+		tr = UploadFilesAsync(dev, sid,
+			[]string{getTestMocksAsset("mock_dir1")},
+			"/mtp-test-files/temp_dir/test_Transfer",
+			false,
+			func(fi *os.FileInfo, fullPath string, err error) error {
+				return nil
+			},
+			func(fi *ProgressInfo, err error) error {
+				pauseOnce.Do(pause)
+
+				return p.progressCb(fi, err)
+			},
+		)
+		close(trAssigned)
+
+		<-p.paused
+		tr.Cancel()
+
+		bulkFilesSent, _, err := tr.Wait()
+		So(err, ShouldHaveSameTypeAs, CanceledError{})
+		So(bulkFilesSent, ShouldEqual, 1)
+		So(tr.Status(), ShouldEqual, Canceled)
+
+		statuses, _ := p.snapshot()
+		So(statuses, ShouldResemble, []TransferStatus{InProgress, Paused, Canceled})
+	})
+
+	Convey("Failed transfer | DownloadFilesAsync", t, func() {
+		dev, sid := newTransferTestDevice()
+
+		tr := DownloadFilesAsync(dev, sid,
+			[]string{"/mtp-test-files/does_not_exist.txt"},
+			newTempMocksDir("test_Transfer", true),
+			false,
+			func(fi *FileInfo, err error) error {
+				return nil
+			},
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+
+		<-tr.Done()
+
+		_, _, err := tr.Wait()
+		So(err, ShouldBeError)
+		So(errors.As(err, &CanceledError{}), ShouldBeFalse)
+		So(tr.Status(), ShouldEqual, Failed)
+	})
+
+	Convey("Completed transfer | UploadFilesAsync", t, func() {
+		dev, sid := newTransferTestDevice()
+
+		tr := UploadFilesAsync(dev, sid,
+			[]string{getTestMocksAsset("mock_dir1")},
+			"/mtp-test-files/temp_dir/test_Transfer",
+			false,
+			func(fi *os.FileInfo, fullPath string, err error) error {
+				return nil
+			},
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+
+		_, _, err := tr.Wait()
+		So(err, ShouldBeNil)
+		So(tr.Status(), ShouldEqual, Completed)
+
+		fi, err := GetObjectFromPath(dev, sid, "/mtp-test-files/temp_dir/test_Transfer")
+		So(err, ShouldBeNil)
+		So(tr.DestinationObjectId(), ShouldEqual, fi.ObjectId)
+	})
+}
@@ -0,0 +1,258 @@
+package mtpx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListTrash - list the objects in the trash of the storage [storageId]
+// the items whose objects are missing from the trash are left out
+func ListTrash(dev Device, storageId uint32) ([]TrashItem, error) {
+	manifest, err := readTrashManifest(dev, storageId)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []TrashItem
+	for _, item := range manifest.Items {
+		fi, err := GetObjectFromPath(dev, storageId, trashItemPath(item))
+		if err != nil {
+			if isObjectNotFound(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		item.FileInfo = fi
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// RestoreFromTrash - move the trashed objects back to their original paths
+// [fileProps] address the objects in the trash, see [TrashItem.FileInfo]
+// the parent directories of the original paths are created if they do not exist
+// returns a [FileNotFoundError] if an object is not in the trash
+// returns a [FileConflictError] if an object with the same name exists at the original path
+func RestoreFromTrash(dev Device, storageId uint32, fileProps []FileProp) error {
+	manifest, err := readTrashManifest(dev, storageId)
+	if err != nil {
+		return err
+	}
+
+	for _, fileProp := range fileProps {
+		i, item, err := findTrashItem(dev, storageId, manifest, fileProp)
+		if err != nil {
+			return err
+		}
+
+		if _, err := MoveFile(dev, storageId, FileProp{item.FileInfo.ObjectId, ""}, filepath.Dir(item.OriginalPath)); err != nil {
+			return err
+		}
+
+		// the directory of the item is empty now
+		if err := DeleteFile(dev, storageId, []FileProp{{0, getFullPath(trashPath, item.Id)}}); err != nil {
+			return err
+		}
+
+		manifest.Items = append(manifest.Items[:i], manifest.Items[i+1:]...)
+		if err := writeTrashManifest(dev, storageId, manifest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EmptyTrash - permanently delete the trashed objects
+// [fileProps] address the objects in the trash, see [TrashItem.FileInfo]
+// if [fileProps] is empty then the whole trash is deleted
+// returns a [FileNotFoundError] if an object is not in the trash
+func EmptyTrash(dev Device, storageId uint32, fileProps []FileProp) error {
+	noCb := func(fi *FileInfo, err error) error {
+		return nil
+	}
+
+	if len(fileProps) < 1 {
+		_, _, err := RemoveAll(dev, storageId, []FileProp{{0, trashPath}}, false, noCb)
+		if _, ok := err.(FileNotFoundError); ok {
+			return nil
+		}
+
+		return err
+	}
+
+	manifest, err := readTrashManifest(dev, storageId)
+	if err != nil {
+		return err
+	}
+
+	for _, fileProp := range fileProps {
+		i, item, err := findTrashItem(dev, storageId, manifest, fileProp)
+		if err != nil {
+			return err
+		}
+
+		if _, _, err := RemoveAll(dev, storageId, []FileProp{{0, getFullPath(trashPath, item.Id)}}, false, noCb); err != nil {
+			return err
+		}
+
+		manifest.Items = append(manifest.Items[:i], manifest.Items[i+1:]...)
+		if err := writeTrashManifest(dev, storageId, manifest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// move the object [fi] into the trash of the storage [storageId]
+// each object is moved into a directory of its own to avoid clashing with the other trashed objects with the same name
+// the manifest is written first so that a moved object is never missing from it, the item is removed again if the object could not be moved
+func trashObject(dev Device, storageId uint32, fi *FileInfo) error {
+	originalPath, err := objectFullPath(dev, fi.ObjectId)
+	if err != nil {
+		return err
+	}
+
+	if originalPath == trashPath || strings.HasPrefix(originalPath, trashPath+PathSep) {
+		return InvalidPathError{error: fmt.Errorf("invalid path: %s. the object is in the trash already", originalPath)}
+	}
+
+	manifest, err := readTrashManifest(dev, storageId)
+	if err != nil {
+		return err
+	}
+
+	deletedAt := time.Now()
+	item := TrashItem{
+		Id:           strconv.FormatInt(deletedAt.UnixNano(), 10),
+		OriginalPath: originalPath,
+		DeletedAt:    deletedAt,
+		IsDir:        fi.IsDir,
+	}
+
+	manifest.Items = append(manifest.Items, item)
+	if err := writeTrashManifest(dev, storageId, manifest); err != nil {
+		return err
+	}
+
+	if _, err := MoveFile(dev, storageId, FileProp{fi.ObjectId, ""}, getFullPath(trashPath, item.Id)); err != nil {
+		manifest.Items = manifest.Items[:len(manifest.Items)-1]
+		_ = writeTrashManifest(dev, storageId, manifest)
+
+		return err
+	}
+
+	return nil
+}
+
+// full path of the object of [item] in the trash
+func trashItemPath(item TrashItem) string {
+	return getFullPath(getFullPath(trashPath, item.Id), filepath.Base(item.OriginalPath))
+}
+
+// find the item of [manifest] holding the object [fileProp]
+// returns the index of the item
+func findTrashItem(dev Device, storageId uint32, manifest *trashManifest, fileProp FileProp) (int, TrashItem, error) {
+	fi, err := GetObjectFromObjectIdOrPath(dev, storageId, fileProp)
+	if err != nil {
+		if isObjectNotFound(err) {
+			return -1, TrashItem{}, FileNotFoundError{error: fmt.Errorf("file not found: %s. %w", fileProp.FullPath, err)}
+		}
+
+		return -1, TrashItem{}, err
+	}
+
+	for i, item := range manifest.Items {
+		itemFi, err := GetObjectFromPath(dev, storageId, trashItemPath(item))
+		if err != nil {
+			if isObjectNotFound(err) {
+				continue
+			}
+
+			return -1, TrashItem{}, err
+		}
+
+		if itemFi.ObjectId == fi.ObjectId {
+			item.FileInfo = itemFi
+
+			return i, item, nil
+		}
+	}
+
+	return -1, TrashItem{}, FileNotFoundError{error: fmt.Errorf("file not found in the trash: %s", fi.FullPath)}
+}
+
+// read the manifest of the trash of the storage [storageId]
+// returns an empty manifest if the trash does not exist
+func readTrashManifest(dev Device, storageId uint32) (*trashManifest, error) {
+	manifest := &trashManifest{}
+
+	fi, err := GetObjectFromPath(dev, storageId, getFullPath(trashPath, trashManifestName))
+	if err != nil {
+		if isObjectNotFound(err) {
+			return manifest, nil
+		}
+
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := dev.GetObject(fi.ObjectId, &buf, func(sent int64) error {
+		return nil
+	}); err != nil {
+		return nil, FileTransferError{error: fmt.Errorf("an error occured while reading the trash manifest. %w", err)}
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), manifest); err != nil {
+		return nil, FileObjectError{error: fmt.Errorf("invalid trash manifest. %w", err)}
+	}
+
+	return manifest, nil
+}
+
+// replace the manifest of the trash of the storage [storageId] with [manifest]
+// the new manifest is sent as a temporary object which is renamed over the old one, a failed write keeps the old manifest
+// the old manifest is deleted before the write if the device cannot rename the objects
+func writeTrashManifest(dev Device, storageId uint32, manifest *trashManifest) error {
+	deviceInfo, err := FetchDeviceInfo(dev)
+	if err != nil {
+		return err
+	}
+
+	trashId, err := MakeDirectory(dev, storageId, trashPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	obj := mtp.ObjectInfo{
+		StorageID:        storageId,
+		ObjectFormat:     mtp.OFC_Undefined,
+		ParentObject:     trashId,
+		Filename:         trashManifestName,
+		CompressedSize:   compressedSize(int64(len(data))),
+		ModificationDate: time.Now(),
+	}
+
+	_, err = handleMakeFile(dev, storageId, &obj, bytes.NewReader(data), int64(len(data)), true, operationSupported(deviceInfo, mtp.OC_MTP_SetObjectPropValue), nil,
+		func(total, sent int64, objectId uint32, err error) error {
+			return nil
+		},
+	)
+
+	return err
+}
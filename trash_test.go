@@ -0,0 +1,211 @@
+package mtpx
+
+import (
+	"bytes"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	if isUsbTestDevice() {
+		t.Skip("the trash tests require the simulated device")
+	}
+
+	const source = "/mtp-test-files/mock_dir1"
+
+	newTrashTestDevice := func() (*mtpxtest.Device, uint32) {
+		dev, err := initTestDevice()
+		So(err, ShouldBeNil)
+
+		storages, err := FetchStorages(dev)
+		So(err, ShouldBeNil)
+
+		return dev.(*mtpxtest.Device), storages[0].Sid
+	}
+
+	trash := func(dev Device, sid uint32, fullPaths ...string) {
+		var fileProps []FileProp
+		for _, fullPath := range fullPaths {
+			fileProps = append(fileProps, FileProp{0, fullPath})
+		}
+
+		So(DeleteFileWithOptions(dev, sid, fileProps, DeleteOptions{Trash: true}), ShouldBeNil)
+	}
+
+	// the trashed items by their original paths
+	listTrash := func(dev Device, sid uint32) map[string]TrashItem {
+		items, err := ListTrash(dev, sid)
+		So(err, ShouldBeNil)
+
+		result := map[string]TrashItem{}
+		for _, item := range items {
+			result[item.OriginalPath] = item
+		}
+
+		return result
+	}
+
+	Convey("Move the objects into the trash | DeleteFileWithOptions", t, func() {
+		sim, sid := newTrashTestDevice()
+		start := time.Now()
+
+		trash(sim, sid, source+"/3", source+"/a.txt", source+"/1/a.txt")
+
+		for _, fullPath := range []string{source + "/3", source + "/a.txt", source + "/1/a.txt"} {
+			_, ok := sim.Lookup(sid, fullPath)
+			So(ok, ShouldBeFalse)
+		}
+
+		items := listTrash(sim, sid)
+		So(items, ShouldHaveLength, 3)
+		So(items[source+"/3"].IsDir, ShouldBeTrue)
+		So(items[source+"/a.txt"].IsDir, ShouldBeFalse)
+		So(items[source+"/a.txt"].DeletedAt, ShouldHappenOnOrAfter, start)
+
+		// the objects with the same name do not clash
+		So(items[source+"/a.txt"].FileInfo.ObjectId, ShouldNotEqual, items[source+"/1/a.txt"].FileInfo.ObjectId)
+
+		data, err := sim.ReadFile(sid, items[source+"/3"].FileInfo.FullPath+"/2/b.txt")
+		So(err, ShouldBeNil)
+		So(data, ShouldResemble, readTestMocksAsset("mock_dir1/3/2/b.txt"))
+
+		// the trash is hidden
+		_, _, _, err = Walk(sim, sid, "/", false, true, true, func(objectId uint32, fi *FileInfo, err error) error {
+			So(fi.Name, ShouldNotEqual, trashDirectoryName)
+
+			return nil
+		})
+		So(err, ShouldBeNil)
+
+		// the objects in the trash are not trashed again
+		err = DeleteFileWithOptions(sim, sid, []FileProp{{0, items[source+"/a.txt"].FileInfo.FullPath}}, DeleteOptions{Trash: true})
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	Convey("Keep the trash consistent if an object cannot be trashed | DeleteFileWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		trash(dev, sid, source+"/a.txt")
+
+		// the manifest cannot be written
+		dev.Inject(mtpxtest.Fault{Op: mtpxtest.OpSendObject, Err: mtp.RCError(mtp.RC_StoreFull)})
+		err := DeleteFileWithOptions(dev, sid, []FileProp{{0, source + "/1/a.txt"}}, DeleteOptions{Trash: true})
+		So(err, ShouldHaveSameTypeAs, SendObjectError{})
+
+		// the object cannot be moved
+		dev.Reset()
+		dev.Inject(mtpxtest.Fault{Op: mtpxtest.OpRunTransaction, Err: mtp.RCError(mtp.RC_GeneralError)})
+		err = DeleteFileWithOptions(dev, sid, []FileProp{{0, source + "/2/b.txt"}}, DeleteOptions{Trash: true})
+		So(err, ShouldBeError)
+
+		dev.Reset()
+
+		// the earlier items are kept and the failed ones are not recorded
+		manifest, err := readTrashManifest(dev, sid)
+		So(err, ShouldBeNil)
+		So(manifest.Items, ShouldHaveLength, 1)
+		So(manifest.Items[0].OriginalPath, ShouldEqual, source+"/a.txt")
+
+		for _, fullPath := range []string{source + "/1/a.txt", source + "/2/b.txt"} {
+			_, err := GetObjectFromPath(dev, sid, fullPath)
+			So(err, ShouldBeNil)
+		}
+
+		// the objects which cannot be looked up are not skipped
+		dev.Inject(mtpxtest.Fault{Op: mtpxtest.OpGetObjectHandles, Err: mtp.RCError(mtp.RC_GeneralError)})
+		err = DeleteFileWithOptions(dev, sid, []FileProp{{0, source + "/1/a.txt"}}, DeleteOptions{Trash: true})
+		So(err, ShouldBeError)
+
+		// the missing objects are skipped
+		dev.Reset()
+		So(DeleteFileWithOptions(dev, sid, []FileProp{{0, source + "/missing.txt"}}, DeleteOptions{Trash: true}), ShouldBeNil)
+	})
+
+	Convey("Delete the objects without the trash | DeleteFileWithOptions", t, func() {
+		sim, sid := newTrashTestDevice()
+
+		So(DeleteFileWithOptions(sim, sid, []FileProp{{0, source + "/a.txt"}}, DeleteOptions{}), ShouldBeNil)
+
+		_, ok := sim.Lookup(sid, source+"/a.txt")
+		So(ok, ShouldBeFalse)
+		_, ok = sim.Lookup(sid, trashPath)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Restore the trashed objects | RestoreFromTrash", t, func() {
+		sim, sid := newTrashTestDevice()
+
+		trash(sim, sid, source+"/3/2", source+"/a.txt")
+
+		// the parent directory of an object is gone
+		_, _, err := RemoveAll(sim, sid, []FileProp{{0, source + "/3"}}, false, func(fi *FileInfo, err error) error {
+			return nil
+		})
+		So(err, ShouldBeNil)
+
+		items := listTrash(sim, sid)
+		So(RestoreFromTrash(sim, sid, []FileProp{
+			{items[source+"/3/2"].FileInfo.ObjectId, ""},
+			{0, items[source+"/a.txt"].FileInfo.FullPath},
+		}), ShouldBeNil)
+
+		data, err := sim.ReadFile(sid, source+"/3/2/b.txt")
+		So(err, ShouldBeNil)
+		So(data, ShouldResemble, readTestMocksAsset("mock_dir1/3/2/b.txt"))
+
+		_, ok := sim.Lookup(sid, source+"/a.txt")
+		So(ok, ShouldBeTrue)
+
+		So(listTrash(sim, sid), ShouldBeEmpty)
+
+		// the object is not in the trash
+		err = RestoreFromTrash(sim, sid, []FileProp{{0, source + "/a.txt"}})
+		So(err, ShouldHaveSameTypeAs, FileNotFoundError{})
+	})
+
+	Convey("Keep the object in the trash if its original path is taken | RestoreFromTrash", t, func() {
+		sim, sid := newTrashTestDevice()
+
+		trash(sim, sid, source+"/a.txt")
+
+		_, err := UploadStream(sim, sid, FileProp{0, source}, "a.txt", bytes.NewReader([]byte("new")), 3, time.Now(),
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+
+		item := listTrash(sim, sid)[source+"/a.txt"]
+		err = RestoreFromTrash(sim, sid, []FileProp{{item.FileInfo.ObjectId, ""}})
+		So(err, ShouldHaveSameTypeAs, FileConflictError{})
+		So(listTrash(sim, sid), ShouldHaveLength, 1)
+	})
+
+	Convey("Empty the trash | EmptyTrash", t, func() {
+		sim, sid := newTrashTestDevice()
+
+		trash(sim, sid, source+"/1", source+"/2", source+"/a.txt")
+
+		item := listTrash(sim, sid)[source+"/1"]
+		So(EmptyTrash(sim, sid, []FileProp{{item.FileInfo.ObjectId, ""}}), ShouldBeNil)
+
+		items := listTrash(sim, sid)
+		So(items, ShouldHaveLength, 2)
+		So(items, ShouldNotContainKey, source+"/1")
+
+		_, ok := sim.Lookup(sid, item.FileInfo.FullPath)
+		So(ok, ShouldBeFalse)
+
+		So(EmptyTrash(sim, sid, nil), ShouldBeNil)
+		So(listTrash(sim, sid), ShouldBeEmpty)
+
+		_, ok = sim.Lookup(sid, trashPath)
+		So(ok, ShouldBeFalse)
+
+		// the trash is empty already
+		So(EmptyTrash(sim, sid, nil), ShouldBeNil)
+	})
+}
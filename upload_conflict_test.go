@@ -0,0 +1,166 @@
+package mtpx
+
+import (
+	"fmt"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUploadConflicts(t *testing.T) {
+	if isUsbTestDevice() {
+		t.Skip("the conflict tests require the simulated device")
+	}
+
+	const destination = "/mtp-test-files/temp_dir/test_UploadConflicts"
+
+	newUploadConflictTestDevice := func() (*mtpxtest.FaultInjector, uint32) {
+		dev, sid := newFaultInjectorTestDevice()
+
+		_, bulkFilesSent, _, err := uploadTestMockDir1(dev, sid, destination, UploadOptions{}, nil)
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, mockDir1TotalFiles)
+
+		return dev, sid
+	}
+
+	Convey("Skip the existing files | UploadFilesWithOptions", t, func() {
+		dev, sid := newUploadConflictTestDevice()
+
+		lastInfo, bulkFilesSent, _, err := uploadTestMockDir1(dev, sid, destination, UploadOptions{ConflictPolicy: ConflictSkip}, nil)
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, 0)
+		So(lastInfo.FilesSkipped, ShouldEqual, mockDir1TotalFiles)
+		So(dev.Calls(mtpxtest.OpSendObject), ShouldEqual, mockDir1TotalFiles)
+	})
+
+	Convey("Skip the identical files | UploadFilesWithOptions", t, func() {
+		dev, sid := newUploadConflictTestDevice()
+
+		// a.txt was changed on the device
+		fi, err := GetObjectFromPath(dev, sid, destination+"/mock_dir1/a.txt")
+		So(err, ShouldBeNil)
+		So(DeleteFile(dev, sid, []FileProp{{fi.ObjectId, ""}}), ShouldBeNil)
+
+		_, err = UploadStream(dev, sid, FileProp{fi.ParentId, ""}, "a.txt", strings.NewReader(""), 0, fi.ModTime,
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+
+		lastInfo, bulkFilesSent, _, err := uploadTestMockDir1(dev, sid, destination, UploadOptions{ConflictPolicy: ConflictSkipIdentical}, nil)
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, 1)
+		So(lastInfo.FilesSkipped, ShouldEqual, mockDir1TotalFiles-1)
+
+		fi, err = GetObjectFromPath(dev, sid, destination+"/mock_dir1/a.txt")
+		So(err, ShouldBeNil)
+		So(fi.Size, ShouldBeGreaterThan, 0)
+	})
+
+	Convey("Rename the uploaded files | UploadFilesWithOptions", t, func() {
+		dev, sid := newUploadConflictTestDevice()
+
+		lastInfo, bulkFilesSent, _, err := uploadTestMockDir1(dev, sid, destination, UploadOptions{ConflictPolicy: ConflictRename}, nil)
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, mockDir1TotalFiles)
+		So(lastInfo.FilesRenamed, ShouldEqual, mockDir1TotalFiles)
+		So(lastInfo.ConflictAction, ShouldEqual, ConflictRename)
+
+		_, _, _, err = uploadTestMockDir1(dev, sid, destination, UploadOptions{ConflictPolicy: ConflictRename}, nil)
+		So(err, ShouldBeNil)
+
+		fc, err := FileExists(dev, sid, []FileProp{
+			{0, destination + "/mock_dir1/a.txt"},
+			{0, destination + "/mock_dir1/a (1).txt"},
+			{0, destination + "/mock_dir1/a (2).txt"},
+			{0, destination + "/mock_dir1/3/2/b (2).txt"},
+		})
+		So(err, ShouldBeNil)
+		for _, c := range fc {
+			So(c.Exists, ShouldBeTrue)
+		}
+	})
+
+	Convey("Fail on the first conflict | UploadFilesWithOptions", t, func() {
+		dev, sid := newUploadConflictTestDevice()
+
+		_, bulkFilesSent, _, err := uploadTestMockDir1(dev, sid, destination, UploadOptions{ConflictPolicy: ConflictFail}, nil)
+		So(err, ShouldHaveSameTypeAs, FileConflictError{})
+		So(bulkFilesSent, ShouldEqual, 0)
+	})
+
+	Convey("Ask for every conflict | UploadFilesWithOptions", t, func() {
+		dev, sid := newUploadConflictTestDevice()
+
+		var conflicts []ConflictInfo
+		lastInfo, bulkFilesSent, _, err := uploadTestMockDir1(dev, sid, destination, UploadOptions{
+			ConflictPolicy: ConflictAsk,
+			ConflictCb: func(c *ConflictInfo) (ConflictPolicy, error) {
+				conflicts = append(conflicts, *c)
+
+				if c.DestinationPath == destination+"/mock_dir1/a.txt" {
+					return ConflictOverwrite, nil
+				}
+
+				return ConflictSkip, nil
+			},
+		}, nil)
+		So(err, ShouldBeNil)
+		So(len(conflicts), ShouldEqual, mockDir1TotalFiles)
+		So(bulkFilesSent, ShouldEqual, 1)
+		So(lastInfo.FilesSkipped, ShouldEqual, mockDir1TotalFiles-1)
+
+		for _, c := range conflicts {
+			So(c.SourceSize, ShouldEqual, c.DestinationSize)
+		}
+
+		// a callback is required
+		_, _, _, err = uploadTestMockDir1(dev, sid, destination, UploadOptions{ConflictPolicy: ConflictAsk}, nil)
+		So(err, ShouldBeError)
+	})
+	Convey("List a destination directory once | UploadFilesWithOptions", t, func() {
+		const totalFiles = 20
+
+		source := filepath.Join(newTempMocksDir("test_UploadConflicts", true), "many_files")
+		So(os.MkdirAll(source, os.ModePerm), ShouldBeNil)
+		for i := 0; i < totalFiles; i++ {
+			So(ioutil.WriteFile(filepath.Join(source, fmt.Sprintf("%d.txt", i)), []byte("data"), os.ModePerm), ShouldBeNil)
+		}
+
+		dev, sid := newFaultInjectorTestDevice()
+		upload := func() (int64, error) {
+			_, bulkFilesSent, _, _, err := UploadFilesWithOptions(dev, sid,
+				[]string{source},
+				destination,
+				false,
+				UploadOptions{ConflictPolicy: ConflictOverwrite},
+				func(fi *os.FileInfo, fullPath string, err error) error {
+					return nil
+				},
+				func(fi *ProgressInfo, err error) error {
+					return nil
+				},
+			)
+
+			return bulkFilesSent, err
+		}
+
+		bulkFilesSent, err := upload()
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, totalFiles)
+
+		// every file conflicts with the previous upload
+		listings := dev.Calls(mtpxtest.OpGetObjectHandles)
+		bulkFilesSent, err = upload()
+		So(err, ShouldBeNil)
+		So(bulkFilesSent, ShouldEqual, totalFiles)
+		// the directory is not listed for every file
+		So(dev.Calls(mtpxtest.OpGetObjectHandles)-listings, ShouldBeLessThan, totalFiles)
+	})
+}
@@ -11,7 +11,7 @@ import (
 )
 
 func TestUploadFiles(t *testing.T) {
-	dev, err := Initialize(Init{})
+	dev, err := initTestDevice()
 	if err != nil {
 		log.Panic(err)
 	}
@@ -0,0 +1,141 @@
+package mtpx
+
+import (
+	"bytes"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hides the size of the underlying reader
+type unsizedReader struct {
+	r io.Reader
+}
+
+func (u unsizedReader) Read(p []byte) (int, error) {
+	return u.r.Read(p)
+}
+
+func TestUploadStream(t *testing.T) {
+	dev, err := initTestDevice()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer Dispose(dev)
+
+	storages, err := FetchStorages(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sid := storages[0].Sid
+	destination := "/mtp-test-files/temp_dir/test_UploadStream"
+	modTime := time.Date(2020, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	if err := DeleteFile(dev, sid, []FileProp{{0, destination}}); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Upload a reader to a new directory | UploadStream", t, func() {
+		data := strings.Repeat("generated content\n", 5000)
+
+		var statuses []TransferStatus
+		var lastInfo ProgressInfo
+		objectId, err := UploadStream(dev, sid, FileProp{0, destination + "/new"}, "a.txt",
+			strings.NewReader(data), int64(len(data)), modTime,
+			func(fi *ProgressInfo, err error) error {
+				statuses = append(statuses, fi.Status)
+				lastInfo = *fi
+
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+		So(statuses[len(statuses)-1], ShouldEqual, Completed)
+		So(lastInfo.FilesSent, ShouldEqual, 1)
+		So(lastInfo.BulkFileSize.Sent, ShouldEqual, len(data))
+		So(lastInfo.FileInfo.FullPath, ShouldEqual, destination+"/new/a.txt")
+		So(lastInfo.FileInfo.ObjectId, ShouldEqual, objectId)
+
+		fi, err := GetObjectFromPath(dev, sid, destination+"/new/a.txt")
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, objectId)
+		So(fi.Size, ShouldEqual, len(data))
+
+		var buf bytes.Buffer
+		So(dev.GetObject(objectId, &buf, mtp.EmptyProgressFunc), ShouldBeNil)
+		So(buf.String(), ShouldEqual, data)
+	})
+
+	Convey("Overwrite a file using the objectId of the parent | UploadStream", t, func() {
+		parentId, err := MakeDirectory(dev, sid, destination)
+		So(err, ShouldBeNil)
+
+		_, err = UploadStream(dev, sid, FileProp{ObjectId: parentId}, "b.txt",
+			strings.NewReader("first"), 5, modTime,
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+
+		objectId, err := UploadStream(dev, sid, FileProp{ObjectId: parentId}, "b.txt",
+			strings.NewReader("second"), 6, modTime,
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+
+		fi, err := GetObjectFromPath(dev, sid, destination+"/b.txt")
+		So(err, ShouldBeNil)
+		So(fi.ObjectId, ShouldEqual, objectId)
+		So(fi.Size, ShouldEqual, 6)
+	})
+
+	Convey("Upload a reader of unknown size | UploadStreamSpooled", t, func() {
+		data := strings.Repeat("0123456789", 10000)
+
+		objectId, err := UploadStreamSpooled(dev, sid, FileProp{0, destination}, "c.txt",
+			unsizedReader{strings.NewReader(data)}, modTime,
+			func(fi *ProgressInfo, err error) error {
+				So(fi.ActiveFileSize.Total, ShouldEqual, len(data))
+
+				return nil
+			},
+		)
+		So(err, ShouldBeNil)
+
+		var buf bytes.Buffer
+		So(dev.GetObject(objectId, &buf, mtp.EmptyProgressFunc), ShouldBeNil)
+		So(buf.String(), ShouldEqual, data)
+	})
+
+	Convey("The parent is not a directory | UploadStream", t, func() {
+		fi, err := GetObjectFromPath(dev, sid, destination+"/b.txt")
+		So(err, ShouldBeNil)
+
+		_, err = UploadStream(dev, sid, FileProp{ObjectId: fi.ObjectId}, "e.txt",
+			strings.NewReader("e"), 1, modTime,
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+		So(err, ShouldHaveSameTypeAs, InvalidPathError{})
+	})
+
+	// the aborted transfer leaves the session out of sync, keep it as the last test
+	Convey("The reader is shorter than the size | UploadStream", t, func() {
+		_, err := UploadStream(dev, sid, FileProp{0, destination}, "d.txt",
+			strings.NewReader("short"), 100, modTime,
+			func(fi *ProgressInfo, err error) error {
+				return nil
+			},
+		)
+		So(err, ShouldHaveSameTypeAs, FileTransferError{})
+	})
+}
@@ -258,3 +258,26 @@ func transferRate(size int64, lastSentTime time.Time) float64 {
 func isHiddenFile(filename string) bool {
 	return len(filename) > 0 && filename[0:1] == "."
 }
+
+// the first name of the form "photo (1).jpg", "photo (2).jpg", ... for which [exists] returns false
+func availableFilename(filename string, exists func(name string) bool) string {
+	ext := extension(filename, false)
+	base := strings.TrimSuffix(filename, "."+ext)
+
+	// hidden files without an extension (unix style)
+	if ext == "" || base == "" {
+		ext = ""
+		base = filename
+	}
+
+	for n := 1; ; n++ {
+		name := fmt.Sprintf("%s (%d)", base, n)
+		if ext != "" {
+			name = fmt.Sprintf("%s.%s", name, ext)
+		}
+
+		if !exists(name) {
+			return name
+		}
+	}
+}
@@ -153,4 +153,16 @@ func TestUtils(t *testing.T) {
 			So(ext, ShouldEqual, f.ext)
 		}
 	})
+
+	Convey("Test availableFilename", t, func() {
+		taken := map[string]bool{"photo (1).jpg": true, "archive (1).tar.gz": true}
+		exists := func(name string) bool {
+			return taken[name]
+		}
+
+		So(availableFilename("photo.jpg", exists), ShouldEqual, "photo (2).jpg")
+		So(availableFilename("archive.tar.gz", exists), ShouldEqual, "archive (2).tar.gz")
+		So(availableFilename("notes", exists), ShouldEqual, "notes (1)")
+		So(availableFilename(".bashrc", exists), ShouldEqual, ".bashrc (1)")
+	})
 }
@@ -0,0 +1,225 @@
+package mtpx
+
+import (
+	"errors"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// flips the first byte read from [r]
+type flippingReader struct {
+	r       io.Reader
+	flipped bool
+}
+
+func (f *flippingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if n > 0 && !f.flipped {
+		p[0] ^= 0xff
+		f.flipped = true
+	}
+
+	return n, err
+}
+
+// flips the first byte of every object sent to the device
+type corruptingSendDevice struct {
+	Device
+}
+
+func (d corruptingSendDevice) SendObject(r io.Reader, size int64, progressCb mtp.ProgressFunc) error {
+	return d.Device.SendObject(&flippingReader{r: r}, size, progressCb)
+}
+
+// flips the first byte of an object the first time it is read from the device
+type corruptingGetDevice struct {
+	Device
+
+	read map[uint32]bool
+}
+
+func (d corruptingGetDevice) GetObject(handle uint32, w io.Writer, progressCb mtp.ProgressFunc) error {
+	if d.read[handle] {
+		return d.Device.GetObject(handle, w, progressCb)
+	}
+
+	d.read[handle] = true
+	pr, pw := io.Pipe()
+	done := make(chan error)
+	go func() {
+		_, err := io.Copy(w, &flippingReader{r: pr})
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	err := d.Device.GetObject(handle, pw, progressCb)
+	pw.CloseWithError(err)
+	if copyErr := <-done; err == nil {
+		err = copyErr
+	}
+
+	return err
+}
+
+// reports every object a byte shorter than it is
+type shortSizeDevice struct {
+	Device
+}
+
+func (d shortSizeDevice) GetObjectInfo(handle uint32, info *mtp.ObjectInfo) error {
+	if err := d.Device.GetObjectInfo(handle, info); err != nil {
+		return err
+	}
+
+	info.CompressedSize -= 1
+
+	return nil
+}
+
+func TestVerifyTransfers(t *testing.T) {
+	if isUsbTestDevice() {
+		t.Skip("the verification tests require the simulated device")
+	}
+
+	const destination = "/mtp-test-files/temp_dir/test_VerifyTransfers"
+
+	upload := func(dev Device, sid uint32, options UploadOptions) (ProgressInfo, []error, *TransferReport, error) {
+		var progressErrs []error
+		lastInfo, _, report, err := uploadTestMockDir1(dev, sid, destination, options, func(fi *ProgressInfo, err error) error {
+			if err != nil {
+				progressErrs = append(progressErrs, err)
+			}
+
+			return nil
+		})
+
+		return lastInfo, progressErrs, report, err
+	}
+
+	download := func(dev Device, sid uint32, options DownloadOptions) (ProgressInfo, []error, *TransferReport, error) {
+		var progressErrs []error
+		lastInfo, _, report, err := downloadTestMockDir1(dev, sid, newTempMocksDir("test_VerifyTransfers", true), options, func(fi *ProgressInfo, err error) error {
+			if err != nil {
+				progressErrs = append(progressErrs, err)
+			}
+
+			return nil
+		})
+
+		return lastInfo, progressErrs, report, err
+	}
+
+	Convey("Verify the uploaded files | UploadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		lastInfo, progressErrs, _, err := upload(dev, sid, UploadOptions{Verify: VerifyChecksum})
+		So(err, ShouldBeNil)
+		So(progressErrs, ShouldBeEmpty)
+		So(lastInfo.FilesVerified, ShouldEqual, mockDir1TotalFiles)
+
+		lastInfo, _, _, err = upload(dev, sid, UploadOptions{})
+		So(err, ShouldBeNil)
+		So(lastInfo.FilesVerified, ShouldEqual, 0)
+	})
+
+	Convey("Detect a corrupted upload | UploadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		// the sizes match
+		_, _, _, err := upload(corruptingSendDevice{dev}, sid, UploadOptions{Verify: VerifySize})
+		So(err, ShouldBeNil)
+
+		_, progressErrs, report, err := upload(corruptingSendDevice{dev}, sid, UploadOptions{Verify: VerifyChecksum})
+		So(err, ShouldHaveSameTypeAs, FileVerificationError{})
+		So(progressErrs, ShouldHaveLength, 1)
+		So(progressErrs[0], ShouldHaveSameTypeAs, FileVerificationError{})
+		So(report.Failed, ShouldHaveLength, 1)
+
+		// the corrupted object is deleted
+		fc, err := FileExists(dev, sid, []FileProp{{0, report.Failed[0].DestinationPath}})
+		So(err, ShouldBeNil)
+		So(fc[0].Exists, ShouldBeFalse)
+
+		lastInfo, progressErrs, report, err := upload(corruptingSendDevice{dev}, sid, UploadOptions{
+			Verify:          VerifyChecksum,
+			ContinueOnError: true,
+		})
+		So(err, ShouldBeNil)
+		So(lastInfo.FilesVerified, ShouldEqual, 0)
+		So(progressErrs, ShouldHaveLength, mockDir1TotalFiles)
+		So(report.Failed, ShouldHaveLength, mockDir1TotalFiles)
+		So(report.Failed[0].Err, ShouldHaveSameTypeAs, FileVerificationError{})
+	})
+
+	Convey("The progress callback aborts on a mismatch | UploadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		stop := errors.New("stop")
+		options := UploadOptions{Verify: VerifyChecksum, ContinueOnError: true}
+		_, _, report, err := uploadTestMockDir1(corruptingSendDevice{dev}, sid, destination, options, func(fi *ProgressInfo, err error) error {
+			if err != nil {
+				return stop
+			}
+
+			return nil
+		})
+		So(errors.Is(err, stop), ShouldBeTrue)
+		So(report.Failed, ShouldHaveLength, 1)
+		So(report.Failed[0].Err, ShouldHaveSameTypeAs, FileVerificationError{})
+	})
+
+	Convey("Detect a size mismatch | UploadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		_, _, report, err := upload(shortSizeDevice{dev}, sid, UploadOptions{Verify: VerifySize})
+		So(err, ShouldHaveSameTypeAs, FileVerificationError{})
+		So(report.Succeeded, ShouldBeEmpty)
+	})
+
+	Convey("Verify the downloaded files | DownloadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+
+		lastInfo, progressErrs, _, err := download(dev, sid, DownloadOptions{Verify: VerifyChecksum})
+		So(err, ShouldBeNil)
+		So(progressErrs, ShouldBeEmpty)
+		So(lastInfo.FilesVerified, ShouldEqual, mockDir1TotalFiles)
+	})
+
+	Convey("The progress callback aborts on a mismatch | DownloadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+		corrupting := corruptingGetDevice{Device: dev, read: map[uint32]bool{}}
+
+		stop := errors.New("stop")
+		options := DownloadOptions{Verify: VerifyChecksum, ContinueOnError: true}
+		_, _, report, err := downloadTestMockDir1(corrupting, sid, newTempMocksDir("test_VerifyTransfers", true), options, func(fi *ProgressInfo, err error) error {
+			if err != nil {
+				return stop
+			}
+
+			return nil
+		})
+		So(errors.Is(err, stop), ShouldBeTrue)
+		So(report.Failed, ShouldHaveLength, 1)
+		So(report.Succeeded, ShouldBeEmpty)
+	})
+
+	Convey("Detect a corrupted download | DownloadFilesWithOptions", t, func() {
+		dev, sid := newFaultInjectorTestDevice()
+		corrupting := corruptingGetDevice{Device: dev, read: map[uint32]bool{}}
+
+		lastInfo, progressErrs, report, err := download(corrupting, sid, DownloadOptions{
+			Verify:          VerifyChecksum,
+			ContinueOnError: true,
+		})
+		So(err, ShouldBeNil)
+		So(lastInfo.FilesVerified, ShouldEqual, 0)
+		So(progressErrs, ShouldHaveLength, mockDir1TotalFiles)
+		So(report.Failed, ShouldHaveLength, mockDir1TotalFiles)
+
+		// the mismatching file is kept
+		So(existsLocal(filepath.Join(newTempMocksDir("test_VerifyTransfers", false), "mock_dir1", "a.txt")), ShouldBeTrue)
+	})
+}
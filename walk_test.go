@@ -8,7 +8,7 @@ import (
 )
 
 func TestWalk(t *testing.T) {
-	dev, err := Initialize(Init{})
+	dev, err := initTestDevice()
 	if err != nil {
 		log.Panic(err)
 	}
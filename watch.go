@@ -0,0 +1,355 @@
+package mtpx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ganeshrvel/go-mtpfs/mtp"
+	"github.com/ganeshrvel/usb"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Watcher - emits events when mtp devices are attached or detached
+// and when the storages of a tracked device become available
+type Watcher struct {
+	interval    time.Duration
+	listDevices func() ([]UsbDevice, error)
+
+	events    chan WatchEvent
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	tracked []*trackedDevice
+}
+
+// Watch - poll the usb bus every [interval] and emit the changes as events
+// a [DeviceAttached] event is emitted for each of the devices which are already attached
+// the default interval of 1 second is used if [interval] is 0
+func Watch(interval time.Duration) *Watcher {
+	return newWatcher(interval, ListDevices)
+}
+
+func newWatcher(interval time.Duration, listDevices func() ([]UsbDevice, error)) *Watcher {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	w := &Watcher{
+		interval:    interval,
+		listDevices: listDevices,
+		events:      make(chan WatchEvent, 16),
+		done:        make(chan struct{}),
+	}
+
+	w.wg.Add(1)
+	go w.run()
+
+	return w
+}
+
+// Events - the channel of events
+// it is closed by [Close]
+func (w *Watcher) Events() <-chan WatchEvent {
+	return w.events
+}
+
+// Close - stop watching
+func (w *Watcher) Close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.wg.Wait()
+		close(w.events)
+	})
+}
+
+// Track - wrap [dev] which was opened from the usb device [ud] (see [ListDevices])
+// once [ud] is detached every operation on the returned device fails with a [DeviceDisconnectedError]
+// a [StoragesAvailable] event is emitted when the storages of [dev] become available
+// (eg: after the user unlocks the phone and selects File Transfer)
+// the returned device serializes the operations, use it in place of [dev]
+func (w *Watcher) Track(dev Device, ud UsbDevice) Device {
+	t := &trackedDevice{dev: dev, ud: ud, sem: make(chan struct{}, 1)}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.tracked = append(w.tracked, t)
+
+	return t
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	var attached []UsbDevice
+	for {
+		var ok bool
+		if attached, ok = w.poll(attached); !ok {
+			return
+		}
+
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// compare the attached devices with the previous poll and emit the changes
+// returns false if the watcher was closed
+func (w *Watcher) poll(attached []UsbDevice) ([]UsbDevice, bool) {
+	devices, err := w.listDevices()
+	if err != nil {
+		return attached, w.emit(WatchEvent{Type: WatchFailed, Err: err})
+	}
+
+	for _, ud := range attached {
+		if containsUsbDevice(devices, ud) {
+			continue
+		}
+
+		if !w.emit(WatchEvent{Type: DeviceDetached, Device: ud}) {
+			return devices, false
+		}
+	}
+
+	for _, ud := range devices {
+		if containsUsbDevice(attached, ud) {
+			continue
+		}
+
+		if !w.emit(WatchEvent{Type: DeviceAttached, Device: ud}) {
+			return devices, false
+		}
+	}
+
+	return devices, w.pollTracked(devices)
+}
+
+// disconnect the tracked devices which were detached and check for their storages
+// returns false if the watcher was closed
+func (w *Watcher) pollTracked(devices []UsbDevice) bool {
+	w.mu.Lock()
+	var tracked []*trackedDevice
+	for _, t := range w.tracked {
+		if !containsUsbDevice(devices, t.ud) {
+			t.disconnect()
+
+			continue
+		}
+
+		tracked = append(tracked, t)
+	}
+	w.tracked = tracked
+	w.mu.Unlock()
+
+	for _, t := range tracked {
+		if t.storagesAvailable {
+			continue
+		}
+
+		storages, ok := t.tryFetchStorages()
+		if !ok {
+			continue
+		}
+
+		t.storagesAvailable = true
+
+		if !w.emit(WatchEvent{Type: StoragesAvailable, Device: t.ud, Storages: storages}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// returns false if the watcher was closed
+func (w *Watcher) emit(e WatchEvent) bool {
+	select {
+	case w.events <- e:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// the bus address changes when a device is plugged in again
+func containsUsbDevice(devices []UsbDevice, ud UsbDevice) bool {
+	for _, d := range devices {
+		if d.Bus == ud.Bus && d.Address == ud.Address && d.VendorId == ud.VendorId && d.ProductId == ud.ProductId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// a device which fails fast once it was detached
+type trackedDevice struct {
+	dev Device
+	ud  UsbDevice
+
+	// serializes the operations
+	sem chan struct{}
+
+	disconnected int32
+
+	// only accessed by the watcher goroutine
+	storagesAvailable bool
+}
+
+func (t *trackedDevice) disconnect() {
+	atomic.StoreInt32(&t.disconnected, 1)
+}
+
+func (t *trackedDevice) isDisconnected() bool {
+	return atomic.LoadInt32(&t.disconnected) == 1
+}
+
+func (t *trackedDevice) disconnectedError() error {
+	return DeviceDisconnectedError{
+		error: fmt.Errorf("the device %04x:%04x at bus %d, address %d was disconnected", t.ud.VendorId, t.ud.ProductId, t.ud.Bus, t.ud.Address),
+	}
+}
+
+// run the operation [fn] unless the device was disconnected
+func (t *trackedDevice) run(fn func() error) error {
+	if t.isDisconnected() {
+		return t.disconnectedError()
+	}
+
+	t.sem <- struct{}{}
+	defer func() { <-t.sem }()
+
+	if t.isDisconnected() {
+		return t.disconnectedError()
+	}
+
+	err := fn()
+	if err == nil {
+		return nil
+	}
+
+	// the operation was in flight while the device was detached
+	if t.isDisconnected() || errors.Is(err, usb.ERROR_NO_DEVICE) {
+		t.disconnect()
+
+		return t.disconnectedError()
+	}
+
+	return err
+}
+
+// fetch the storages unless an operation is in progress
+// the watcher must not wait for a transfer to complete, it would miss the device being detached
+func (t *trackedDevice) tryFetchStorages() ([]StorageData, bool) {
+	select {
+	case t.sem <- struct{}{}:
+	default:
+		return nil, false
+	}
+	defer func() { <-t.sem }()
+
+	if t.isDisconnected() {
+		return nil, false
+	}
+
+	storages, err := FetchStorages(t.dev)
+	if err != nil {
+		return nil, false
+	}
+
+	return storages, true
+}
+
+func (t *trackedDevice) Close() error {
+	t.sem <- struct{}{}
+	defer func() { <-t.sem }()
+
+	return t.dev.Close()
+}
+
+func (t *trackedDevice) GetDeviceInfo(info *mtp.DeviceInfo) error {
+	return t.run(func() error {
+		return t.dev.GetDeviceInfo(info)
+	})
+}
+
+func (t *trackedDevice) GetStorageIDs(info *mtp.Uint32Array) error {
+	return t.run(func() error {
+		return t.dev.GetStorageIDs(info)
+	})
+}
+
+func (t *trackedDevice) GetStorageInfo(ID uint32, info *mtp.StorageInfo) error {
+	return t.run(func() error {
+		return t.dev.GetStorageInfo(ID, info)
+	})
+}
+
+func (t *trackedDevice) GetObjectHandles(storageID, objFormatCode, parent uint32, info *mtp.Uint32Array) error {
+	return t.run(func() error {
+		return t.dev.GetObjectHandles(storageID, objFormatCode, parent, info)
+	})
+}
+
+func (t *trackedDevice) GetObjectInfo(handle uint32, info *mtp.ObjectInfo) error {
+	return t.run(func() error {
+		return t.dev.GetObjectInfo(handle, info)
+	})
+}
+
+func (t *trackedDevice) GetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error {
+	return t.run(func() error {
+		return t.dev.GetObjectPropValue(objHandle, objPropCode, value)
+	})
+}
+
+func (t *trackedDevice) SetObjectPropValue(objHandle uint32, objPropCode uint16, value interface{}) error {
+	return t.run(func() error {
+		return t.dev.SetObjectPropValue(objHandle, objPropCode, value)
+	})
+}
+
+func (t *trackedDevice) SendObjectInfo(wantStorageID, wantParent uint32, info *mtp.ObjectInfo) (storageID, parent, handle uint32, err error) {
+	err = t.run(func() error {
+		var err error
+		storageID, parent, handle, err = t.dev.SendObjectInfo(wantStorageID, wantParent, info)
+
+		return err
+	})
+
+	return storageID, parent, handle, err
+}
+
+func (t *trackedDevice) SendObject(r io.Reader, size int64, progressCb mtp.ProgressFunc) error {
+	return t.run(func() error {
+		return t.dev.SendObject(r, size, progressCb)
+	})
+}
+
+func (t *trackedDevice) GetObject(handle uint32, w io.Writer, progressCb mtp.ProgressFunc) error {
+	return t.run(func() error {
+		return t.dev.GetObject(handle, w, progressCb)
+	})
+}
+
+func (t *trackedDevice) DeleteObject(handle uint32) error {
+	return t.run(func() error {
+		return t.dev.DeleteObject(handle)
+	})
+}
+
+func (t *trackedDevice) RunTransaction(req *mtp.Container, rep *mtp.Container, dest io.Writer, src io.Reader, writeSize int64, progressCb mtp.ProgressFunc) error {
+	return t.run(func() error {
+		return runTransaction(t.dev, req, rep, dest, src, writeSize, progressCb)
+	})
+}
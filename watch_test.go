@@ -0,0 +1,145 @@
+package mtpx
+
+import (
+	"errors"
+	"github.com/ganeshrvel/go-mtpx/mtpxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a usb bus where the devices are plugged in and out by the tests
+type testUsbBus struct {
+	mu      sync.Mutex
+	devices []UsbDevice
+	err     error
+}
+
+func (b *testUsbBus) set(err error, devices ...UsbDevice) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.devices = devices
+	b.err = err
+}
+
+func (b *testUsbBus) listDevices() ([]UsbDevice, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]UsbDevice(nil), b.devices...), b.err
+}
+
+func nextWatchEvent(w *Watcher) WatchEvent {
+	select {
+	case e := <-w.Events():
+		return e
+	case <-time.After(5 * time.Second):
+		return WatchEvent{}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	phone1 := UsbDevice{VendorId: 0x18d1, ProductId: 0x4ee1, SerialNumber: "A1", Bus: 1, Address: 4}
+	phone2 := UsbDevice{VendorId: 0x04e8, ProductId: 0x6860, SerialNumber: "B2", Bus: 2, Address: 7}
+
+	Convey("Attach and detach devices | Watch", t, func() {
+		bus := &testUsbBus{}
+		bus.set(nil, phone1)
+
+		w := newWatcher(10*time.Millisecond, bus.listDevices)
+		defer w.Close()
+
+		// the devices which are already attached are reported
+		So(nextWatchEvent(w), ShouldResemble, WatchEvent{Type: DeviceAttached, Device: phone1})
+
+		bus.set(nil, phone1, phone2)
+		So(nextWatchEvent(w), ShouldResemble, WatchEvent{Type: DeviceAttached, Device: phone2})
+
+		bus.set(nil, phone2)
+		So(nextWatchEvent(w), ShouldResemble, WatchEvent{Type: DeviceDetached, Device: phone1})
+
+		listErr := errors.New("libusb failed")
+		bus.set(listErr, phone2)
+		So(nextWatchEvent(w), ShouldResemble, WatchEvent{Type: WatchFailed, Err: listErr})
+
+		// plugging the phone in again assigns a new bus address
+		phone1.Address = 5
+		bus.set(nil, phone1, phone2)
+		So(nextWatchEvent(w), ShouldResemble, WatchEvent{Type: DeviceAttached, Device: phone1})
+
+		w.Close()
+
+		_, ok := <-w.Events()
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Storages become available | Watch", t, func() {
+		bus := &testUsbBus{}
+		bus.set(nil, phone1)
+
+		w := newWatcher(10*time.Millisecond, bus.listDevices)
+		defer w.Close()
+
+		So(nextWatchEvent(w).Type, ShouldEqual, DeviceAttached)
+
+		// a locked phone has no storages
+		sim := mtpxtest.New()
+		dev := w.Track(sim, phone1)
+
+		_, err := FetchStorages(dev)
+		So(err, ShouldHaveSameTypeAs, NoStorageError{})
+
+		sid := sim.AddStorage("Internal shared storage", 1<<30)
+
+		e := nextWatchEvent(w)
+		So(e.Type, ShouldEqual, StoragesAvailable)
+		So(e.Device, ShouldResemble, phone1)
+		So(len(e.Storages), ShouldEqual, 1)
+		So(e.Storages[0].Sid, ShouldEqual, sid)
+	})
+
+	Convey("Detached device fails fast | Watch", t, func() {
+		bus := &testUsbBus{}
+		bus.set(nil, phone1)
+
+		w := newWatcher(10*time.Millisecond, bus.listDevices)
+		defer w.Close()
+
+		So(nextWatchEvent(w).Type, ShouldEqual, DeviceAttached)
+
+		sim := mtpxtest.New()
+		sim.AddStorage("Internal shared storage", 1<<30)
+		dev := w.Track(sim, phone1)
+
+		So(nextWatchEvent(w).Type, ShouldEqual, StoragesAvailable)
+
+		bus.set(nil)
+		So(nextWatchEvent(w), ShouldResemble, WatchEvent{Type: DeviceDetached, Device: phone1})
+
+		_, err := FetchStorages(dev)
+		So(err, ShouldHaveSameTypeAs, StorageInfoError{})
+		So(errors.As(err, &DeviceDisconnectedError{}), ShouldBeTrue)
+	})
+
+	Convey("Dropped connection | Watch", t, func() {
+		w := newWatcher(time.Hour, func() ([]UsbDevice, error) {
+			return []UsbDevice{phone1}, nil
+		})
+		defer w.Close()
+
+		sim := mtpxtest.New()
+		sid := sim.AddStorage("Internal shared storage", 1<<30)
+		dev := w.Track(mtpxtest.NewFaultInjector(sim, mtpxtest.Fault{Op: mtpxtest.OpGetObjectHandles, Disconnect: true}), phone1)
+
+		_, _, _, err := Walk(dev, sid, "/", false, false, false, func(objectId uint32, fi *FileInfo, err error) error {
+			return nil
+		})
+		So(errors.As(err, &DeviceDisconnectedError{}), ShouldBeTrue)
+
+		// the following operations fail without reaching the device
+		_, err = FetchStorages(dev)
+		So(errors.As(err, &DeviceDisconnectedError{}), ShouldBeTrue)
+	})
+}